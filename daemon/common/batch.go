@@ -0,0 +1,71 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"strings"
+	"time"
+)
+
+const (
+	/*
+		PrefixCommandBatch is the magic string to prefix command input, in order to run several commands one after
+		another in a single message. The commands are separated by CommandBatchSeparator.
+	*/
+	PrefixCommandBatch = ".batch"
+
+	CommandBatchSeparator = ";;" // CommandBatchSeparator separates individual commands in a batch
+)
+
+// ErrBadBatch reminds user of the proper syntax to run a batch of commands.
+var ErrBadBatch = errors.New(PrefixCommandBatch + " command1 " + CommandBatchSeparator + " command2 ...")
+
+// ErrBatchTimeout is the result of commands that did not get to run as the whole batch had run out of time.
+var ErrBatchTimeout = errors.New("skipped due to batch timeout")
+
+/*
+processBatch runs the commands (content separated by CommandBatchSeparator) one after another. The batch as a whole is
+given the timeout of input command, and each command may use up the time left by its predecessors. Results of individual
+commands are labelled by their number and trigger prefix, then concatenated into output. Individual command errors are
+presented in output rather than failing the entire batch.
+Return the combined result and command content that is suitable for logging.
+*/
+func (proc *CommandProcessor) processBatch(conf processorConfig, cmd toolbox.Command) (ret *toolbox.Result, logCommandContent string) {
+	deadline := time.Now().Add(time.Duration(cmd.TimeoutSec) * time.Second)
+	logActor := getLogActor(cmd)
+	var out bytes.Buffer
+	logContents := make([]string, 0, 4)
+	for _, content := range strings.Split(cmd.Content, CommandBatchSeparator) {
+		subCmd := cmd
+		subCmd.Content = strings.TrimSpace(content)
+		if subCmd.Content == "" {
+			continue
+		}
+		beginTimeNano := time.Now().UnixNano()
+		feature, trigger, logContent, err := proc.lookupFeature(conf, &subCmd)
+		logContents = append(logContents, logContent)
+		var result *toolbox.Result
+		if err != nil {
+			result = &toolbox.Result{Error: err}
+		} else if subCmd.TimeoutSec = int(deadline.Sub(time.Now()).Seconds()); subCmd.TimeoutSec < 1 {
+			result = &toolbox.Result{Error: ErrBatchTimeout}
+		} else {
+			proc.logger.Info("processBatch", logActor, nil, "going to run %s", logContent)
+			result = feature.Execute(subCmd)
+			proc.logger.Info("processBatch", logActor, nil, "finished %s (ok? %v)", logContent, result.Error == nil)
+		}
+		result.Command = subCmd
+		result.Command.Content = logContent
+		if trigger != "" {
+			proc.audit(result, trigger, beginTimeNano)
+		}
+		out.WriteString(fmt.Sprintf("%d%s: %s\n", len(logContents), trigger, strings.TrimSpace(result.ResetCombinedText())))
+	}
+	logCommandContent = strings.Join(logContents, " "+CommandBatchSeparator+" ")
+	if len(logContents) == 0 {
+		return &toolbox.Result{Error: ErrBadBatch}, logCommandContent
+	}
+	return &toolbox.Result{Output: out.String()}, logCommandContent
+}
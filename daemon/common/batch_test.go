@@ -0,0 +1,43 @@
+package common
+
+import (
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"github.com/HouzuoGuo/laitos/toolbox/filter"
+	"testing"
+)
+
+func TestCommandProcessorBatch(t *testing.T) {
+	features := &toolbox.FeatureSet{}
+	if err := features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc := CommandProcessor{
+		Features:       features,
+		CommandFilters: []filter.CommandFilter{&filter.PINAndShortcuts{PIN: "mypin"}},
+		ResultFilters: []filter.ResultFilter{
+			&filter.ResetCombinedText{},
+			&filter.LintText{TrimSpaces: true, MaxLength: 30},
+		},
+		TriggerAccess: &filter.TriggerAccess{DenyTriggers: []string{".e kill"}},
+	}
+	// Empty batch
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.batch ;; "}); result.Error != ErrBadBatch {
+		t.Fatal(result)
+	}
+	// Errors of individual commands do not fail the batch
+	fullOutput := "1.s: a\n2: " + ErrBadPrefix.Error() + "\n3.e: " + filter.ErrTriggerNotAllowed.Error() + "\n4.s: exit status 1" + toolbox.CombinedTextSeparator + "b"
+	result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.batch .s echo a ;; .tg ;; .e kill;;.s echo b && false"})
+	if result.Error != nil || result.Command.Content != ".s echo a ;; .tg ;; .e kill ;; .s echo b && false" ||
+		result.CombinedOutput != fullOutput[0:30] {
+		t.Fatal(result)
+	}
+	// The full output is available for paging
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.more"}); result.Error != nil || result.CombinedOutput != fullOutput[30:60] {
+		t.Fatal(result)
+	}
+	// Commands that run out of time are skipped
+	result = proc.Process(toolbox.Command{TimeoutSec: 2, Content: "mypin.plt 0 100 2 .batch .s sleep 3 ;; .s echo a"})
+	if result.Error != nil || result.CombinedOutput != "1.s: Program timed out\n2.s: "+ErrBatchTimeout.Error() {
+		t.Fatal(result)
+	}
+}
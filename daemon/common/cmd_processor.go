@@ -4,11 +4,14 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/HouzuoGuo/laitos/misc"
 	"github.com/HouzuoGuo/laitos/toolbox"
 	"github.com/HouzuoGuo/laitos/toolbox/filter"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,13 +37,35 @@ var RegexCommandWithPLT = regexp.MustCompile(`[^\d]*(\d+)[^\d]+(\d+)[^\d]*(\d+)(
 
 var DurationStats = misc.NewStats() // DurationStats stores statistics of duration of all commands executed.
 
+// FeatureCommands and FeatureErrors count the number of executed and failed commands, by their feature trigger.
+var FeatureCommands, FeatureErrors = misc.NewCounters(), misc.NewCounters()
+
+/*
+DangerousInvocations are feature triggers (optionally followed by parameters) that are capable of damaging the host or
+the program, altering its security measures, or revealing its clients and usage. IsSaneForInternet warns if they are
+not restricted by TriggerAccess.
+*/
+var DangerousInvocations = []string{".s", ".e kill", ".e stop", ".e reload", ".e unban", ".e bans", ".e audit"}
+
 // Pre-configured environment and configuration for processing feature commands.
 type CommandProcessor struct {
 	Features       *toolbox.FeatureSet    // Features is the aggregation of initialised toolbox feature routines.
 	CommandFilters []filter.CommandFilter // CommandFilters are applied one by one to alter input command content and/or timeout.
 	ResultFilters  []filter.ResultFilter  // ResultFilters are applied one by one to alter command execution result.
+	TriggerAccess  *filter.TriggerAccess  // TriggerAccess optionally restricts the features that may be invoked via this processor.
+	AuditLog       *misc.AuditLog         // AuditLog optionally keeps a persistent record of processed commands.
+	/*
+		ExemptFromBan stops the processor from refusing commands of banned clients and from recording failed PIN
+		attempts in the ban registry. This is useful when most of the input are not meant to be commands, such as mails.
+	*/
+	ExemptFromBan bool
 
-	logger misc.Logger
+	jobs         Jobs
+	pages        OutputPages
+	reloadMutex  sync.RWMutex    // reloadMutex protects features and filters from being read while they are replaced
+	inFlight     *sync.WaitGroup // inFlight counts the commands and jobs that are using the current features and filters
+	inFlightInit sync.Once
+	logger       misc.Logger
 }
 
 // SetLogger assigns a logger to command processor and all of its filters.
@@ -51,6 +76,64 @@ func (proc *CommandProcessor) SetLogger(logger misc.Logger) {
 	}
 }
 
+/*
+Reload replaces features, filters, and trigger access restriction of this processor with those of the other processor.
+Commands being processed finish using the previous configuration, and subsequent commands use the new configuration.
+Background jobs and memorised output pages are retained.
+Return a wait group that is done after commands and jobs that are still using the previous configuration have finished.
+*/
+func (proc *CommandProcessor) Reload(other *CommandProcessor) (previous *sync.WaitGroup) {
+	proc.reloadMutex.Lock()
+	defer proc.reloadMutex.Unlock()
+	previous = proc.getInFlight()
+	proc.inFlight = new(sync.WaitGroup)
+	proc.Features = other.Features
+	proc.CommandFilters = other.CommandFilters
+	proc.ResultFilters = other.ResultFilters
+	proc.TriggerAccess = other.TriggerAccess
+	proc.SetLogger(proc.logger)
+	return
+}
+
+// getInFlight returns the wait group of commands and jobs that are using the current features and filters.
+func (proc *CommandProcessor) getInFlight() *sync.WaitGroup {
+	proc.inFlightInit.Do(func() {
+		proc.inFlight = new(sync.WaitGroup)
+	})
+	return proc.inFlight
+}
+
+/*
+processorConfig is a consistent view of the features and filters of a processor. A command is processed entirely using
+the view taken when it arrives, so that a feature may reload configuration (and hence the processor) without waiting
+for itself to finish.
+*/
+type processorConfig struct {
+	features       *toolbox.FeatureSet
+	commandFilters []filter.CommandFilter
+	resultFilters  []filter.ResultFilter
+	triggerAccess  *filter.TriggerAccess
+	inFlight       *sync.WaitGroup
+}
+
+/*
+getConfig returns the current features and filters of the processor, and counts the caller among their users. The caller
+must call inFlight.Done after it has finished using them.
+*/
+func (proc *CommandProcessor) getConfig() processorConfig {
+	proc.reloadMutex.RLock()
+	defer proc.reloadMutex.RUnlock()
+	conf := processorConfig{
+		features:       proc.Features,
+		commandFilters: proc.CommandFilters,
+		resultFilters:  proc.ResultFilters,
+		triggerAccess:  proc.TriggerAccess,
+		inFlight:       proc.getInFlight(),
+	}
+	conf.inFlight.Add(1)
+	return conf
+}
+
 /*
 IsEmpty returns true only if the command processor does not have any command filter configuration, which means the
 command processor is not configured for use.
@@ -77,22 +160,44 @@ func (proc *CommandProcessor) IsSaneForInternet() (errs []error) {
 	if proc.CommandFilters == nil {
 		errs = append(errs, errors.New(ErrBadProcessorConfig+"CommandFilters is not assigned"))
 	} else {
-		// Check whether PIN bridge is sanely configured
-		seenPIN := false
+		// Check whether PIN and one-time code bridges are sanely configured
+		seenPIN, seenShortcuts, seenTOTP := false, false, false
 		for _, cmdBridge := range proc.CommandFilters {
 			if pin, yes := cmdBridge.(*filter.PINAndShortcuts); yes {
-				if pin.PIN == "" && (pin.Shortcuts == nil || len(pin.Shortcuts) == 0) {
+				seenShortcuts = len(pin.Shortcuts) > 0
+				if !pin.IsConfigured() {
 					errs = append(errs, errors.New(ErrBadProcessorConfig+"PIN is empty and there is no shortcut defined, hence no command will ever execute."))
 				}
 				if pin.PIN != "" && len(pin.PIN) < 7 {
 					errs = append(errs, errors.New(ErrBadProcessorConfig+"PIN is too short, make it at least 7 characters long to be somewhat secure."))
 				}
+				seenUserNames := map[string]struct{}{}
+				for _, user := range pin.Users {
+					if user.Name == "" {
+						errs = append(errs, errors.New(ErrBadProcessorConfig+"a PIN user does not have a name."))
+					} else if _, seen := seenUserNames[user.Name]; seen {
+						errs = append(errs, fmt.Errorf(ErrBadProcessorConfig+"PIN user name \"%s\" is not unique.", user.Name))
+					}
+					seenUserNames[user.Name] = struct{}{}
+					if len(user.PIN) < 7 {
+						errs = append(errs, fmt.Errorf(ErrBadProcessorConfig+"PIN of user \"%s\" is too short, make it at least 7 characters long to be somewhat secure.", user.Name))
+					}
+				}
 				seenPIN = true
-				break
+			} else if totp, yes := cmdBridge.(*filter.TOTP); yes && totp.IsConfigured() {
+				// One-time code may be used in place of PIN
+				if err := totp.SelfTest(); err != nil {
+					errs = append(errs, fmt.Errorf(ErrBadProcessorConfig+"TOTP secret cannot be used to calculate codes - %v", err))
+				}
+				seenPIN = true
+				seenTOTP = true
 			}
 		}
 		if !seenPIN {
-			errs = append(errs, errors.New(ErrBadProcessorConfig+"\"PINAndShortcuts\" bridge is not used, this is horribly insecure."))
+			errs = append(errs, errors.New(ErrBadProcessorConfig+"neither \"PINAndShortcuts\" nor \"TOTP\" bridge is used, this is horribly insecure."))
+		}
+		if seenShortcuts && seenTOTP {
+			proc.logger.Warning("IsSaneForInternet", "CommandProcessor", nil, "shortcuts do not work along with TOTP, because an expanded shortcut does not carry one-time code")
 		}
 	}
 	if proc.ResultFilters == nil {
@@ -113,6 +218,33 @@ func (proc *CommandProcessor) IsSaneForInternet() (errs []error) {
 			errs = append(errs, errors.New(ErrBadProcessorConfig+"\"LintText\" bridge is not used, this may cause crashes or undesired telephone cost."))
 		}
 	}
+	// Dangerous features are not a configuration error, but user should be aware of their exposure.
+	for _, invocation := range proc.getAllowedDangerousInvocations() {
+		proc.logger.Warning("IsSaneForInternet", "CommandProcessor", nil, "dangerous command \"%s\" is allowed, consider restricting it via TriggerAccess", invocation)
+	}
+	return
+}
+
+// getAllowedDangerousInvocations returns the dangerous invocations that are enabled and not restricted by TriggerAccess.
+func (proc *CommandProcessor) getAllowedDangerousInvocations() (ret []string) {
+	ret = make([]string, 0, len(DangerousInvocations))
+	if proc.Features == nil {
+		return
+	}
+	for _, invocation := range DangerousInvocations {
+		triggerAndParams := strings.SplitN(invocation, " ", 2)
+		trigger := toolbox.Trigger(triggerAndParams[0])
+		var params string
+		if len(triggerAndParams) > 1 {
+			params = triggerAndParams[1]
+		}
+		if _, enabled := proc.Features.LookupByTrigger[trigger]; !enabled {
+			continue
+		}
+		if proc.TriggerAccess == nil || proc.TriggerAccess.IsAllowed(trigger, params) {
+			ret = append(ret, invocation)
+		}
+	}
 	return
 }
 
@@ -132,15 +264,30 @@ func (proc *CommandProcessor) Process(cmd toolbox.Command) (ret *toolbox.Result)
 	if misc.EmergencyLockDown {
 		return &toolbox.Result{Error: misc.ErrEmergencyLockDown}
 	}
+	// Do not execute a command from a client who is banned due to repeated failures
+	clientID, spoofableClientID := cmd.ClientID, cmd.SpoofableClientID
+	if !proc.ExemptFromBan && misc.Bans.IsBanned(clientID) {
+		return &toolbox.Result{Error: misc.ErrBanned}
+	}
+	// Features and filters must not be replaced half way through
+	conf := proc.getConfig()
+	defer conf.inFlight.Done()
 	var bridgeErr error
 	var matchedFeature toolbox.Feature
+	var matchedTrigger toolbox.Trigger
 	var overrideLintText filter.LintText
 	var hasOverrideLintText bool
 	var logCommandContent string
+	var logActor string
+	var isJob, jobSubmitted, isBatch bool
 	// Walk the command through all bridges
-	for _, cmdBridge := range proc.CommandFilters {
+	for _, cmdBridge := range conf.commandFilters {
 		cmd, bridgeErr = cmdBridge.Transform(cmd)
 		if bridgeErr != nil {
+			// Repeatedly failing to present a valid PIN or one-time code will get the client banned
+			if !proc.ExemptFromBan && !spoofableClientID && (bridgeErr == filter.ErrPINAndShortcutNotFound || bridgeErr == filter.ErrTOTPNotFound || bridgeErr == filter.ErrTOTPReused) {
+				misc.Bans.RecordFailure(clientID)
+			}
 			ret = &toolbox.Result{Error: bridgeErr}
 			goto result
 		}
@@ -149,19 +296,19 @@ func (proc *CommandProcessor) Process(cmd toolbox.Command) (ret *toolbox.Result)
 	if ret = cmd.Trim(); ret != nil {
 		goto result
 	}
+	// Look for paging magic, which retrieves more output of the previous command without running it again.
+	if ret = proc.pages.Turn(cmd, conf.getOutputPageSize()); ret != nil {
+		goto result
+	}
 	// Look for PLT (position, length, timeout) override, it is going to affect LintText bridge.
 	if cmd.FindAndRemovePrefix(PrefixCommandPLT) {
 		// Find the configured LintText bridge
-		for _, resultBridge := range proc.ResultFilters {
-			if aBridge, isLintText := resultBridge.(*filter.LintText); isLintText {
-				overrideLintText = *aBridge
-				hasOverrideLintText = true
-				break
-			}
-		}
-		if !hasOverrideLintText {
+		if lintText := conf.getLintText(); lintText == nil {
 			ret = &toolbox.Result{Error: errors.New("PLT is not available because LintText is not used")}
 			goto result
+		} else {
+			overrideLintText = *lintText
+			hasOverrideLintText = true
 		}
 		// Parse P. L. T. <cmd> parameters
 		pltParams := RegexCommandWithPLT.FindStringSubmatch(cmd.Content)
@@ -188,32 +335,40 @@ func (proc *CommandProcessor) Process(cmd toolbox.Command) (ret *toolbox.Result)
 			goto result
 		}
 	}
+	// Look for batch magic, which runs several commands one after another.
+	if cmd.FindAndRemovePrefix(PrefixCommandBatch) {
+		isBatch = true
+		ret, logCommandContent = proc.processBatch(conf, cmd)
+		goto result
+	}
+	// Look for job magic, which either runs the command in background or manages existing jobs.
+	if cmd.FindAndRemovePrefix(PrefixCommandJob) {
+		if !strings.HasPrefix(cmd.Content, ".") {
+			ret = proc.jobs.Manage(cmd.UserName, cmd.Content, conf.getJobPageSize(overrideLintText, hasOverrideLintText))
+			goto result
+		}
+		isJob = true
+	}
 	/*
 		Now the command has gone through modifications made by command filters. Keep a copy of its content for logging
 		purpose before it is further manipulated by individual feature's routine that may add or remove bits from the
 		content.
 	*/
-	logCommandContent = cmd.Content
-	// Look for command's prefix among configured features
-	for prefix, configuredFeature := range proc.Features.LookupByTrigger {
-		if cmd.FindAndRemovePrefix(string(prefix)) {
-			// Hacky workaround - do not log content of AES decryption commands as they can reveal encryption key
-			if prefix == toolbox.AESDecryptTrigger || prefix == toolbox.TwoFATrigger {
-				logCommandContent = "<hidden due to AESDecryptTrigger or TwoFATrigger>"
-			}
-			matchedFeature = configuredFeature
-			break
-		}
-	}
-	// Unknown command prefix or the requested feature is not configured
-	if matchedFeature == nil {
-		ret = &toolbox.Result{Error: ErrBadPrefix}
+	matchedFeature, matchedTrigger, logCommandContent, bridgeErr = proc.lookupFeature(conf, &cmd)
+	if bridgeErr != nil {
+		ret = &toolbox.Result{Error: bridgeErr}
 		goto result
 	}
 	// Run the feature
-	proc.logger.Info("Process", "CommandProcessor", nil, "going to run %s", logCommandContent)
+	logActor = getLogActor(cmd)
+	if isJob {
+		ret = proc.submitJob(conf, matchedFeature, matchedTrigger, cmd, logCommandContent, logActor)
+		jobSubmitted = ret.Error == nil
+		goto result
+	}
+	proc.logger.Info("Process", logActor, nil, "going to run %s", logCommandContent)
 	defer func() {
-		proc.logger.Info("Process", "CommandProcessor", nil, "finished %s (ok? %v)", logCommandContent, ret.Error == nil)
+		proc.logger.Info("Process", logActor, nil, "finished %s (ok? %v)", logCommandContent, ret.Error == nil)
 	}()
 	ret = matchedFeature.Execute(cmd)
 
@@ -226,11 +381,26 @@ result:
 		after triggering bridges, and before triggering features.
 	*/
 	ret.Command.Content = logCommandContent
+	// Only the commands that have identified a feature are worth auditing, a job is audited when it finishes.
+	if matchedTrigger != "" && !jobSubmitted {
+		proc.audit(ret, matchedTrigger, beginTimeNano)
+	}
 	// Walk through result bridges
-	for _, resultBridge := range proc.ResultFilters {
-		// LintText bridge may have been manipulated by override
-		if _, isLintText := resultBridge.(*filter.LintText); isLintText && hasOverrideLintText {
-			resultBridge = &overrideLintText
+	for _, resultBridge := range conf.resultFilters {
+		if lintText, isLintText := resultBridge.(*filter.LintText); isLintText {
+			// Memorise the complete output of a feature or batch so that caller may page through it later
+			if matchedTrigger != "" && !jobSubmitted || isBatch && ret.Error == nil {
+				fullText := *lintText
+				fullText.BeginPosition = 0
+				fullText.MaxLength = 0
+				fullResult := *ret
+				fullText.Transform(&fullResult)
+				proc.pages.Memorise(ret.Command, fullResult.CombinedOutput)
+			}
+			// LintText bridge may have been manipulated by override
+			if hasOverrideLintText {
+				resultBridge = &overrideLintText
+			}
 		}
 		if err := resultBridge.Transform(ret); err != nil {
 			return &toolbox.Result{Command: ret.Command, Error: bridgeErr}
@@ -239,6 +409,185 @@ result:
 	return
 }
 
+/*
+lookupFeature looks for the command's prefix among configured features and removes the prefix from command content.
+Return the feature, its trigger, and command content that is suitable for logging. Return an error if the feature is not
+configured, or it may not be invoked via this processor by the command's user.
+*/
+func (proc *CommandProcessor) lookupFeature(conf processorConfig, cmd *toolbox.Command) (matchedFeature toolbox.Feature, matchedTrigger toolbox.Trigger, logCommandContent string, err error) {
+	logCommandContent = cmd.Content
+	for prefix, configuredFeature := range conf.features.LookupByTrigger {
+		if cmd.FindAndRemovePrefix(string(prefix)) {
+			// Hacky workaround - do not log content of AES decryption and vault commands as they can reveal encryption key
+			if prefix == toolbox.AESDecryptTrigger || prefix == toolbox.TwoFATrigger || prefix == toolbox.VaultTrigger {
+				logCommandContent = "<hidden due to AESDecryptTrigger, TwoFATrigger, or VaultTrigger>"
+			} else if prefix == toolbox.NotesTrigger {
+				logCommandContent = getNotesLogContent(cmd.Content)
+			}
+			matchedFeature = configuredFeature
+			matchedTrigger = prefix
+			break
+		}
+	}
+	// Unknown command prefix or the requested feature is not configured
+	if matchedFeature == nil {
+		err = ErrBadPrefix
+		return
+	}
+	// The feature may be configured yet not allowed to be invoked via this processor
+	if conf.triggerAccess != nil && !conf.triggerAccess.IsAllowed(matchedTrigger, cmd.Content) {
+		proc.logger.Warning("Process", "CommandProcessor", nil, "refuse to run %s as it is not allowed", logCommandContent)
+		err = filter.ErrTriggerNotAllowed
+		return
+	}
+	// User who identified themselves by their own PIN may be further restricted
+	if cmd.UserName != "" {
+		for _, cmdBridge := range conf.commandFilters {
+			if pin, isPIN := cmdBridge.(*filter.PINAndShortcuts); isPIN && !pin.IsUserAllowed(cmd.UserName, matchedTrigger, cmd.Content) {
+				proc.logger.Warning("Process", cmd.UserName, nil, "refuse to run %s as it is not allowed for the user", logCommandContent)
+				err = filter.ErrTriggerNotAllowed
+				return
+			}
+		}
+	}
+	// Help only describes the features that may be invoked via this processor by the command's user
+	if help, isHelp := matchedFeature.(*toolbox.Help); isHelp {
+		userName := cmd.UserName
+		restrictedHelp := *help
+		restrictedHelp.IsTriggerAllowed = func(trigger toolbox.Trigger) bool {
+			return conf.isTriggerAllowedWithAnyParams(userName, trigger)
+		}
+		matchedFeature = &restrictedHelp
+	}
+	return
+}
+
+// isTriggerAllowedWithAnyParams returns true only if the user may invoke the feature trigger with at least some parameters.
+func (conf processorConfig) isTriggerAllowedWithAnyParams(userName string, trigger toolbox.Trigger) bool {
+	if conf.triggerAccess != nil && !conf.triggerAccess.IsAllowedWithAnyParams(trigger) {
+		return false
+	}
+	for _, cmdBridge := range conf.commandFilters {
+		if pin, isPIN := cmdBridge.(*filter.PINAndShortcuts); isPIN && !pin.IsUserAllowedWithAnyParams(userName, trigger) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+getNotesLogContent returns notes command content that is suitable for logging. Note text and search terms are concealed
+because they may carry secrets, the action and note name are retained.
+*/
+func getNotesLogContent(params string) string {
+	fields := strings.Fields(params)
+	if len(fields) > 0 && strings.ToLower(fields[0]) == toolbox.NotesActSearch {
+		fields = fields[:1]
+	}
+	if len(fields) > 2 {
+		fields = append(fields[:2], "<hidden text>")
+	}
+	return strings.Join(append([]string{toolbox.NotesTrigger}, fields...), " ")
+}
+
+// getLogActor returns the PIN user name of the command, or the processor itself if the command does not carry a user name.
+func getLogActor(cmd toolbox.Command) string {
+	if cmd.UserName != "" {
+		return cmd.UserName
+	}
+	return "CommandProcessor"
+}
+
+// getLintText returns the configured LintText result filter, or nil if it is not used.
+func (conf processorConfig) getLintText() *filter.LintText {
+	for _, resultBridge := range conf.resultFilters {
+		if lintText, isLintText := resultBridge.(*filter.LintText); isLintText {
+			return lintText
+		}
+	}
+	return nil
+}
+
+// getOutputPageSize returns the maximum length of output in a response, or 0 (unlimited) if LintText is not used.
+func (conf processorConfig) getOutputPageSize() int {
+	if lintText := conf.getLintText(); lintText != nil {
+		return lintText.MaxLength
+	}
+	return 0
+}
+
+/*
+getJobPageSize returns the length of job output that fits in a response alongside job status. Return 0 (unlimited) if
+LintText is not used.
+*/
+func (conf processorConfig) getJobPageSize(overrideLintText filter.LintText, hasOverrideLintText bool) int {
+	lintText := &overrideLintText
+	if !hasOverrideLintText {
+		if lintText = conf.getLintText(); lintText == nil {
+			return 0
+		}
+	}
+	if pageSize := lintText.MaxLength - JobOutputHeaderLen; pageSize > 0 {
+		return pageSize
+	}
+	return 1
+}
+
+/*
+submitJob runs the feature in background and responds with the job ID. The job is given a generous timeout, and it is
+logged and audited when it finishes.
+*/
+func (proc *CommandProcessor) submitJob(conf processorConfig, feature toolbox.Feature, trigger toolbox.Trigger, cmd toolbox.Command, logCommandContent, logActor string) *toolbox.Result {
+	logCmd := cmd
+	logCmd.Content = logCommandContent
+	if cmd.TimeoutSec < JobTimeoutSec {
+		cmd.TimeoutSec = JobTimeoutSec
+	}
+	// The job keeps using the features after the command that submitted it has finished
+	conf.inFlight.Add(1)
+	job, err := proc.jobs.Submit(logCmd, func(cancel <-chan struct{}) *toolbox.Result {
+		defer conf.inFlight.Done()
+		beginTimeNano := time.Now().UnixNano()
+		cmd.Cancel = cancel
+		result := feature.Execute(cmd)
+		result.Command = logCmd
+		result.ResetCombinedText()
+		proc.logger.Info("Process", logActor, nil, "finished job %s (ok? %v)", logCommandContent, result.Error == nil)
+		proc.audit(result, trigger, beginTimeNano)
+		return result
+	})
+	if err != nil {
+		conf.inFlight.Done()
+		return &toolbox.Result{Error: err}
+	}
+	proc.logger.Info("Process", logActor, nil, "going to run %s as job %s", logCommandContent, job.ID)
+	return &toolbox.Result{Output: job.ID}
+}
+
+// audit counts the command execution result and writes it into audit log, if the log is configured.
+func (proc *CommandProcessor) audit(result *toolbox.Result, trigger toolbox.Trigger, beginTimeNano int64) {
+	FeatureCommands.Increase(string(trigger))
+	if result.Error != nil {
+		FeatureErrors.Increase(string(trigger))
+	}
+	if !proc.AuditLog.IsConfigured() {
+		return
+	}
+	err := proc.AuditLog.Append(misc.AuditRecord{
+		Timestamp:  time.Now(),
+		Channel:    proc.logger.ComponentName,
+		ClientID:   result.Command.ClientID,
+		UserName:   result.Command.UserName,
+		Trigger:    string(trigger),
+		Content:    result.Command.Content,
+		OK:         result.Error == nil,
+		DurationMS: (time.Now().UnixNano() - beginTimeNano) / int64(time.Millisecond),
+	})
+	if err != nil {
+		proc.logger.Warning("audit", result.Command.ClientID, err, "failed to write audit log")
+	}
+}
+
 // Return a realistic command processor for test cases. The only feature made available and initialised is shell execution.
 func GetTestCommandProcessor() *CommandProcessor {
 	// Prepare feature set - the shell execution feature should be available even without configuration
@@ -4,8 +4,12 @@ import (
 	"github.com/HouzuoGuo/laitos/misc"
 	"github.com/HouzuoGuo/laitos/toolbox"
 	"github.com/HouzuoGuo/laitos/toolbox/filter"
+	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommandProcessorProcess(t *testing.T) {
@@ -87,6 +91,61 @@ func TestCommandProcessorProcess(t *testing.T) {
 		t.Fatalf("%v | %v | %v | %+v", result.Error, result.Output, result.CombinedOutput, result.Command)
 	}
 
+	// Deny shell feature and try
+	proc.TriggerAccess = &filter.TriggerAccess{DenyTriggers: []string{".s"}}
+	cmd = toolbox.Command{TimeoutSec: 5, Content: "mypin.secho alpha"}
+	result = proc.Process(cmd)
+	if !reflect.DeepEqual(result.Command, toolbox.Command{TimeoutSec: 5, Content: ".secho beta"}) ||
+		result.Error != filter.ErrTriggerNotAllowed || result.Output != "" || result.CombinedOutput != filter.ErrTriggerNotAllowed.Error()[0:2] {
+		t.Fatalf("%+v", result)
+	}
+	// Allow only the log action of environment control
+	proc.TriggerAccess = &filter.TriggerAccess{AllowTriggers: []string{".e log"}}
+	if result = proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.e stop"}); result.Error != filter.ErrTriggerNotAllowed {
+		t.Fatalf("%+v", result)
+	}
+	if result = proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.e log"}); result.Error != nil {
+		t.Fatalf("%+v", result)
+	}
+	proc.TriggerAccess = nil
+
+	// Named users who have their own PIN
+	proc.CommandFilters[0] = &filter.PINAndShortcuts{PIN: "mypin", Users: []filter.PINUser{
+		{Name: "alice", PIN: "alicepin"},
+		{Name: "bob", PIN: "bobpin", AllowTriggers: []string{".e log"}},
+	}}
+	cmd = toolbox.Command{TimeoutSec: 5, Content: "alicepin.secho alpha"}
+	result = proc.Process(cmd)
+	if !reflect.DeepEqual(result.Command, toolbox.Command{TimeoutSec: 5, Content: ".secho beta", UserName: "alice"}) ||
+		result.Error != nil || result.Output != "beta\n" || result.CombinedOutput != "be" {
+		t.Fatalf("%+v", result)
+	}
+	if result = proc.Process(toolbox.Command{TimeoutSec: 5, Content: "bobpin.secho alpha"}); result.Error != filter.ErrTriggerNotAllowed {
+		t.Fatalf("%+v", result)
+	}
+	if result = proc.Process(toolbox.Command{TimeoutSec: 5, Content: "bobpin.elog"}); result.Error != nil || result.Command.UserName != "bob" {
+		t.Fatalf("%+v", result)
+	}
+	proc.CommandFilters[0] = &filter.PINAndShortcuts{PIN: "mypin"}
+
+	// Keep audit records of the commands that identified a feature
+	proc.AuditLog = &misc.AuditLog{FilePath: "/tmp/laitos-TestCommandProcessorProcess-audit", Secret: "secret"}
+	os.Remove(proc.AuditLog.FilePath)
+	os.Remove(proc.AuditLog.FilePath + misc.AuditHeadFileSuffix)
+	if err := proc.AuditLog.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc.Process(toolbox.Command{TimeoutSec: 5, Content: "badpin.secho alpha"})
+	proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.secho alpha", ClientID: "1.2.3.4"})
+	if records, err := proc.AuditLog.GetLatest(10); err != nil || len(records) != 1 ||
+		records[0].ClientID != "1.2.3.4" || records[0].Trigger != ".s" || records[0].Content != ".secho beta" || !records[0].OK {
+		t.Fatal(records, err)
+	}
+	if num, _, err := misc.VerifyAuditLog(proc.AuditLog.FilePath, "secret"); err != nil || num != 1 {
+		t.Fatal(num, err)
+	}
+	proc.AuditLog = nil
+
 	// Trigger emergency lock down and try
 	misc.TriggerEmergencyLockDown()
 	cmd = toolbox.Command{TimeoutSec: 1, Content: "mypin  .plt  2, 5. 3  .s  sleep 2 && echo -n 0123456789 "}
@@ -144,6 +203,29 @@ func TestCommandProcessorIsSaneForInternet(t *testing.T) {
 	if errs := proc.IsSaneForInternet(); len(errs) != 1 {
 		t.Fatal(errs)
 	}
+	// PIN users must have unique names and long PINs
+	proc.CommandFilters = []filter.CommandFilter{&filter.PINAndShortcuts{Users: []filter.PINUser{
+		{Name: "alice", PIN: "very-long-pin"},
+		{Name: "alice", PIN: "short"},
+		{PIN: "very-long-pin"},
+	}}}
+	if errs := proc.IsSaneForInternet(); len(errs) != 4 {
+		t.Fatal(errs)
+	}
+	proc.CommandFilters = []filter.CommandFilter{&filter.PINAndShortcuts{Users: []filter.PINUser{{Name: "alice", PIN: "very-long-pin"}}}}
+	if errs := proc.IsSaneForInternet(); len(errs) != 1 {
+		t.Fatal(errs)
+	}
+	// One-time code in place of PIN
+	proc.CommandFilters = []filter.CommandFilter{&filter.TOTP{Secret: "iuu3xchz3ftf6hdh"}}
+	if errs := proc.IsSaneForInternet(); len(errs) != 1 {
+		t.Fatal(errs)
+	}
+	proc.CommandFilters = []filter.CommandFilter{&filter.TOTP{Secret: "!"}}
+	if errs := proc.IsSaneForInternet(); len(errs) != 2 {
+		t.Fatal(errs)
+	}
+	proc.CommandFilters = []filter.CommandFilter{&filter.PINAndShortcuts{PIN: "very-long-pin"}}
 	// No linter bridge
 	proc.ResultFilters = []filter.ResultFilter{}
 	if errs := proc.IsSaneForInternet(); len(errs) != 1 {
@@ -159,7 +241,60 @@ func TestCommandProcessorIsSaneForInternet(t *testing.T) {
 	if errs := proc.IsSaneForInternet(); len(errs) != 0 {
 		t.Fatal(errs)
 	}
+	// Dangerous invocations are reported unless they are restricted
+	if dangerous := proc.getAllowedDangerousInvocations(); !reflect.DeepEqual(dangerous, DangerousInvocations) {
+		t.Fatal(dangerous)
+	}
+	proc.TriggerAccess = &filter.TriggerAccess{AllowTriggers: []string{".e info", ".e log"}}
+	if dangerous := proc.getAllowedDangerousInvocations(); len(dangerous) != 0 {
+		t.Fatal(dangerous)
+	}
+	proc.TriggerAccess = &filter.TriggerAccess{DenyTriggers: []string{".s", ".e kill", ".e stop", ".e reload"}}
+	if dangerous := proc.getAllowedDangerousInvocations(); !reflect.DeepEqual(dangerous, []string{".e unban", ".e bans", ".e audit"}) {
+		t.Fatal(dangerous)
+	}
+}
 
+func TestCommandProcessorHelp(t *testing.T) {
+	features := &toolbox.FeatureSet{}
+	if err := features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc := CommandProcessor{
+		Features: features,
+		CommandFilters: []filter.CommandFilter{&filter.PINAndShortcuts{PIN: "mypin", Users: []filter.PINUser{
+			{Name: "bob", PIN: "bobpin", AllowTriggers: []string{".h", ".c"}},
+		}}},
+		ResultFilters: []filter.ResultFilter{&filter.LintText{MaxLength: 100}},
+		TriggerAccess: &filter.TriggerAccess{AllowTriggers: []string{".h", ".e log", ".s"}, DenyTriggers: []string{".s"}},
+	}
+	// Help only lists the features allowed by the processor
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.h"}); result.Error != nil || result.Output != ".e .h (.h trigger for usage)" {
+		t.Fatalf("%+v", result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "mypin.h s"}); result.Error == nil {
+		t.Fatalf("%+v", result)
+	}
+	// A user is further restricted by their own access control
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "bobpin.h"}); result.Error != nil || result.Output != ".h (.h trigger for usage)" {
+		t.Fatalf("%+v", result)
+	}
+}
+
+func TestReservedTriggers(t *testing.T) {
+	// Plugins must not take over the magic prefixes of command processor
+	reserved := make(map[toolbox.Trigger]bool)
+	for _, trigger := range toolbox.ReservedTriggers {
+		reserved[trigger] = true
+	}
+	for _, prefix := range []string{PrefixCommandPLT, PrefixCommandJob, PrefixCommandBatch, ".more", ".page"} {
+		if !reserved[toolbox.Trigger(prefix)] {
+			t.Fatal(prefix)
+		}
+	}
+	if !RegexCommandPaging.MatchString(".more") || !RegexCommandPaging.MatchString(".page 2") {
+		t.Fatal("paging prefixes have changed")
+	}
 }
 
 func TestGetTestCommandProcessor(t *testing.T) {
@@ -175,16 +310,58 @@ func TestGetTestCommandProcessor(t *testing.T) {
 
 func TestConcealedLogMessages(t *testing.T) {
 	proc := GetTestCommandProcessor()
-	// These two features are the ones to be concealed from log
+	// These three features are the ones to be concealed from log
 	proc.Features.AESDecrypt = toolbox.GetTestAESDecrypt()
 	proc.Features.TwoFACodeGenerator = toolbox.TwoFACodeGenerator{SecretFile: toolbox.GetTestAESDecrypt().EncryptedFiles[toolbox.TestAESDecryptFileAlphaName]}
-	// Reinitialise features so that it understands the two new prefixes
+	proc.Features.Vault = toolbox.GetTestVault()
+	// Reinitialise features so that it understands the three new prefixes
 	if err := proc.Features.Initialise(); err != nil {
 		t.Fatal(err)
 	}
 	proc.Process(toolbox.Command{Content: "verysecret .a does not matter", TimeoutSec: 10})
 	proc.Process(toolbox.Command{Content: "verysecret .2 does not matter", TimeoutSec: 10})
-	t.Log("Please observe <hidden due to AESDecryptTrigger or TwoFATrigger> from log output, otherwise consider this test is failed")
+	if result := proc.Process(toolbox.Command{Content: "verysecret .v get 44a4 does not matter", TimeoutSec: 10}); strings.Contains(result.Command.Content, "44a4") {
+		t.Fatal(result.Command.Content)
+	}
+	t.Log("Please observe <hidden due to AESDecryptTrigger, TwoFATrigger, or VaultTrigger> from log output, otherwise consider this test is failed")
+}
+
+func TestConcealedNotes(t *testing.T) {
+	proc := GetTestCommandProcessor()
+	proc.Features.Notes = toolbox.GetTestNotes()
+	defer os.Remove(proc.Features.Notes.FilePath)
+	if err := proc.Features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc.AuditLog = &misc.AuditLog{FilePath: "/tmp/laitos-TestConcealedNotes-audit", Secret: "secret"}
+	os.Remove(proc.AuditLog.FilePath)
+	os.Remove(proc.AuditLog.FilePath + misc.AuditHeadFileSuffix)
+	defer os.Remove(proc.AuditLog.FilePath)
+	defer os.Remove(proc.AuditLog.FilePath + misc.AuditHeadFileSuffix)
+	if err := proc.AuditLog.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if result := proc.Process(toolbox.Command{Content: "verysecret .n add wifi password is hunter2", TimeoutSec: 10}); result.Error != nil {
+		t.Fatal(result)
+	}
+	proc.Process(toolbox.Command{Content: "verysecret .n search hunter2", TimeoutSec: 10})
+	if result := proc.Process(toolbox.Command{Content: "verysecret .n get wifi", TimeoutSec: 10}); result.Error != nil || !strings.Contains(result.Output, "hunter2") {
+		t.Fatal(result)
+	}
+	records, err := proc.AuditLog.GetLatest(10)
+	if err != nil || len(records) != 3 {
+		t.Fatal(records, err)
+	}
+	for _, record := range records {
+		if strings.Contains(record.Content, "hunter2") {
+			t.Fatal(record)
+		}
+	}
+	contents := []string{records[0].Content, records[1].Content, records[2].Content}
+	sort.Strings(contents)
+	if !reflect.DeepEqual(contents, []string{".n add wifi <hidden text>", ".n get wifi", ".n search"}) {
+		t.Fatal(contents)
+	}
 }
 
 func TestGetEmptyCommandProcessor(t *testing.T) {
@@ -197,3 +374,119 @@ func TestGetEmptyCommandProcessor(t *testing.T) {
 		t.Fatal("did not error")
 	}
 }
+
+func TestCommandProcessorPINAndTOTP(t *testing.T) {
+	proc := GetTestCommandProcessor()
+	totp := &filter.TOTP{Secret: "iuu3xchz3ftf6hdh"}
+	totp.Initialise()
+	proc.CommandFilters = []filter.CommandFilter{
+		&filter.PINAndShortcuts{PIN: "verysecret", Shortcuts: map[string]string{"sayhi": ".s echo hi"}},
+		totp,
+	}
+	_, code, _, err := toolbox.GetTwoFACodes(totp.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both PIN and code are required
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "verysecret .s echo hi"}); result.Error != filter.ErrTOTPNotFound {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "verysecret " + code + " .s echo hi"}); result.Error != nil || !strings.Contains(result.Output, "hi") {
+		t.Fatal(result)
+	}
+	// Shortcut does not carry code, hence it does not work along with one-time code
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "sayhi"}); result.Error != filter.ErrTOTPNotFound {
+		t.Fatal(result)
+	}
+}
+
+func TestCommandProcessorBan(t *testing.T) {
+	defer func(bans *misc.BanRegistry) {
+		misc.Bans = bans
+	}(misc.Bans)
+	misc.Bans = &misc.BanRegistry{MaxFailures: 2}
+	if err := misc.Bans.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc := GetTestCommandProcessor()
+	// Two failed PIN attempts get the client banned
+	for i := 0; i < 2; i++ {
+		if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "badpin.s echo hi"}); result.Error != filter.ErrPINAndShortcutNotFound {
+			t.Fatal(result)
+		}
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "verysecret.s echo hi"}); result.Error != misc.ErrBanned {
+		t.Fatal(result)
+	}
+	// Other clients are unaffected
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "b", Content: "verysecret.s echo hi"}); result.Error != nil {
+		t.Fatal(result)
+	}
+	// Client ID that may be spoofed does not get banned
+	for i := 0; i < 2; i++ {
+		proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "c", SpoofableClientID: true, Content: "badpin.s echo hi"})
+	}
+	if misc.Bans.IsBanned("c") {
+		t.Fatal("should not have banned spoofable client")
+	}
+	// Processor exempted from ban neither refuses nor records failures
+	proc.ExemptFromBan = true
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "verysecret.s echo hi"}); result.Error != nil {
+		t.Fatal(result)
+	}
+	for i := 0; i < 2; i++ {
+		proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "b", Content: "badpin.s echo hi"})
+	}
+	if misc.Bans.IsBanned("b") {
+		t.Fatal("should not have banned")
+	}
+}
+
+func TestCommandProcessorReloadViaCommand(t *testing.T) {
+	proc := GetTestCommandProcessor()
+	// The reload command replaces the processor that is processing the command itself
+	proc.Features.EnvControl.ReloadConfig = func() (string, error) {
+		proc.Reload(GetTestCommandProcessor())
+		return "reloaded", nil
+	}
+	done := make(chan *toolbox.Result, 1)
+	go func() {
+		done <- proc.Process(toolbox.Command{TimeoutSec: 10, Content: "verysecret .e reload"})
+	}()
+	select {
+	case result := <-done:
+		if result.Error != nil || result.Output != "reloaded" {
+			t.Fatal(result)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("reload command did not complete")
+	}
+	// Subsequent commands use the new configuration
+	if result := proc.Process(toolbox.Command{TimeoutSec: 10, Content: "verysecret .s echo hi"}); result.Error != nil || !strings.Contains(result.Output, "hi") {
+		t.Fatal(result)
+	}
+}
+
+func TestCommandProcessorReloadWaitsForJobs(t *testing.T) {
+	proc := GetTestCommandProcessor()
+	result := proc.Process(toolbox.Command{TimeoutSec: 10, Content: "verysecret .job .s sleep 2"})
+	if result.Error != nil {
+		t.Fatal(result)
+	}
+	beginTime := time.Now()
+	proc.Reload(GetTestCommandProcessor()).Wait()
+	if time.Since(beginTime) < 1*time.Second {
+		t.Fatal("did not wait for the job that uses previous features")
+	}
+	// Nothing uses the new features yet
+	done := make(chan struct{})
+	go func() {
+		proc.Reload(GetTestCommandProcessor()).Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("should not have waited")
+	}
+}
@@ -0,0 +1,240 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/*
+		PrefixCommandJob is the magic string to prefix command input, in order to run the command in background as a job.
+		The job ID is responded immediately. Without a command, the magic prefix lists jobs, retrieves job status and
+		output page by page, or cancels a job.
+	*/
+	PrefixCommandJob = ".job"
+
+	MaxNumJobs         = 10      // MaxNumJobs is the maximum number of jobs to keep track of in a command processor
+	JobTimeoutSec      = 30 * 60 // JobTimeoutSec is the minimum timeout given to a command running in background
+	JobOutputHeaderLen = 24      // JobOutputHeaderLen is the approximate length of job status that precedes job output
+)
+
+var (
+	// ErrBadJob reminds user of the proper syntax to manage jobs.
+	ErrBadJob = errors.New(PrefixCommandJob + " [command | ID [PAGE | cancel]]")
+	// ErrJobNotFound is returned if the requested job ID does not exist.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrTooManyJobs is returned if too many jobs are still running.
+	ErrTooManyJobs = errors.New("too many jobs are running")
+)
+
+// Job is a toolbox command that runs in background, its result is retrieved later on.
+type Job struct {
+	ID          string          // ID is a short random string that identifies the job
+	Command     toolbox.Command // Command is the job's command, its content is redacted in the same way as in log messages.
+	StartTime   time.Time       // StartTime is the moment when job was submitted
+	EndTime     time.Time       // EndTime is the moment when job finished, it is zero while job is running.
+	IsCancelled bool            // IsCancelled is true if the job is no longer wanted
+	Result      *toolbox.Result // Result is the feature execution result, it is nil while job is running.
+
+	cancel chan struct{} // cancel is closed when the job is cancelled, in order to stop the feature.
+}
+
+// IsVisibleTo returns true only if the job may be seen and managed by the PIN user. Empty user name sees all jobs.
+func (job *Job) IsVisibleTo(userName string) bool {
+	return userName == "" || job.Command.UserName == userName
+}
+
+// Status returns a short text describing job status.
+func (job *Job) Status() string {
+	switch {
+	case job.IsCancelled && job.EndTime.IsZero():
+		return fmt.Sprintf("cancelling %ds", int(time.Now().Sub(job.StartTime).Seconds()))
+	case job.IsCancelled:
+		return "cancelled"
+	case job.Result == nil:
+		return fmt.Sprintf("running %ds", int(time.Now().Sub(job.StartTime).Seconds()))
+	case job.Result.Error != nil:
+		return fmt.Sprintf("failed %ds", int(job.EndTime.Sub(job.StartTime).Seconds()))
+	default:
+		return fmt.Sprintf("done %ds", int(job.EndTime.Sub(job.StartTime).Seconds()))
+	}
+}
+
+/*
+GetOutputPage returns job status followed by a page of job output. Page number begins at 1, and each page is at most
+the specified size. Page size of 0 or less means unlimited.
+*/
+func (job *Job) GetOutputPage(pageNum, pageSize int) (string, error) {
+	if job.Result == nil || job.IsCancelled {
+		return fmt.Sprintf("%s %s", job.ID, job.Status()), nil
+	}
+	output := job.Result.CombinedOutput
+	numPages := 1
+	if pageSize > 0 && len(output) > pageSize {
+		numPages = (len(output) + pageSize - 1) / pageSize
+	}
+	if pageNum < 1 || pageNum > numPages {
+		return "", fmt.Errorf("page number must be within [1, %d]", numPages)
+	}
+	if pageSize > 0 {
+		begin := (pageNum - 1) * pageSize
+		end := begin + pageSize
+		if end > len(output) {
+			end = len(output)
+		}
+		output = output[begin:end]
+	}
+	return fmt.Sprintf("%s %s %d/%d|%s", job.ID, job.Status(), pageNum, numPages, output), nil
+}
+
+// Jobs keeps track of jobs submitted to a command processor. The zero value is ready for use.
+type Jobs struct {
+	jobs  map[string]*Job
+	mutex sync.Mutex
+}
+
+/*
+Submit runs the function in background as a job of the command. The function is given a channel that is closed when
+the job is cancelled. Return the new job, or an error if too many jobs are already running.
+*/
+func (jobs *Jobs) Submit(cmd toolbox.Command, fun func(cancel <-chan struct{}) *toolbox.Result) (*Job, error) {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	if jobs.jobs == nil {
+		jobs.jobs = make(map[string]*Job)
+	}
+	/*
+		Make room for the new job by forgetting about the oldest finished job. A cancelled job keeps its place until its
+		feature returns, so that cancellation cannot be used to run more than MaxNumJobs features at a time.
+	*/
+	if len(jobs.jobs) >= MaxNumJobs {
+		var oldest *Job
+		for _, job := range jobs.jobs {
+			if !job.EndTime.IsZero() && (oldest == nil || job.StartTime.Before(oldest.StartTime)) {
+				oldest = job
+			}
+		}
+		if oldest == nil {
+			return nil, ErrTooManyJobs
+		}
+		delete(jobs.jobs, oldest.ID)
+	}
+	// Find an unused short ID
+	var id string
+	idBytes := make([]byte, 2)
+	for {
+		if _, err := rand.Read(idBytes); err != nil {
+			return nil, err
+		}
+		if id = hex.EncodeToString(idBytes); jobs.jobs[id] == nil {
+			break
+		}
+	}
+	job := &Job{ID: id, Command: cmd, StartTime: time.Now(), cancel: make(chan struct{})}
+	jobs.jobs[id] = job
+	go func() {
+		result := fun(job.cancel)
+		jobs.mutex.Lock()
+		job.EndTime = time.Now()
+		// Output of a cancelled job is discarded
+		if !job.IsCancelled {
+			job.Result = result
+		}
+		jobs.mutex.Unlock()
+	}()
+	return job, nil
+}
+
+/*
+Cancel marks the job as cancelled and asks its feature to stop, the result of the feature will be discarded. A feature
+that does not stop early continues to run until its timeout, and the job is not forgotten while its feature is still
+running.
+*/
+func (jobs *Jobs) Cancel(userName, id string) error {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	job, exists := jobs.jobs[id]
+	if !exists || !job.IsVisibleTo(userName) {
+		return ErrJobNotFound
+	}
+	if !job.IsCancelled {
+		job.IsCancelled = true
+		close(job.cancel)
+	}
+	job.Result = nil
+	return nil
+}
+
+// List returns status of jobs visible to the user, one job per line, the latest job comes first.
+func (jobs *Jobs) List(userName string) string {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	all := make([]*Job, 0, len(jobs.jobs))
+	for _, job := range jobs.jobs {
+		if job.IsVisibleTo(userName) {
+			all = append(all, job)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].StartTime.After(all[j].StartTime)
+	})
+	var out bytes.Buffer
+	for _, job := range all {
+		out.WriteString(fmt.Sprintf("%s %s %s\n", job.ID, job.Status(), job.Command.Content))
+	}
+	return out.String()
+}
+
+// GetOutputPage returns status and a page of output of the job. See Job.GetOutputPage for page number and size.
+func (jobs *Jobs) GetOutputPage(userName, id string, pageNum, pageSize int) (string, error) {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	job, exists := jobs.jobs[id]
+	if !exists || !job.IsVisibleTo(userName) {
+		return "", ErrJobNotFound
+	}
+	return job.GetOutputPage(pageNum, pageSize)
+}
+
+/*
+Manage interprets job management parameters (the content that follows PrefixCommandJob) and carries out the action on
+behalf of the PIN user:
+- Without parameter, list jobs.
+- "ID" retrieves job status and the first page of its output.
+- "ID PAGE" retrieves job status and the page of its output.
+- "ID cancel" cancels the job.
+*/
+func (jobs *Jobs) Manage(userName, params string, pageSize int) *toolbox.Result {
+	fields := strings.Fields(params)
+	switch len(fields) {
+	case 0:
+		return &toolbox.Result{Output: jobs.List(userName)}
+	case 1:
+		out, err := jobs.GetOutputPage(userName, fields[0], 1, pageSize)
+		return &toolbox.Result{Output: out, Error: err}
+	case 2:
+		if strings.ToLower(fields[1]) == "cancel" {
+			if err := jobs.Cancel(userName, fields[0]); err != nil {
+				return &toolbox.Result{Error: err}
+			}
+			return &toolbox.Result{Output: fields[0] + " cancelled"}
+		}
+		pageNum, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return &toolbox.Result{Error: ErrBadJob}
+		}
+		out, err := jobs.GetOutputPage(userName, fields[0], pageNum, pageSize)
+		return &toolbox.Result{Output: out, Error: err}
+	default:
+		return &toolbox.Result{Error: ErrBadJob}
+	}
+}
@@ -0,0 +1,134 @@
+package common
+
+import (
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"github.com/HouzuoGuo/laitos/toolbox/filter"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandProcessorJobs(t *testing.T) {
+	features := &toolbox.FeatureSet{}
+	if err := features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc := CommandProcessor{
+		Features: features,
+		CommandFilters: []filter.CommandFilter{&filter.PINAndShortcuts{
+			PIN:   "mypin",
+			Users: []filter.PINUser{{Name: "alice", PIN: "alicepin"}},
+		}},
+		ResultFilters: []filter.ResultFilter{
+			&filter.ResetCombinedText{},
+			&filter.LintText{TrimSpaces: true, MaxLength: JobOutputHeaderLen + 5},
+		},
+	}
+	// No job yet
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job"}); result.Error != nil || result.Output != "" {
+		t.Fatal(result)
+	}
+	// Submit a job that outlives its original timeout
+	result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job .s sleep 2; echo 0123456789abc"})
+	if result.Error != nil || len(result.Output) != 4 {
+		t.Fatal(result)
+	}
+	id := result.Output
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id}); result.Error != nil || !strings.Contains(result.Output, "running") {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job"}); result.Error != nil || !strings.HasPrefix(result.Output, id+" running") {
+		t.Fatal(result)
+	}
+	// Another user cannot see the job
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "alicepin.job " + id}); result.Error != ErrJobNotFound {
+		t.Fatal(result)
+	}
+	// Retrieve output page by page after the job finishes
+	time.Sleep(3 * time.Second)
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id}); result.Error != nil ||
+		!strings.HasPrefix(result.CombinedOutput, id+" done") || !strings.HasSuffix(result.CombinedOutput, "1/3|01234") {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id + " 3"}); result.Error != nil || !strings.HasSuffix(result.CombinedOutput, "3/3|abc") {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id + " 4"}); result.Error == nil {
+		t.Fatal(result)
+	}
+	// Cancel a job to discard its result
+	result = proc.Process(toolbox.Command{TimeoutSec: 1, Content: "alicepin.job .s echo hi"})
+	if result.Error != nil {
+		t.Fatal(result)
+	}
+	id = result.Output
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "alicepin.job " + id + " cancel"}); result.Error != nil {
+		t.Fatal(result)
+	}
+	time.Sleep(1 * time.Second)
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id}); result.Error != nil || result.Output != id+" cancelled" {
+		t.Fatal(result)
+	}
+	// Cancelling a shell job kills the shell instead of letting it run till timeout
+	result = proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job .s sleep 600"})
+	if result.Error != nil {
+		t.Fatal(result)
+	}
+	id = result.Output
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id + " cancel"}); result.Error != nil {
+		t.Fatal(result)
+	}
+	time.Sleep(2 * time.Second)
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job " + id}); result.Error != nil || result.Output != id+" cancelled" {
+		t.Fatal(result)
+	}
+	// Bad syntax and unknown job
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job a b c"}); result.Error != ErrBadJob {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job nonexistent cancel"}); result.Error != ErrJobNotFound {
+		t.Fatal(result)
+	}
+	// Job still goes through feature lookup
+	if result := proc.Process(toolbox.Command{TimeoutSec: 1, Content: "mypin.job .tg"}); result.Error != ErrBadPrefix {
+		t.Fatal(result)
+	}
+}
+
+func TestJobsCancelKeepsSlot(t *testing.T) {
+	jobs := Jobs{}
+	release := make(chan struct{})
+	var cancelID string
+	for i := 0; i < MaxNumJobs; i++ {
+		job, err := jobs.Submit(toolbox.Command{}, func(<-chan struct{}) *toolbox.Result {
+			<-release
+			return &toolbox.Result{}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			cancelID = job.ID
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A cancelled job that is still running occupies its slot
+	if err := jobs.Cancel("", cancelID); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := jobs.GetOutputPage("", cancelID, 1, 0); err != nil || !strings.Contains(out, "cancelling") {
+		t.Fatal(out, err)
+	}
+	if _, err := jobs.Submit(toolbox.Command{}, func(<-chan struct{}) *toolbox.Result { return &toolbox.Result{} }); err != ErrTooManyJobs {
+		t.Fatal(err)
+	}
+	// Its slot is freed after the function returns
+	close(release)
+	time.Sleep(500 * time.Millisecond)
+	if _, err := jobs.Submit(toolbox.Command{}, func(<-chan struct{}) *toolbox.Result { return &toolbox.Result{} }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.GetOutputPage("", cancelID, 1, 0); err != ErrJobNotFound {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	MaxNumCachedOutputs = 100 // MaxNumCachedOutputs is the maximum number of callers whose last command output is memorised
+)
+
+// RegexCommandPaging matches the magic command ".more" or ".page N" that retrieves more output of the previous command.
+var RegexCommandPaging = regexp.MustCompile(`^(?i)\.(more|page\s*(\d+))$`)
+
+// ErrNoCachedOutput is returned if a caller asks for more output without having run a command recently.
+var ErrNoCachedOutput = errors.New("there is no previous command output to page through")
+
+// cachedOutput is the full output of a command and the page of output last seen by the caller.
+type cachedOutput struct {
+	output   string
+	lastPage int
+	time     time.Time
+}
+
+/*
+OutputPages memorises the full output of the last command of each caller, so that a caller may retrieve the output page
+by page without executing the command again. The zero value is ready for use.
+*/
+type OutputPages struct {
+	outputs map[string]*cachedOutput
+	mutex   sync.Mutex
+}
+
+// getCallerKey returns a string that identifies the caller of the command.
+func getCallerKey(cmd toolbox.Command) string {
+	return cmd.UserName + "@" + cmd.ClientID
+}
+
+// Memorise stores the full output of the command. The caller is considered to have seen the first page.
+func (pages *OutputPages) Memorise(cmd toolbox.Command, output string) {
+	pages.mutex.Lock()
+	defer pages.mutex.Unlock()
+	if pages.outputs == nil {
+		pages.outputs = make(map[string]*cachedOutput)
+	}
+	key := getCallerKey(cmd)
+	// Make room for a new caller by forgetting about the oldest output
+	if _, exists := pages.outputs[key]; !exists && len(pages.outputs) >= MaxNumCachedOutputs {
+		var oldestKey string
+		var oldestTime time.Time
+		for aKey, cached := range pages.outputs {
+			if oldestKey == "" || cached.time.Before(oldestTime) {
+				oldestKey = aKey
+				oldestTime = cached.time
+			}
+		}
+		delete(pages.outputs, oldestKey)
+	}
+	pages.outputs[key] = &cachedOutput{output: output, lastPage: 1, time: time.Now()}
+}
+
+/*
+GetPage returns a page of memorised output of the caller's last command. Page number begins at 1, and 0 means the page
+that follows the one last seen by the caller. Page size of 0 or less means unlimited.
+*/
+func (pages *OutputPages) GetPage(cmd toolbox.Command, pageNum, pageSize int) (string, error) {
+	pages.mutex.Lock()
+	defer pages.mutex.Unlock()
+	cached, exists := pages.outputs[getCallerKey(cmd)]
+	if !exists {
+		return "", ErrNoCachedOutput
+	}
+	if pageNum == 0 {
+		pageNum = cached.lastPage + 1
+	}
+	numPages := 1
+	if pageSize > 0 && len(cached.output) > pageSize {
+		numPages = (len(cached.output) + pageSize - 1) / pageSize
+	}
+	if pageNum < 1 || pageNum > numPages {
+		return "", fmt.Errorf("page number must be within [1, %d]", numPages)
+	}
+	cached.lastPage = pageNum
+	if pageSize <= 0 {
+		return cached.output, nil
+	}
+	begin := (pageNum - 1) * pageSize
+	end := begin + pageSize
+	if end > len(cached.output) {
+		end = len(cached.output)
+	}
+	return cached.output[begin:end], nil
+}
+
+/*
+Turn interprets the paging command and returns the requested page of caller's last command output. Return nil if the
+command is not a paging command.
+*/
+func (pages *OutputPages) Turn(cmd toolbox.Command, pageSize int) *toolbox.Result {
+	params := RegexCommandPaging.FindStringSubmatch(cmd.Content)
+	if params == nil {
+		return nil
+	}
+	pageNum := 0
+	if params[2] != "" {
+		var err error
+		if pageNum, err = strconv.Atoi(params[2]); err != nil || pageNum < 1 {
+			return &toolbox.Result{Error: errors.New("page number must be a positive integer")}
+		}
+	}
+	out, err := pages.GetPage(cmd, pageNum, pageSize)
+	return &toolbox.Result{Output: out, Error: err}
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"github.com/HouzuoGuo/laitos/toolbox/filter"
+	"testing"
+)
+
+func TestCommandProcessorPaging(t *testing.T) {
+	features := &toolbox.FeatureSet{}
+	if err := features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	proc := CommandProcessor{
+		Features:       features,
+		CommandFilters: []filter.CommandFilter{&filter.PINAndShortcuts{PIN: "mypin"}},
+		ResultFilters: []filter.ResultFilter{
+			&filter.ResetCombinedText{},
+			&filter.LintText{TrimSpaces: true, MaxLength: 5},
+		},
+	}
+	// Nothing to page through yet
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.more"}); result.Error != ErrNoCachedOutput {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.s echo 0123456789abc"}); result.CombinedOutput != "01234" {
+		t.Fatal(result)
+	}
+	// Page through the output without running the command again
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.more"}); result.Error != nil || result.CombinedOutput != "56789" {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin .MORE"}); result.Error != nil || result.CombinedOutput != "abc" {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.more"}); result.Error == nil {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.page 2"}); result.Error != nil || result.CombinedOutput != "56789" {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.page 0"}); result.Error == nil {
+		t.Fatal(result)
+	}
+	// Each caller has their own output
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "b", Content: "mypin.page 1"}); result.Error != ErrNoCachedOutput {
+		t.Fatal(result)
+	}
+	// Failed PIN entry does not affect the memorised output
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "badpin.s echo hi"}); result.Error == nil {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: "mypin.page 3"}); result.Error != nil || result.CombinedOutput != "abc" {
+		t.Fatal(result)
+	}
+	// Paging command requires PIN
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, ClientID: "a", Content: ".more"}); result.Error != filter.ErrPINAndShortcutNotFound {
+		t.Fatal(result)
+	}
+}
+
+func TestOutputPagesEviction(t *testing.T) {
+	pages := OutputPages{}
+	for i := 0; i < MaxNumCachedOutputs+1; i++ {
+		pages.Memorise(toolbox.Command{ClientID: string(rune('a' + i))}, "output")
+	}
+	if len(pages.outputs) != MaxNumCachedOutputs {
+		t.Fatal(len(pages.outputs))
+	}
+	if out, err := pages.GetPage(toolbox.Command{ClientID: string(rune('a' + MaxNumCachedOutputs))}, 1, 0); err != nil || out != "output" {
+		t.Fatal(out, err)
+	}
+}
@@ -0,0 +1,209 @@
+package dnsd
+
+import (
+	"encoding/binary"
+	"github.com/HouzuoGuo/laitos/misc"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheSize       = 10000 // DefaultCacheSize is the default maximum number of responses to keep in cache.
+	MaxCacheTTLSec         = 86400 // MaxCacheTTLSec is the maximum number of seconds to keep a response in cache, regardless of its TTL.
+	MaxNegativeCacheTTLSec = 3600  // MaxNegativeCacheTTLSec is the maximum number of seconds to keep a response of non-existent name or record in cache.
+)
+
+// CacheLookups counts the number of queries answered from cache ("hit") and those that had to be forwarded ("miss").
+var CacheLookups = misc.NewCounters()
+
+// cacheKey identifies a cached response by its question.
+type cacheKey struct {
+	name   string // name is in lower case
+	qType  uint16
+	qClass uint16
+}
+
+// getCacheKey returns the key of a message that has exactly one question.
+func getCacheKey(msg *Message) (cacheKey, bool) {
+	if len(msg.Questions) != 1 {
+		return cacheKey{}, false
+	}
+	question := msg.Questions[0]
+	return cacheKey{name: strings.ToLower(question.Name), qType: question.Type, qClass: question.Class}, true
+}
+
+// cacheEntry is a response in cache.
+type cacheEntry struct {
+	response *Message
+	cachedAt time.Time
+	expiry   time.Time
+}
+
+/*
+getCacheTTL returns the number of seconds a response may be kept in cache. A response with answers is kept for the
+shortest TTL among its records; a response of non-existent name or record is kept for the shorter of the SOA record's
+TTL and its minimum field (RFC 2308). Failure responses, and negative responses without SOA record, are not cached.
+*/
+func getCacheTTL(response *Message) (ttl uint32, cacheable bool) {
+	switch response.RCode() {
+	case RCodeNoError:
+		if len(response.Answers) > 0 {
+			ttl = MaxCacheTTLSec
+			for _, section := range [][]Resource{response.Answers, response.Authorities, response.Additionals} {
+				for _, record := range section {
+					if record.Type != TypeOPT && record.TTL < ttl {
+						ttl = record.TTL
+					}
+				}
+			}
+			return ttl, ttl > 0
+		}
+		fallthrough
+	case RCodeNXDomain:
+		for _, record := range response.Authorities {
+			if record.Type != TypeSOA || len(record.Data) < 4 {
+				continue
+			}
+			ttl = record.TTL
+			if minimum := binary.BigEndian.Uint32(record.Data[len(record.Data)-4:]); minimum < ttl {
+				ttl = minimum
+			}
+			if ttl > MaxNegativeCacheTTLSec {
+				ttl = MaxNegativeCacheTTLSec
+			}
+			return ttl, ttl > 0
+		}
+	}
+	return 0, false
+}
+
+/*
+ResponseCache keeps responses received from forwarders by their question (name, type, and class), and uses them to
+answer the same question until their TTL expires. The number of cached responses is bounded.
+*/
+type ResponseCache struct {
+	maxEntries int
+	entries    map[cacheKey]*cacheEntry
+	mutex      *sync.Mutex
+}
+
+// NewResponseCache returns an initialised cache that keeps at most the number of responses.
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[cacheKey]*cacheEntry),
+		mutex:      new(sync.Mutex),
+	}
+}
+
+// Len returns the number of responses in cache, including those that have expired but are not yet removed.
+func (cache *ResponseCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return len(cache.entries)
+}
+
+/*
+Store places the response packet (without TCP length prefix) in cache, if the response matches the query and it is
+cacheable.
+*/
+func (cache *ResponseCache) Store(query *Message, responsePacket []byte) {
+	key, ok := getCacheKey(query)
+	if !ok {
+		return
+	}
+	response, err := ParseMessage(responsePacket)
+	if err != nil || !response.IsResponse() || response.ID != query.ID || response.Flags&FlagTruncated != 0 {
+		return
+	}
+	if responseKey, ok := getCacheKey(response); !ok || responseKey != key {
+		return
+	}
+	ttl, cacheable := getCacheTTL(response)
+	if !cacheable {
+		return
+	}
+	now := time.Now()
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if _, exists := cache.entries[key]; !exists && len(cache.entries) >= cache.maxEntries {
+		// Make room by removing expired responses, or an arbitrary response if none has expired.
+		for existingKey, entry := range cache.entries {
+			if now.After(entry.expiry) {
+				delete(cache.entries, existingKey)
+			}
+		}
+		for existingKey := range cache.entries {
+			if len(cache.entries) < cache.maxEntries {
+				break
+			}
+			delete(cache.entries, existingKey)
+		}
+	}
+	cache.entries[key] = &cacheEntry{response: response, cachedAt: now, expiry: now.Add(time.Duration(ttl) * time.Second)}
+}
+
+/*
+Lookup returns a response packet (without TCP length prefix) to the query from cache, or nil if there is no unexpired
+response to the query. The response carries query's transaction ID and questions, and the TTL of its records are
+reduced by the time spent in cache.
+*/
+func (cache *ResponseCache) Lookup(query *Message) []byte {
+	key, ok := getCacheKey(query)
+	if !ok {
+		CacheLookups.Increase("miss")
+		return nil
+	}
+	now := time.Now()
+	cache.mutex.Lock()
+	entry, found := cache.entries[key]
+	if found && now.After(entry.expiry) {
+		delete(cache.entries, key)
+		found = false
+	}
+	cache.mutex.Unlock()
+	if !found {
+		CacheLookups.Increase("miss")
+		return nil
+	}
+	elapsedSec := uint32(now.Sub(entry.cachedAt) / time.Second)
+	queryHasOPT := false
+	for _, record := range query.Additionals {
+		if record.Type == TypeOPT {
+			queryHasOPT = true
+		}
+	}
+	// Cached records are shared among lookups, hence they are copied before modification.
+	adjustTTL := func(records []Resource) []Resource {
+		ret := make([]Resource, 0, len(records))
+		for _, record := range records {
+			if record.Type == TypeOPT {
+				if !queryHasOPT {
+					continue
+				}
+			} else if record.TTL > elapsedSec {
+				record.TTL -= elapsedSec
+			} else {
+				record.TTL = 0
+			}
+			ret = append(ret, record)
+		}
+		return ret
+	}
+	response := &Message{
+		ID:          query.ID,
+		Flags:       entry.response.Flags&^FlagRecursionDesired | query.Flags&FlagRecursionDesired,
+		Questions:   query.Questions,
+		Answers:     adjustTTL(entry.response.Answers),
+		Authorities: adjustTTL(entry.response.Authorities),
+		Additionals: adjustTTL(entry.response.Additionals),
+	}
+	packet, err := response.Pack()
+	if err != nil {
+		CacheLookups.Increase("miss")
+		return nil
+	}
+	CacheLookups.Increase("hit")
+	return packet
+}
@@ -0,0 +1,126 @@
+package dnsd
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// packResponse returns the packet of a response to the query with the response code and records.
+func packResponse(t *testing.T, query *Message, rcode uint16, answers, authorities []Resource) []byte {
+	response := query.Reply(rcode)
+	response.Answers = answers
+	response.Authorities = authorities
+	packet, err := response.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+// newSOAResource returns an SOA record with the TTL and minimum field.
+func newSOAResource(t *testing.T, name string, ttl, minimum uint32) Resource {
+	data, err := appendName(nil, "ns."+name)
+	if err == nil {
+		data, err = appendName(data, "admin."+name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers [20]byte
+	binary.BigEndian.PutUint32(numbers[16:], minimum)
+	return Resource{Name: name, Type: TypeSOA, Class: ClassIN, TTL: ttl, Data: append(data, numbers[:]...)}
+}
+
+func TestResponseCache(t *testing.T) {
+	cache := NewResponseCache(2)
+	query := &Message{ID: 1, Flags: FlagRecursionDesired, Questions: []Question{{Name: "example.com", Type: TypeA, Class: ClassIN}}}
+	if cache.Lookup(query) != nil {
+		t.Fatal("should not have hit")
+	}
+	answers := []Resource{
+		NewAddressResource("example.com", 300, net.IPv4(1, 2, 3, 4)),
+		NewAddressResource("example.com", 200, net.IPv4(1, 2, 3, 5)),
+	}
+	// Responses that do not match the query or are truncated are not cached
+	mismatched := *query
+	mismatched.ID = 2
+	cache.Store(query, packResponse(t, &mismatched, RCodeNoError, answers, nil))
+	mismatched = *query
+	mismatched.Questions = []Question{{Name: "example.org", Type: TypeA, Class: ClassIN}}
+	cache.Store(query, packResponse(t, &mismatched, RCodeNoError, answers, nil))
+	truncated := query.Reply(RCodeNoError)
+	truncated.Flags |= FlagTruncated
+	truncatedPacket, _ := truncated.Pack()
+	cache.Store(query, truncatedPacket)
+	cache.Store(query, packResponse(t, query, RCodeServFail, nil, nil))
+	cache.Store(query, []byte{1, 2, 3})
+	if cache.Len() != 0 {
+		t.Fatal(cache.Len())
+	}
+	// Answer from cache carries the ID and question of the new query
+	cache.Store(query, packResponse(t, query, RCodeNoError, answers, nil))
+	beforeHits := CacheLookups.Get()["hit"]
+	newQuery := &Message{ID: 9, Questions: []Question{{Name: "ExAmple.COM", Type: TypeA, Class: ClassIN}}}
+	packet := cache.Lookup(newQuery)
+	response, err := ParseMessage(packet)
+	if err != nil || response.ID != 9 || response.Questions[0].Name != "ExAmple.COM" || response.Flags&FlagRecursionDesired != 0 ||
+		len(response.Answers) != 2 || response.Answers[0].TTL != 300 || response.Answers[1].TTL != 200 {
+		t.Fatalf("%+v %v", response, err)
+	}
+	if hits := CacheLookups.Get()["hit"]; hits != beforeHits+1 {
+		t.Fatal(hits, beforeHits)
+	}
+	// Response expires according to the shortest TTL
+	key, _ := getCacheKey(query)
+	if expiry := cache.entries[key].expiry; expiry.Sub(cache.entries[key].cachedAt) != 200*time.Second {
+		t.Fatal(expiry)
+	}
+	// TTL is reduced by the time spent in cache
+	cache.entries[key].cachedAt = time.Now().Add(-50 * time.Second)
+	if response, err := ParseMessage(cache.Lookup(query)); err != nil || response.Answers[0].TTL != 250 || response.Answers[1].TTL != 150 {
+		t.Fatalf("%+v %v", response, err)
+	}
+	// Different type is a different question
+	aaaaQuery := &Message{ID: 1, Questions: []Question{{Name: "example.com", Type: TypeAAAA, Class: ClassIN}}}
+	if cache.Lookup(aaaaQuery) != nil {
+		t.Fatal("should not have hit")
+	}
+	cache.entries[key].expiry = time.Now().Add(-1 * time.Second)
+	if cache.Lookup(query) != nil || cache.Len() != 0 {
+		t.Fatal("did not expire")
+	}
+}
+
+func TestResponseCache_Negative(t *testing.T) {
+	cache := NewResponseCache(2)
+	query := &Message{ID: 1, Questions: []Question{{Name: "nothing.example.com", Type: TypeA, Class: ClassIN}}}
+	// Negative response without SOA is not cached
+	cache.Store(query, packResponse(t, query, RCodeNXDomain, nil, nil))
+	if cache.Len() != 0 {
+		t.Fatal(cache.Len())
+	}
+	// Negative response is cached for the shorter of SOA TTL and its minimum field
+	cache.Store(query, packResponse(t, query, RCodeNXDomain, nil, []Resource{newSOAResource(t, "example.com", 900, 60)}))
+	key, _ := getCacheKey(query)
+	if entry := cache.entries[key]; entry.expiry.Sub(entry.cachedAt) != 60*time.Second {
+		t.Fatal(entry.expiry)
+	}
+	if response, err := ParseMessage(cache.Lookup(query)); err != nil || response.RCode() != RCodeNXDomain || len(response.Authorities) != 1 {
+		t.Fatalf("%+v %v", response, err)
+	}
+	// Empty NOERROR response is cached too
+	mxQuery := &Message{ID: 1, Questions: []Question{{Name: "example.com", Type: TypeMX, Class: ClassIN}}}
+	cache.Store(mxQuery, packResponse(t, mxQuery, RCodeNoError, nil, []Resource{newSOAResource(t, "example.com", 30, 300)}))
+	key, _ = getCacheKey(mxQuery)
+	if entry := cache.entries[key]; entry.expiry.Sub(entry.cachedAt) != 30*time.Second {
+		t.Fatal(entry.expiry)
+	}
+	// Cache size is bounded
+	otherQuery := &Message{ID: 1, Questions: []Question{{Name: "other.example.com", Type: TypeA, Class: ClassIN}}}
+	cache.Store(otherQuery, packResponse(t, otherQuery, RCodeNoError, []Resource{NewAddressResource("other.example.com", 10, net.IPv4(1, 2, 3, 4))}, nil))
+	if cache.Len() != 2 || cache.Lookup(otherQuery) == nil {
+		t.Fatal(cache.Len())
+	}
+}
@@ -1,12 +1,13 @@
 package dnsd
 
 import (
-	"bytes"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/HouzuoGuo/laitos/inet"
 	"github.com/HouzuoGuo/laitos/misc"
+	"math/rand"
 	"net"
 	"strings"
 	"sync"
@@ -20,7 +21,6 @@ const (
 	MaxPacketSize               = 9038 // Maximum acceptable UDP packet size
 	NumQueueRatio               = 10   // Upon initialisation, create (PerIPLimit/NumQueueRatio) number of queues to handle queries.
 	BlacklistUpdateIntervalSec  = 7200 // Update ad-server blacklist at this interval
-	MinNameQuerySize            = 14   // If a query packet is shorter than this length, it cannot possibly be a name query.
 	PublicIPRefreshIntervalSec  = 900  // PublicIPRefreshIntervalSec is how often the program places its latest public IP address into array of IPs that may query the server.
 	BlacklistDownloadTimeoutSec = 30   // BlacklistDownloadTimeoutSec is the timeout to use when downloading blacklist hosts files.
 )
@@ -50,6 +50,7 @@ type UDPQuery struct {
 	MyServer    *net.UDPConn
 	ClientAddr  *net.UDPAddr
 	QueryPacket []byte
+	Query       *Message // Query is the decoded query packet, it is nil if the packet is not a name query.
 }
 
 // A query to forward to DNS forwarder via TCP.
@@ -58,21 +59,34 @@ type TCPForwarderQuery struct {
 	QueryPacket []byte
 }
 
-// A DNS forwarder daemon that selectively refuse to answer certain A record requests made against advertisement servers.
+// A DNS forwarder daemon that answers queries of advertisement and malicious domains with a black hole.
 type Daemon struct {
 	Address              string   `json:"Address"`              // Network address for both TCP and UDP to listen to, e.g. 0.0.0.0 for all network interfaces.
 	AllowQueryIPPrefixes []string `json:"AllowQueryIPPrefixes"` // AllowQueryIPPrefixes are the string prefixes in IPv4 and IPv6 client addresses that are allowed to query the DNS server.
 	PerIPLimit           int      `json:"PerIPLimit"`           // PerIPLimit is approximately how many concurrent users are expected to be using the server from same IP address
-	Forwarders           []string `json:"Forwarders"`           // DefaultForwarders are recursive DNS resolvers that will resolve name queries. They must support both TCP and UDP.
+	Forwarders           []string `json:"Forwarders"`           // Forwarders are recursive DNS resolvers: "ip:port" for plain resolvers that support both TCP and UDP, "tls://host:port" for DNS-over-TLS, and "https://host/path" for DNS-over-HTTPS.
+	BlacklistNXDomain    bool     `json:"BlacklistNXDomain"`    // BlacklistNXDomain answers NXDOMAIN, instead of an empty response, to queries of black-listed names that are not of type A or AAAA.
+	CacheSize            int      `json:"CacheSize"`            // CacheSize is the maximum number of forwarder responses to keep in cache.
 
-	UDPPort int `json:"UDPPort"` // UDP port to listen on
-	TCPPort int `json:"TCPPort"` // TCP port to listen on
+	LocalRecords []LocalRecord `json:"LocalRecords"` // LocalRecords are answered by the daemon itself, before consulting blacklist and forwarders.
+
+	UDPPort     int    `json:"UDPPort"`     // UDP port to listen on
+	TCPPort     int    `json:"TCPPort"`     // TCP port to listen on
+	TLSPort     int    `json:"TLSPort"`     // TLSPort is the port to listen on for DNS-over-TLS queries, usually 853.
+	TLSCertPath string `json:"TLSCertPath"` // TLSCertPath is the certificate file for DNS-over-TLS.
+	TLSKeyPath  string `json:"TLSKeyPath"`  // TLSKeyPath is the certificate key file for DNS-over-TLS.
 
 	tcpListener       net.Listener     // Once TCP daemon is started, this is its listener.
-	udpForwardConn    []net.Conn       // UDP connections made toward forwarder
+	tlsListener       net.Listener     // Once DNS-over-TLS daemon is started, this is its listener.
+	tlsConfig         *tls.Config      // tlsConfig carries the certificate of DNS-over-TLS listener.
+	forwarders        []Forwarder      // forwarders correspond to Forwarders, they resolve TCP queries and UDP queries alike except for plain forwarders.
+	udpForwarders     []Forwarder      // udpForwarders resolve UDP queries, each queue has its own forwarder.
 	udpForwarderQueue []chan *UDPQuery // Processing queues that handle UDP forward queries
 	udpBlackHoleQueue []chan *UDPQuery // Processing queues that handle UDP black-list answers
 	udpListener       *net.UDPConn     // Once UDP daemon is started, this is its listener.
+	cache             *ResponseCache   // cache keeps forwarder responses to answer repeated queries.
+
+	localRecords map[string][]localRecord // localRecords are the LocalRecords in wire format, keyed by their lower case names.
 
 	/*
 		blackList is a map of domain names (in lower case) and their resolved IP addresses that should be blocked. In
@@ -86,7 +100,8 @@ type Daemon struct {
 	blackListMutex       *sync.RWMutex   // Protect against concurrent access to black list
 	allowQueryMutex      *sync.Mutex     // allowQueryMutex guards against concurrent access to AllowQueryIPPrefixes.
 	allowQueryLastUpdate int64           // allowQueryLastUpdate is the Unix timestamp of the very latest automatic placement of computer's public IP into the array of AllowQueryIPPrefixes.
-	rateLimit            *misc.RateLimit // Rate limit counter
+	rateLimitTCP         *misc.RateLimit // rateLimitTCP counts queries that arrive via TCP, TLS, and HTTPS.
+	rateLimitUDP         *misc.RateLimit // rateLimitUDP counts queries that arrive via UDP.
 	logger               misc.Logger
 }
 
@@ -95,10 +110,10 @@ func (daemon *Daemon) Initialise() error {
 	if daemon.Address == "" {
 		daemon.Address = "0.0.0.0"
 	}
-	if daemon.UDPPort < 1 && daemon.TCPPort < 1 {
+	if daemon.UDPPort < 1 && daemon.TCPPort < 1 && daemon.TLSPort < 1 {
 		/*
-			If any port is left at 0, the DNS daemon will not listen for that protocol. But if both are at 0, then
-			by default listen for both protocols.
+			If any port is left at 0, the DNS daemon will not listen for that protocol. But if all are at 0, then
+			by default listen for both UDP and TCP.
 		*/
 		daemon.TCPPort = 53
 		daemon.UDPPort = 53
@@ -109,7 +124,20 @@ func (daemon *Daemon) Initialise() error {
 	if daemon.Forwarders == nil || len(daemon.Forwarders) == 0 {
 		daemon.Forwarders = DefaultForwarders
 	}
+	if daemon.CacheSize < 1 {
+		daemon.CacheSize = DefaultCacheSize
+	}
 	daemon.logger = misc.Logger{ComponentName: "DNSD", ComponentID: fmt.Sprintf("%s-%d&%d", daemon.Address, daemon.TCPPort, daemon.UDPPort)}
+	if daemon.TLSPort > 0 {
+		if daemon.TLSCertPath == "" || daemon.TLSKeyPath == "" {
+			return errors.New("DNSD.Initialise: TLS certificate or key path is missing")
+		}
+		tlsCert, err := tls.LoadX509KeyPair(daemon.TLSCertPath, daemon.TLSKeyPath)
+		if err != nil {
+			return fmt.Errorf("DNSD.Initialise: failed to read TLS certificate - %v", err)
+		}
+		daemon.tlsConfig = &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	}
 	if daemon.AllowQueryIPPrefixes == nil || len(daemon.AllowQueryIPPrefixes) == 0 {
 		return errors.New("DNSD.Initialise: allowable IP prefixes list must not be empty")
 	}
@@ -124,13 +152,35 @@ func (daemon *Daemon) Initialise() error {
 	daemon.allowQueryMutex = new(sync.Mutex)
 	daemon.blackListMutex = new(sync.RWMutex)
 	daemon.blackList = make(map[string]struct{})
+	daemon.cache = NewResponseCache(daemon.CacheSize)
+	localRecords, err := newLocalRecords(daemon.LocalRecords)
+	if err != nil {
+		return fmt.Errorf("DNSD.Initialise: %v", err)
+	}
+	daemon.localRecords = localRecords
 
-	daemon.rateLimit = &misc.RateLimit{
+	daemon.rateLimitTCP = &misc.RateLimit{
 		MaxCount: daemon.PerIPLimit,
 		UnitSecs: RateLimitIntervalSec,
 		Logger:   daemon.logger,
 	}
-	daemon.rateLimit.Initialise()
+	daemon.rateLimitTCP.Initialise()
+	// UDP queries may carry spoofed client IP, hence the rate limit does not ban.
+	daemon.rateLimitUDP = &misc.RateLimit{
+		MaxCount:      daemon.PerIPLimit,
+		UnitSecs:      RateLimitIntervalSec,
+		Logger:        daemon.logger,
+		ExemptFromBan: true,
+	}
+	daemon.rateLimitUDP.Initialise()
+	daemon.forwarders = make([]Forwarder, len(daemon.Forwarders))
+	for i, address := range daemon.Forwarders {
+		forwarder, err := NewForwarder(address)
+		if err != nil {
+			return fmt.Errorf("DNSD.Initialise: %v", err)
+		}
+		daemon.forwarders[i] = forwarder
+	}
 	// Create a number of forwarder queues to handle incoming UDP DNS queries
 	// Keep in mind, TCP queries are not handled by queues.
 	if daemon.UDPPort > 0 {
@@ -139,23 +189,26 @@ func (daemon *Daemon) Initialise() error {
 		if numQueues < len(daemon.Forwarders) {
 			numQueues = len(daemon.Forwarders)
 		}
-		daemon.udpForwardConn = make([]net.Conn, numQueues)
+		daemon.udpForwarders = make([]Forwarder, numQueues)
 		daemon.udpForwarderQueue = make([]chan *UDPQuery, numQueues)
 		daemon.udpBlackHoleQueue = make([]chan *UDPQuery, numQueues)
 		for i := 0; i < numQueues; i++ {
 			/*
 				Each queue is connected to a different forwarder.
 				When a DNS query comes in, it is assigned a random forwarder to be processed.
+				Queues share encrypted forwarders, which pool and pipeline their connections. Their responses are not
+				limited in size, hence they are truncated to the client's UDP buffer size before being sent.
 			*/
-			forwarderAddr, err := net.ResolveUDPAddr("udp", daemon.Forwarders[i%len(daemon.Forwarders)])
-			if err != nil {
-				return fmt.Errorf("DNSD.Initialise: failed to resolve UDP address - %v", err)
-			}
-			forwarderConn, err := net.DialTimeout("udp", forwarderAddr.String(), IOTimeoutSec*time.Second)
-			if err != nil {
-				return fmt.Errorf("DNSD.Initialise: failed to connect to UDP forwarder - %v", err)
+			forwarderIndex := i % len(daemon.Forwarders)
+			if _, isPlain := daemon.forwarders[forwarderIndex].(*TCPForwarder); isPlain {
+				udpForwarder, err := NewUDPForwarder(daemon.Forwarders[forwarderIndex])
+				if err != nil {
+					return fmt.Errorf("DNSD.Initialise: %v", err)
+				}
+				daemon.udpForwarders[i] = udpForwarder
+			} else {
+				daemon.udpForwarders[i] = daemon.forwarders[forwarderIndex]
 			}
-			daemon.udpForwardConn[i] = forwarderConn
 			daemon.udpForwarderQueue[i] = make(chan *UDPQuery, 16) // there really is no need for a deeper queue
 			daemon.udpBlackHoleQueue[i] = make(chan *UDPQuery, 4)  // there is also no need for a deeper queue here
 		}
@@ -212,6 +265,69 @@ func (daemon *Daemon) checkAllowClientIP(clientIP string) bool {
 	return false
 }
 
+/*
+AllowQuery returns true only if the client IP is among the allowed addresses and it has not exceeded rate limit. Every
+call counts as one query towards the rate limit. It is meant for queries that arrive via TCP, TLS, and HTTPS, whose
+client IP is verified by the connection, hence exceeding the rate limit counts as a failure in the ban registry.
+*/
+func (daemon *Daemon) AllowQuery(clientIP string) bool {
+	return daemon.allowQuery(clientIP, daemon.rateLimitTCP)
+}
+
+/*
+allowUDPQuery returns true only if the client IP is among the allowed addresses and it has not exceeded rate limit.
+UDP client IP may be spoofed, hence exceeding the rate limit does not count as a failure in the ban registry.
+*/
+func (daemon *Daemon) allowUDPQuery(clientIP string) bool {
+	return daemon.allowQuery(clientIP, daemon.rateLimitUDP)
+}
+
+// allowQuery returns true only if the client IP is among the allowed addresses and it has not exceeded the rate limit.
+func (daemon *Daemon) allowQuery(clientIP string, rateLimit *misc.RateLimit) bool {
+	if !rateLimit.Add(clientIP, true) {
+		return false
+	}
+	if !daemon.checkAllowClientIP(clientIP) {
+		daemon.logger.Warning("AllowQuery", clientIP, nil, "client IP is not allowed to query")
+		return false
+	}
+	return true
+}
+
+/*
+Resolve answers a query packet (without TCP length prefix) that arrived via the protocol ("tcp", "tls", or "https").
+Queries of names that have local records are answered locally, queries of black-listed names are answered with black
+hole, and other queries are answered from cache or by a randomly chosen forwarder. Caller should check the client against AllowQuery beforehand.
+*/
+func (daemon *Daemon) Resolve(clientIP, protocol string, queryPacket []byte) ([]byte, error) {
+	query, domainName := ParseNameQuery(queryPacket)
+	if domainName == "" {
+		// If I cannot figure out what domain is from the query, simply forward it without much concern.
+		daemon.logger.Info("Resolve", clientIP, nil, "handle %s non-name query", protocol)
+	} else if response := daemon.RespondLocally(clientIP, query); response != nil {
+		daemon.logger.Info("Resolve", clientIP, nil, "handle %s domain \"%s\" from local records", protocol, domainName)
+		return response, nil
+	} else if daemon.IsInBlacklist(domainName) {
+		daemon.logger.Info("Resolve", clientIP, nil, "handle %s black-listed domain \"%s\"", protocol, domainName)
+		BlacklistHits.Increase(protocol)
+		return RespondWithBlackHole(query, daemon.BlacklistNXDomain)
+	} else if response := daemon.cache.Lookup(query); response != nil {
+		daemon.logger.Info("Resolve", clientIP, nil, "handle %s domain \"%s\" from cache", protocol, domainName)
+		return response, nil
+	} else {
+		daemon.logger.Info("Resolve", clientIP, nil, "handle %s domain \"%s\"", protocol, domainName)
+	}
+	// Ask a randomly chosen forwarder to process the query
+	response, err := daemon.forwarders[rand.Intn(len(daemon.forwarders))].Exchange(queryPacket)
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		daemon.cache.Store(query, response)
+	}
+	return response, nil
+}
+
 /*
 UpdateBlackList downloads the latest blacklist files from PGL and MVPS, resolves the IP addresses of each domain,
 and stores the latest blacklist names and IP addresses into blacklist map.
@@ -274,25 +390,32 @@ func (daemon *Daemon) UpdateBlackList() {
 
 /*
 You may call this function only after having called Initialise()!
-Start DNS daemon on configured TCP and UDP ports. Block caller until both listeners are told to stop.
-If either TCP or UDP port fails to listen, all listeners are closed and an error is returned.
+KeepUpdatingBlackList updates ad-block black list right away, and then periodically until the stop channel receives a
+value. Caller is blocked throughout. A nil stop channel keeps the updates going for the lifetime of the program.
+*/
+func (daemon *Daemon) KeepUpdatingBlackList(stop <-chan bool) {
+	daemon.UpdateBlackList()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(BlacklistUpdateIntervalSec * time.Second):
+			daemon.UpdateBlackList()
+		}
+	}
+}
+
+/*
+You may call this function only after having called Initialise()!
+Start DNS daemon on configured TCP, UDP, and DNS-over-TLS ports. Block caller until all listeners are told to stop.
+If any port fails to listen, all listeners are closed and an error is returned.
 */
 func (daemon *Daemon) StartAndBlock() error {
 	// Keep updating ad-block black list in background
-	stopAdBlockUpdater := make(chan bool, 1)
-	go func() {
-		daemon.UpdateBlackList()
-		for {
-			select {
-			case <-stopAdBlockUpdater:
-				return
-			case <-time.After(BlacklistUpdateIntervalSec * time.Second):
-				daemon.UpdateBlackList()
-			}
-		}
-	}()
+	stopAdBlockUpdater := make(chan bool, 3)
+	go daemon.KeepUpdatingBlackList(stopAdBlockUpdater)
 	numListeners := 0
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 3)
 	if daemon.UDPPort != 0 {
 		numListeners++
 		go func() {
@@ -309,6 +432,14 @@ func (daemon *Daemon) StartAndBlock() error {
 			stopAdBlockUpdater <- true
 		}()
 	}
+	if daemon.TLSPort != 0 {
+		numListeners++
+		go func() {
+			err := daemon.StartAndBlockTLS()
+			errChan <- err
+			stopAdBlockUpdater <- true
+		}()
+	}
 	for i := 0; i < numListeners; i++ {
 		if err := <-errChan; err != nil {
 			daemon.Stop()
@@ -318,13 +449,18 @@ func (daemon *Daemon) StartAndBlock() error {
 	return nil
 }
 
-// Close all of open TCP and UDP listeners so that they will cease processing incoming connections.
+// Close all of open TCP, UDP, and DNS-over-TLS listeners so that they will cease processing incoming connections.
 func (daemon *Daemon) Stop() {
 	if listener := daemon.tcpListener; listener != nil {
 		if err := listener.Close(); err != nil {
 			daemon.logger.Warning("Stop", "", err, "failed to close TCP listener")
 		}
 	}
+	if listener := daemon.tlsListener; listener != nil {
+		if err := listener.Close(); err != nil {
+			daemon.logger.Warning("Stop", "", err, "failed to close TLS listener")
+		}
+	}
 	if listener := daemon.udpListener; listener != nil {
 		if err := listener.Close(); err != nil {
 			daemon.logger.Warning("Stop", "", err, "failed to close UDP listener")
@@ -369,65 +505,46 @@ func (daemon *Daemon) IsInBlacklist(nameOrIPs ...string) bool {
 	return false
 }
 
-var StandardResponseNoError = []byte{129, 128} // DNS response packet flag - standard response, no indication of error.
-
-//                            Domain     A    IN      TTL 1466  IPv4     0.0.0.0
-var BlackHoleAnswer = []byte{192, 12, 0, 1, 0, 1, 0, 0, 5, 186, 0, 4, 0, 0, 0, 0} // DNS answer 0.0.0.0
-
-// Create a DNS response packet without prefix length bytes, that points incoming query to 0.0.0.0.
-func RespondWith0(queryNoLength []byte) []byte {
-	if queryNoLength == nil || len(queryNoLength) < MinNameQuerySize {
-		return []byte{}
-	}
-	answerPacket := make([]byte, 2+2+len(queryNoLength)-4+len(BlackHoleAnswer))
-	// Match transaction ID of original query
-	answerPacket[0] = queryNoLength[0]
-	answerPacket[1] = queryNoLength[1]
-	// 0x8180 - response is a standard query response, without indication of error.
-	copy(answerPacket[2:4], StandardResponseNoError)
-	// Copy of original query structure
-	copy(answerPacket[4:], queryNoLength[4:])
-	// There is exactly one answer RR
-	answerPacket[6] = 0
-	answerPacket[7] = 1
-	// Answer 0.0.0.0 to the query
-	copy(answerPacket[len(answerPacket)-len(BlackHoleAnswer):], BlackHoleAnswer)
-	// Finally, respond!
-	return answerPacket
-}
+// BlacklistHits counts the number of queries answered with black hole, by protocol "tcp", "udp", "tls", and "https".
+var BlacklistHits = misc.NewCounters()
+
+const BlackHoleTTL = 1466 // BlackHoleTTL is the TTL of the addresses answered to queries of black-listed names.
+
+// BlackHoleAnswer is the answer record (name pointer, A, IN, TTL 1466, 0.0.0.0) to an A query of a black-listed name.
+var BlackHoleAnswer = []byte{192, 12, 0, 1, 0, 1, 0, 0, 5, 186, 0, 4, 0, 0, 0, 0}
 
 /*
-ExtractDomainName extracts domain name requested by input query packet. If the function fails to determine the requested
-name, it returns an empty string.
+RespondWithBlackHole creates a response packet (without TCP length prefix) to the query of a black-listed name. A and
+AAAA queries are answered with 0.0.0.0 and :: respectively; queries of other types are answered with NXDOMAIN if
+nxDomain is true, or otherwise with an empty NOERROR response.
 */
-func ExtractDomainName(packet []byte) string {
-	if packet == nil || len(packet) < MinNameQuerySize {
-		return ""
-	}
-	indexTypeAClassIN := bytes.Index(packet[13:], []byte{0, 1, 0, 1})
-	if indexTypeAClassIN < 1 {
-		return ""
-	}
-	indexTypeAClassIN += 13
-	// The byte right before Type-A Class-IN is an empty byte to be discarded
-	domainNameBytes := make([]byte, indexTypeAClassIN-13-1)
-	copy(domainNameBytes, packet[13:indexTypeAClassIN-1])
-	/*
-		Restore full-stops of the domain name portion so that it can be checked against black list.
-		Not sure why those byte ranges show up in place of full-stops, probably due to some RFCs.
-	*/
-	for i, b := range domainNameBytes {
-		if b <= 44 || b >= 58 && b <= 64 || b >= 91 && b <= 96 {
-			domainNameBytes[i] = '.'
+func RespondWithBlackHole(query *Message, nxDomain bool) ([]byte, error) {
+	response := query.Reply(RCodeNoError)
+	for _, question := range query.Questions {
+		switch question.Type {
+		case TypeA:
+			response.Answers = append(response.Answers, NewAddressResource(question.Name, BlackHoleTTL, net.IPv4zero))
+		case TypeAAAA:
+			response.Answers = append(response.Answers, NewAddressResource(question.Name, BlackHoleTTL, net.IPv6zero))
+		default:
+			if nxDomain {
+				response.Flags |= RCodeNXDomain
+			}
 		}
 	}
-	// Convert the name to lower case because sometimes device queries names in mixed case
-	domainName := strings.ToLower(strings.TrimSpace(string(domainNameBytes)))
-	if len(domainName) > 1024 {
-		// Domain name is unrealistically long
-		return ""
+	return response.Pack()
+}
+
+/*
+ParseNameQuery decodes the query packet (without TCP length prefix) and returns the query along with the queried name
+in lower case. If the packet is not a standard query that asks for a name, the returned query is nil.
+*/
+func ParseNameQuery(packet []byte) (*Message, string) {
+	query, err := ParseMessage(packet)
+	if err != nil || query.IsResponse() || query.Opcode() != 0 || len(query.Questions) == 0 || query.Name() == "" {
+		return nil, ""
 	}
-	return domainName
+	return query, query.Name()
 }
 
 var GithubComTCPQuery, GithubComUDPQuery []byte // Sample queries for composing test cases
@@ -1,38 +1,77 @@
 package dnsd
 
 import (
+	"bytes"
 	"encoding/hex"
+	"github.com/HouzuoGuo/laitos/misc"
+	"net"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 )
 
-func TestExtractDomainName(t *testing.T) {
-	if name := ExtractDomainName(nil); name != "" {
-		t.Fatal(name)
+func TestParseNameQuery(t *testing.T) {
+	if query, name := ParseNameQuery(nil); query != nil || name != "" {
+		t.Fatal(query, name)
 	}
-	if name := ExtractDomainName([]byte{}); name != "" {
-		t.Fatal(name)
+	if query, name := ParseNameQuery([]byte{}); query != nil || name != "" {
+		t.Fatal(query, name)
 	}
-	if name := ExtractDomainName(GithubComUDPQuery); name != "github.com" {
-		t.Fatal(name)
+	if query, name := ParseNameQuery(GithubComUDPQuery); query == nil || name != "github.com" {
+		t.Fatal(query, name)
+	}
+	// A response is not a query
+	response, err := (&Message{ID: 1, Flags: FlagResponse, Questions: []Question{{Name: "github.com", Type: TypeA, Class: ClassIN}}}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, name := ParseNameQuery(response); query != nil || name != "" {
+		t.Fatal(query, name)
+	}
+	// Names of all query types are found
+	for _, queryType := range []uint16{TypeA, TypeAAAA, TypeMX, TypeTXT, TypeHTTPS} {
+		packet, err := (&Message{ID: 1, Questions: []Question{{Name: "Ads-1.Example.COM", Type: queryType, Class: ClassIN}}}).Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, name := ParseNameQuery(packet); query == nil || name != "ads-1.example.com" || query.Questions[0].Type != queryType {
+			t.Fatal(queryType, query, name)
+		}
 	}
 }
 
-func TestRespondWith0(t *testing.T) {
-	if packet := RespondWith0(nil); len(packet) != 0 {
-		t.Fatal(packet)
+func TestRespondWithBlackHole(t *testing.T) {
+	query, _ := ParseNameQuery(GithubComUDPQuery)
+	match, err := hex.DecodeString("e575818000010001000000000667697468756203636f4d0000010001c00c00010001000005ba000400000000")
+	if err != nil {
+		t.Fatal(err)
 	}
-	if packet := RespondWith0([]byte{}); len(packet) != 0 {
-		t.Fatal(packet)
+	if packet, err := RespondWithBlackHole(query, false); err != nil || !reflect.DeepEqual(packet, match) || bytes.Index(packet, BlackHoleAnswer) == -1 {
+		t.Fatal(hex.EncodeToString(packet), err)
 	}
-	match, err := hex.DecodeString("e575818000010001000000010667697468756203636f4d00000100010000291000000000000000c00c00010001000005ba000400000000")
+	// AAAA query is answered with ::
+	query.Questions[0].Type = TypeAAAA
+	packet, err := RespondWithBlackHole(query, true)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if packet := RespondWith0(GithubComUDPQuery); !reflect.DeepEqual(packet, match) {
-		t.Fatal(hex.EncodeToString(packet))
+	response, err := ParseMessage(packet)
+	if err != nil || response.ID != query.ID || response.RCode() != RCodeNoError || len(response.Answers) != 1 ||
+		response.Answers[0].Type != TypeAAAA || !net.IP(response.Answers[0].Data).Equal(net.IPv6zero) {
+		t.Fatalf("%+v %v", response, err)
+	}
+	// Other types are answered with an empty response or NXDOMAIN
+	query.Questions[0].Type = TypeHTTPS
+	for _, nxDomain := range []bool{false, true} {
+		packet, err := RespondWithBlackHole(query, nxDomain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := ParseMessage(packet)
+		if err != nil || len(response.Answers) != 0 || !response.IsResponse() || (response.RCode() == RCodeNXDomain) != nxDomain {
+			t.Fatalf("%+v %v", response, err)
+		}
 	}
 }
 
@@ -83,3 +122,34 @@ func TestDNSD(t *testing.T) {
 	time.Sleep(RateLimitIntervalSec * time.Second)
 	TestTCPQueries(&daemon, t)
 }
+
+func TestDNSD_RateLimitBan(t *testing.T) {
+	defer func(bans *misc.BanRegistry) {
+		misc.Bans = bans
+	}(misc.Bans)
+	misc.Bans = &misc.BanRegistry{MaxFailures: 1}
+	if err := misc.Bans.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	daemon := &Daemon{
+		Address:              "127.0.0.1",
+		AllowQueryIPPrefixes: []string{"192."},
+		Forwarders:           []string{"127.0.0.1:53"},
+		TCPPort:              45120,
+		PerIPLimit:           1,
+	}
+	if err := daemon.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		daemon.AllowQuery("192.0.2.1")
+		daemon.allowUDPQuery("192.0.2.2")
+	}
+	// Client of TCP, TLS, and HTTPS gets banned for exceeding the rate limit, whereas UDP client IP may be spoofed.
+	if !misc.Bans.IsBanned("192.0.2.1") {
+		t.Fatal("did not ban TCP client")
+	}
+	if misc.Bans.IsBanned("192.0.2.2") {
+		t.Fatal("should not have banned UDP client")
+	}
+}
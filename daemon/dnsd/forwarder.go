@@ -0,0 +1,368 @@
+package dnsd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TLSForwarderPort     = "853" // TLSForwarderPort is the default port number of DNS-over-TLS forwarder.
+	TLSForwarderMaxConns = 4     // TLSForwarderMaxConns is the maximum number of connections to keep open toward a DNS-over-TLS forwarder.
+	HTTPSForwarderType   = "application/dns-message"
+	MaxTCPMessageSize    = 65535 // MaxTCPMessageSize is the maximum size of DNS message carried by TCP, TLS, or HTTPS.
+)
+
+var errForwarderConnClosed = errors.New("connection to forwarder is closed")
+
+/*
+Forwarder sends a query to a recursive resolver and returns its response. The query and response are in wire format
+without TCP length prefix, and the response carries the query's transaction ID.
+*/
+type Forwarder interface {
+	Exchange(query []byte) ([]byte, error)
+}
+
+/*
+NewForwarder returns a forwarder according to its address: "tls://host[:port]" for a DNS-over-TLS resolver,
+"https://host/path" for a DNS-over-HTTPS resolver, and "host:port" for a plain resolver that is queried over TCP.
+*/
+func NewForwarder(address string) (Forwarder, error) {
+	switch {
+	case strings.HasPrefix(address, "tls://"):
+		hostPort := strings.TrimPrefix(address, "tls://")
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			hostPort = net.JoinHostPort(hostPort, TLSForwarderPort)
+		}
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("bad DNS-over-TLS forwarder address \"%s\"", address)
+		}
+		return NewTLSForwarder(hostPort), nil
+	case strings.HasPrefix(address, "https://"):
+		if parsed, err := url.Parse(address); err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("bad DNS-over-HTTPS forwarder URL \"%s\"", address)
+		}
+		return NewHTTPSForwarder(address), nil
+	default:
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("bad forwarder address \"%s\" - %v", address, err)
+		}
+		return &TCPForwarder{Address: address}, nil
+	}
+}
+
+// writeTCPMessage writes the DNS message prefixed by its length.
+func writeTCPMessage(writer io.Writer, packet []byte) error {
+	_, err := writer.Write(append([]byte{byte(len(packet) >> 8), byte(len(packet))}, packet...))
+	return err
+}
+
+/*
+readTCPMessage reads a DNS message prefixed by its length, and returns the message without the length. The message may
+be as large as the length prefix permits (MaxTCPMessageSize), such as a response that does not fit in a UDP packet.
+*/
+func readTCPMessage(reader io.Reader) ([]byte, error) {
+	lenBuf := make([]byte, 2)
+	if _, err := io.ReadFull(reader, lenBuf); err != nil {
+		return nil, err
+	}
+	packetLen := int(binary.BigEndian.Uint16(lenBuf))
+	if packetLen < HeaderSize {
+		return nil, fmt.Errorf("bad message length %d", packetLen)
+	}
+	packet := make([]byte, packetLen)
+	_, err := io.ReadFull(reader, packet)
+	return packet, err
+}
+
+// UDPForwarder exchanges queries with a plain resolver over a connected UDP socket, one query at a time.
+type UDPForwarder struct {
+	conn  net.Conn
+	buf   []byte
+	mutex *sync.Mutex
+}
+
+// NewUDPForwarder connects a UDP socket to the resolver address (host:port).
+func NewUDPForwarder(address string) (*UDPForwarder, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve UDP address - %v", err)
+	}
+	conn, err := net.DialTimeout("udp", udpAddr.String(), IOTimeoutSec*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to UDP forwarder - %v", err)
+	}
+	return &UDPForwarder{conn: conn, buf: make([]byte, MaxPacketSize), mutex: new(sync.Mutex)}, nil
+}
+
+func (fwd *UDPForwarder) Exchange(query []byte) ([]byte, error) {
+	fwd.mutex.Lock()
+	defer fwd.mutex.Unlock()
+	fwd.conn.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+	if _, err := fwd.conn.Write(query); err != nil {
+		return nil, err
+	}
+	for {
+		packetLen, err := fwd.conn.Read(fwd.buf)
+		if err != nil {
+			return nil, err
+		}
+		// Skip late responses to earlier queries that have timed out
+		if packetLen >= HeaderSize && bytes.Equal(fwd.buf[:2], query[:2]) {
+			return append([]byte{}, fwd.buf[:packetLen]...), nil
+		}
+	}
+}
+
+// TCPForwarder exchanges each query with a plain resolver over a new TCP connection.
+type TCPForwarder struct {
+	Address string // Address is the host:port of resolver.
+}
+
+func (fwd *TCPForwarder) Exchange(query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", fwd.Address, IOTimeoutSec*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+/*
+pipelinedConn sends many queries over one connection without waiting for their responses, and matches responses to
+queries by transaction ID. Queries are given connection-unique IDs, their original IDs are restored in responses.
+*/
+type pipelinedConn struct {
+	conn       net.Conn
+	writeMutex *sync.Mutex
+	mutex      *sync.Mutex            // mutex protects the fields below
+	pending    map[uint16]chan []byte // pending are the channels that wait for responses, keyed by transaction ID.
+	nextID     uint16
+	closed     bool
+}
+
+// newPipelinedConn starts receiving responses from the connection in background.
+func newPipelinedConn(conn net.Conn) *pipelinedConn {
+	pc := &pipelinedConn{
+		conn:       conn,
+		writeMutex: new(sync.Mutex),
+		mutex:      new(sync.Mutex),
+		pending:    make(map[uint16]chan []byte),
+	}
+	go pc.receive()
+	return pc
+}
+
+// receive delivers responses to waiting queries, until the connection is closed or stays idle beyond IO timeout.
+func (pc *pipelinedConn) receive() {
+	for {
+		response, err := readTCPMessage(pc.conn)
+		if err != nil {
+			pc.close()
+			return
+		}
+		id := binary.BigEndian.Uint16(response)
+		pc.mutex.Lock()
+		waiter, found := pc.pending[id]
+		delete(pc.pending, id)
+		pc.mutex.Unlock()
+		if found {
+			waiter <- response
+		}
+	}
+}
+
+// isClosed returns true if the connection can no longer be used.
+func (pc *pipelinedConn) isClosed() bool {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	return pc.closed
+}
+
+// close closes the connection and fails all queries that are waiting for responses.
+func (pc *pipelinedConn) close() {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if pc.closed {
+		return
+	}
+	pc.closed = true
+	pc.conn.Close()
+	for id, waiter := range pc.pending {
+		close(waiter)
+		delete(pc.pending, id)
+	}
+}
+
+// exchange sends the query and waits for its response.
+func (pc *pipelinedConn) exchange(query []byte) ([]byte, error) {
+	waiter := make(chan []byte, 1)
+	pc.mutex.Lock()
+	if pc.closed {
+		pc.mutex.Unlock()
+		return nil, errForwarderConnClosed
+	}
+	for {
+		pc.nextID++
+		if _, inUse := pc.pending[pc.nextID]; !inUse {
+			break
+		}
+	}
+	id := pc.nextID
+	pc.pending[id] = waiter
+	pc.mutex.Unlock()
+
+	packet := append([]byte{}, query...)
+	binary.BigEndian.PutUint16(packet, id)
+	pc.writeMutex.Lock()
+	// The deadline also keeps the connection open for receiving responses
+	pc.conn.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+	err := writeTCPMessage(pc.conn, packet)
+	pc.writeMutex.Unlock()
+	if err != nil {
+		pc.close()
+		return nil, errForwarderConnClosed
+	}
+	timer := time.NewTimer(IOTimeoutSec * time.Second)
+	defer timer.Stop()
+	select {
+	case response, ok := <-waiter:
+		if !ok {
+			return nil, errForwarderConnClosed
+		}
+		copy(response[:2], query[:2])
+		return response, nil
+	case <-timer.C:
+		pc.mutex.Lock()
+		delete(pc.pending, id)
+		pc.mutex.Unlock()
+		return nil, errors.New("timed out waiting for response from forwarder")
+	}
+}
+
+/*
+TLSForwarder exchanges queries with a DNS-over-TLS resolver (RFC 7858). It keeps a small pool of connections open, and
+pipelines concurrent queries over each connection.
+*/
+type TLSForwarder struct {
+	Address string // Address is the host:port of resolver.
+
+	tlsConfig *tls.Config
+	mutex     *sync.Mutex
+	conns     []*pipelinedConn
+	next      int
+}
+
+// NewTLSForwarder returns a forwarder that verifies the resolver's certificate against the host name in address (host:port).
+func NewTLSForwarder(address string) *TLSForwarder {
+	host, _, _ := net.SplitHostPort(address)
+	return &TLSForwarder{
+		Address:   address,
+		tlsConfig: &tls.Config{ServerName: host},
+		mutex:     new(sync.Mutex),
+		conns:     make([]*pipelinedConn, TLSForwarderMaxConns),
+	}
+}
+
+/*
+getConn returns the next connection in the pool in a round-robin fashion, the connection is established if necessary.
+Connections are established one at a time so that concurrent queries do not race to fill the same slot.
+*/
+func (fwd *TLSForwarder) getConn() (*pipelinedConn, error) {
+	fwd.mutex.Lock()
+	defer fwd.mutex.Unlock()
+	slot := fwd.next
+	fwd.next = (fwd.next + 1) % len(fwd.conns)
+	if pc := fwd.conns[slot]; pc != nil && !pc.isClosed() {
+		return pc, nil
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: IOTimeoutSec * time.Second}, "tcp", fwd.Address, fwd.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	fwd.conns[slot] = newPipelinedConn(conn)
+	return fwd.conns[slot], nil
+}
+
+func (fwd *TLSForwarder) Exchange(query []byte) ([]byte, error) {
+	if len(query) < HeaderSize {
+		return nil, ErrMessageTruncated
+	}
+	// Resolver may have closed an idle connection, in which case the query is retried once on a new connection.
+	for attempt := 0; ; attempt++ {
+		pc, err := fwd.getConn()
+		if err != nil {
+			return nil, err
+		}
+		response, err := pc.exchange(query)
+		if err != errForwarderConnClosed || attempt > 0 {
+			return response, err
+		}
+	}
+}
+
+/*
+HTTPSForwarder exchanges queries with a DNS-over-HTTPS resolver (RFC 8484). The HTTP client keeps connections open and
+multiplexes concurrent queries over HTTP/2 if the resolver supports it.
+*/
+type HTTPSForwarder struct {
+	URL string // URL is the resolver's DNS query endpoint, e.g. https://dns.example.com/dns-query.
+
+	client *http.Client
+}
+
+// NewHTTPSForwarder returns a forwarder that sends queries to the URL.
+func NewHTTPSForwarder(url string) *HTTPSForwarder {
+	return &HTTPSForwarder{
+		URL: url,
+		client: &http.Client{
+			Timeout:   IOTimeoutSec * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, ForceAttemptHTTP2: true, MaxIdleConnsPerHost: TLSForwarderMaxConns},
+		},
+	}
+}
+
+func (fwd *HTTPSForwarder) Exchange(query []byte) ([]byte, error) {
+	if len(query) < HeaderSize {
+		return nil, ErrMessageTruncated
+	}
+	// The RFC recommends transaction ID 0 to make responses friendly to HTTP caches
+	packet := append([]byte{0, 0}, query[2:]...)
+	req, err := http.NewRequest(http.MethodPost, fwd.URL, bytes.NewReader(packet))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", HTTPSForwarderType)
+	req.Header.Set("Accept", HTTPSForwarderType)
+	resp, err := fwd.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	response, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxTCPMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d from forwarder", resp.StatusCode)
+	} else if len(response) < HeaderSize || len(response) > MaxTCPMessageSize {
+		return nil, fmt.Errorf("bad response length %d from forwarder", len(response))
+	}
+	copy(response[:2], query[:2])
+	return response, nil
+}
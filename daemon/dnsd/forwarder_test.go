@@ -0,0 +1,229 @@
+package dnsd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// answerTestQuery returns a response that answers the query with address 10.0.0.1.
+func answerTestQuery(t *testing.T, packet []byte) []byte {
+	query, err := ParseMessage(packet)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	response := query.Reply(RCodeNoError)
+	response.Answers = []Resource{NewAddressResource(query.Questions[0].Name, 60, net.IPv4(10, 0, 0, 1))}
+	ret, err := response.Pack()
+	if err != nil {
+		t.Error(err)
+	}
+	return ret
+}
+
+// exchangeTestQuery sends a query of the name via the forwarder, and verifies the response.
+func exchangeTestQuery(t *testing.T, forwarder Forwarder, id uint16, name string) {
+	query, err := (&Message{ID: id, Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}}}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := forwarder.Exchange(query)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	response, err := ParseMessage(packet)
+	if err != nil || response.ID != id || response.Name() != name || len(response.Answers) != 1 || response.Answers[0].Name != name {
+		t.Errorf("%+v %v", response, err)
+	}
+}
+
+func TestNewForwarder(t *testing.T) {
+	for _, address := range []string{"1.2.3.4", "tls://", "tls://:853", "https://"} {
+		if _, err := NewForwarder(address); err == nil {
+			t.Fatal("did not error", address)
+		}
+	}
+	if forwarder, err := NewForwarder("1.2.3.4:53"); err != nil || forwarder.(*TCPForwarder).Address != "1.2.3.4:53" {
+		t.Fatal(forwarder, err)
+	}
+	if forwarder, err := NewForwarder("tls://dns.example.com"); err != nil || forwarder.(*TLSForwarder).Address != "dns.example.com:853" ||
+		forwarder.(*TLSForwarder).tlsConfig.ServerName != "dns.example.com" {
+		t.Fatal(forwarder, err)
+	}
+	if forwarder, err := NewForwarder("https://dns.example.com/dns-query"); err != nil || forwarder.(*HTTPSForwarder).URL != "https://dns.example.com/dns-query" {
+		t.Fatal(forwarder, err)
+	}
+}
+
+func TestTCPMessage(t *testing.T) {
+	// Message larger than a UDP packet is accepted
+	buf := new(bytes.Buffer)
+	large := make([]byte, MaxTCPMessageSize)
+	large[0] = 1
+	if err := writeTCPMessage(buf, large); err != nil {
+		t.Fatal(err)
+	}
+	if packet, err := readTCPMessage(buf); err != nil || !bytes.Equal(packet, large) {
+		t.Fatal(len(packet), err)
+	}
+	// Message shorter than header is refused
+	if err := writeTCPMessage(buf, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTCPMessage(buf); err == nil {
+		t.Fatal("did not error")
+	}
+}
+
+func TestPlainForwarders(t *testing.T) {
+	// UDP resolver responds to a stale query before responding to the actual query
+	udpServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpServer.Close()
+	go func() {
+		buf := make([]byte, MaxPacketSize)
+		for {
+			n, addr, err := udpServer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			response := answerTestQuery(t, buf[:n])
+			stale := append([]byte{}, response...)
+			stale[0]++
+			udpServer.WriteTo(stale, addr)
+			udpServer.WriteTo(response, addr)
+		}
+	}()
+	udpForwarder, err := NewUDPForwarder(udpServer.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchangeTestQuery(t, udpForwarder, 1000, "udp.example.com")
+	exchangeTestQuery(t, udpForwarder, 1001, "udp.example.com")
+
+	tcpServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpServer.Close()
+	go func() {
+		for {
+			conn, err := tcpServer.Accept()
+			if err != nil {
+				return
+			}
+			if query, err := readTCPMessage(conn); err == nil {
+				writeTCPMessage(conn, answerTestQuery(t, query))
+			}
+			conn.Close()
+		}
+	}()
+	exchangeTestQuery(t, &TCPForwarder{Address: tcpServer.Addr().String()}, 2000, "tcp.example.com")
+}
+
+func TestTLSForwarder(t *testing.T) {
+	// Borrow the certificate of a test HTTPS server
+	httpsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer httpsServer.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", httpsServer.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var numConns int
+	connMutex := new(sync.Mutex)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connMutex.Lock()
+			numConns++
+			connMutex.Unlock()
+			// Wait for two queries, and then respond to them in reverse order.
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					first, err := readTCPMessage(conn)
+					if err != nil {
+						return
+					}
+					second, err := readTCPMessage(conn)
+					if err != nil {
+						return
+					}
+					writeTCPMessage(conn, answerTestQuery(t, second))
+					writeTCPMessage(conn, answerTestQuery(t, first))
+				}
+			}(conn)
+		}
+	}()
+	forwarder := NewTLSForwarder(listener.Addr().String())
+	forwarder.tlsConfig = httpsServer.Client().Transport.(*http.Transport).TLSClientConfig
+	forwarder.conns = forwarder.conns[:1]
+	// Both queries are pipelined over a single connection
+	for round := 0; round < 3; round++ {
+		wg := new(sync.WaitGroup)
+		wg.Add(2)
+		for i, name := range []string{"first.example.com", "second.example.com"} {
+			go func(id uint16, name string) {
+				defer wg.Done()
+				exchangeTestQuery(t, forwarder, id, name)
+			}(uint16(3000+round*10+i), name)
+		}
+		wg.Wait()
+	}
+	connMutex.Lock()
+	if numConns != 1 {
+		t.Fatal(numConns)
+	}
+	connMutex.Unlock()
+	// Query is retried on a new connection after the connection is closed
+	forwarder.conns[0].conn.Close()
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	for _, name := range []string{"first.example.com", "second.example.com"} {
+		go func(name string) {
+			defer wg.Done()
+			exchangeTestQuery(t, forwarder, 4000, name)
+		}(name)
+	}
+	wg.Wait()
+	connMutex.Lock()
+	defer connMutex.Unlock()
+	if numConns != 2 {
+		t.Fatal(numConns)
+	}
+}
+
+func TestHTTPSForwarder(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != HTTPSForwarderType || len(query) < 2 || query[0] != 0 || query[1] != 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", HTTPSForwarderType)
+		w.Write(answerTestQuery(t, query))
+	}))
+	defer server.Close()
+	forwarder := NewHTTPSForwarder(server.URL + "/dns-query")
+	forwarder.client = server.Client()
+	exchangeTestQuery(t, forwarder, 5000, "https.example.com")
+	exchangeTestQuery(t, forwarder, 5001, "https.example.com")
+	// Bad status is an error
+	forwarder.URL = server.URL + "/dns-query?bad"
+	if _, err := forwarder.Exchange([]byte{1, 2, 3}); err == nil {
+		t.Fatal("did not error")
+	}
+}
@@ -0,0 +1,227 @@
+package dnsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLocalRecordTTL = 300 // DefaultLocalRecordTTL is the TTL of local records that do not specify their own.
+	MaxLocalCNAMEHop      = 8   // MaxLocalCNAMEHop is the maximum number of local CNAME records to follow in an answer.
+)
+
+// LocalRecordTypes are the record types that may be configured as local records, by their names.
+var LocalRecordTypes = map[string]uint16{
+	"A":     TypeA,
+	"AAAA":  TypeAAAA,
+	"CNAME": TypeCNAME,
+	"TXT":   TypeTXT,
+	"MX":    TypeMX,
+	"PTR":   TypePTR,
+}
+
+/*
+LocalRecord is a record answered by the DNS daemon itself, without consulting blacklist or forwarders. A name of form
+"*.example.com" is a wildcard that covers all names under example.com that do not have records of their own.
+*/
+type LocalRecord struct {
+	Name  string `json:"Name"`  // Name is the domain name, or an IP address for PTR record.
+	Type  string `json:"Type"`  // Type is one of A, AAAA, CNAME, TXT, MX, and PTR.
+	Value string `json:"Value"` // Value is an IP address (A, AAAA), domain name (CNAME, PTR), text (TXT), or "preference name" (MX).
+	TTL   uint32 `json:"TTL"`   // TTL is the number of seconds a client may keep the record in its cache.
+	/*
+		ClientIPPrefixes restrict the record to clients whose IP address begins with any of the prefixes. For those
+		clients, records restricted to them take precedence over the unrestricted records of the same name.
+	*/
+	ClientIPPrefixes []string `json:"ClientIPPrefixes"`
+}
+
+// localRecord is a local record in wire format.
+type localRecord struct {
+	resource         Resource
+	clientIPPrefixes []string
+}
+
+// getReverseName returns the name under in-addr.arpa or ip6.arpa of an IP address for PTR queries.
+func getReverseName(ip net.IP) string {
+	var labels []string
+	if ipv4 := ip.To4(); ipv4 != nil {
+		for i := len(ipv4) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ipv4[i])))
+		}
+		return strings.Join(labels, ".") + ".in-addr.arpa"
+	}
+	ipv6 := ip.To16()
+	for i := len(ipv6) - 1; i >= 0; i-- {
+		labels = append(labels, strconv.FormatUint(uint64(ipv6[i]&0xf), 16), strconv.FormatUint(uint64(ipv6[i]>>4), 16))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa"
+}
+
+// toResource validates the local record and returns its resource in wire format.
+func (rec LocalRecord) toResource() (Resource, error) {
+	recordType, found := LocalRecordTypes[strings.ToUpper(rec.Type)]
+	if !found {
+		return Resource{}, fmt.Errorf("record type \"%s\" is not supported", rec.Type)
+	}
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(rec.Name), "."))
+	if ip := net.ParseIP(name); ip != nil && recordType == TypePTR {
+		name = getReverseName(ip)
+	}
+	if _, err := appendName(nil, name); err != nil || name == "" {
+		return Resource{}, fmt.Errorf("name \"%s\" is malformed", rec.Name)
+	}
+	ttl := rec.TTL
+	if ttl == 0 {
+		ttl = DefaultLocalRecordTTL
+	}
+	resource := Resource{Name: name, Type: recordType, Class: ClassIN, TTL: ttl}
+	value := strings.TrimSpace(rec.Value)
+	var err error
+	switch recordType {
+	case TypeA, TypeAAAA:
+		ip := net.ParseIP(value)
+		if ip == nil || (ip.To4() != nil) != (recordType == TypeA) {
+			return Resource{}, fmt.Errorf("value \"%s\" is not an IP address of the record type", rec.Value)
+		}
+		resource.Data = NewAddressResource(name, ttl, ip).Data
+	case TypeCNAME, TypePTR:
+		resource.Data, err = appendName(nil, value)
+	case TypeMX:
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return Resource{}, fmt.Errorf("value \"%s\" must consist of preference and mail server name", rec.Value)
+		}
+		preference, convErr := strconv.ParseUint(fields[0], 10, 16)
+		if convErr != nil {
+			return Resource{}, fmt.Errorf("value \"%s\" must begin with a preference number", rec.Value)
+		}
+		resource.Data, err = appendName([]byte{byte(preference >> 8), byte(preference)}, fields[1])
+	case TypeTXT:
+		// Text is broken down into character strings of at most 255 bytes each
+		for text := value; ; {
+			chunk := text
+			if len(chunk) > 255 {
+				chunk = chunk[:255]
+			}
+			resource.Data = append(append(resource.Data, byte(len(chunk))), chunk...)
+			if text = text[len(chunk):]; text == "" {
+				break
+			}
+		}
+		if len(resource.Data) > 0xffff {
+			err = errors.New("text is too long")
+		}
+	}
+	if err != nil {
+		return Resource{}, fmt.Errorf("value \"%s\" is malformed - %v", rec.Value, err)
+	}
+	return resource, nil
+}
+
+// newLocalRecords validates local records and returns them in wire format, keyed by their lower case names.
+func newLocalRecords(records []LocalRecord) (map[string][]localRecord, error) {
+	ret := make(map[string][]localRecord)
+	for _, rec := range records {
+		resource, err := rec.toResource()
+		if err != nil {
+			return nil, fmt.Errorf("local record %s %s - %v", rec.Name, rec.Type, err)
+		}
+		for _, prefix := range rec.ClientIPPrefixes {
+			if prefix == "" {
+				return nil, fmt.Errorf("local record %s %s - client IP prefix must not be empty string", rec.Name, rec.Type)
+			}
+		}
+		ret[resource.Name] = append(ret[resource.Name], localRecord{resource: resource, clientIPPrefixes: rec.ClientIPPrefixes})
+	}
+	return ret, nil
+}
+
+/*
+findLocalRecords returns the local records of the name (in lower case) that are visible to the client. If the name does
+not have records of its own, the closest wildcard records are used.
+*/
+func (daemon *Daemon) findLocalRecords(clientIP, name string) []Resource {
+	candidates := daemon.localRecords[name]
+	for suffix := name; len(candidates) == 0; {
+		dot := strings.IndexByte(suffix, '.')
+		if dot == -1 {
+			return nil
+		}
+		suffix = suffix[dot+1:]
+		candidates = daemon.localRecords["*."+suffix]
+	}
+	// Records restricted to the client take precedence over unrestricted records
+	var unrestricted, restricted []Resource
+	for _, rec := range candidates {
+		if len(rec.clientIPPrefixes) == 0 {
+			unrestricted = append(unrestricted, rec.resource)
+			continue
+		}
+		for _, prefix := range rec.clientIPPrefixes {
+			if strings.HasPrefix(clientIP, prefix) {
+				restricted = append(restricted, rec.resource)
+				break
+			}
+		}
+	}
+	if len(restricted) > 0 {
+		return restricted
+	}
+	return unrestricted
+}
+
+/*
+RespondLocally creates an authoritative response packet (without TCP length prefix) to the query from local records
+visible to the client. If the queried name has local records but none of the queried type, the response is empty. CNAME
+records are followed to their local target records. If the name has no local records, the function returns nil.
+*/
+func (daemon *Daemon) RespondLocally(clientIP string, query *Message) []byte {
+	if len(daemon.localRecords) == 0 || query == nil || len(query.Questions) != 1 || query.Opcode() != 0 {
+		return nil
+	}
+	question := query.Questions[0]
+	if question.Class != ClassIN {
+		return nil
+	}
+	records := daemon.findLocalRecords(clientIP, query.Name())
+	if len(records) == 0 {
+		return nil
+	}
+	response := query.Reply(RCodeNoError)
+	response.Flags |= FlagAuthoritative
+	owner := question.Name
+	for hop := 0; hop < MaxLocalCNAMEHop && len(records) > 0; hop++ {
+		var cname *Resource
+		numAnswers := len(response.Answers)
+		for _, record := range records {
+			if record.Type == question.Type || question.Type == TypeANY {
+				record.Name = owner
+				response.Answers = append(response.Answers, record)
+			} else if record.Type == TypeCNAME {
+				target := record
+				cname = &target
+			}
+		}
+		if cname == nil || len(response.Answers) > numAnswers {
+			break
+		}
+		cname.Name = owner
+		response.Answers = append(response.Answers, *cname)
+		target, _, err := parseName(cname.Data, 0)
+		if err != nil {
+			break
+		}
+		owner = target
+		records = daemon.findLocalRecords(clientIP, strings.ToLower(target))
+	}
+	packet, err := response.Pack()
+	if err != nil {
+		daemon.logger.Warning("RespondLocally", clientIP, err, "failed to create response")
+		return nil
+	}
+	return packet
+}
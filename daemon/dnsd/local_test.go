@@ -0,0 +1,127 @@
+package dnsd
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestGetReverseName(t *testing.T) {
+	if name := getReverseName(net.ParseIP("192.168.1.20")); name != "20.1.168.192.in-addr.arpa" {
+		t.Fatal(name)
+	}
+	if name := getReverseName(net.ParseIP("2001:db8::1")); name != "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa" {
+		t.Fatal(name)
+	}
+}
+
+func TestNewLocalRecords(t *testing.T) {
+	for _, bad := range []LocalRecord{
+		{Name: "nas.home", Type: "SRV", Value: "whatever"},
+		{Name: "", Type: "A", Value: "192.168.1.2"},
+		{Name: "nas..home", Type: "A", Value: "192.168.1.2"},
+		{Name: "nas.home", Type: "A", Value: "::1"},
+		{Name: "nas.home", Type: "AAAA", Value: "192.168.1.2"},
+		{Name: "nas.home", Type: "CNAME", Value: "bad..name"},
+		{Name: "nas.home", Type: "MX", Value: "mail.home"},
+		{Name: "nas.home", Type: "MX", Value: "x mail.home"},
+		{Name: "nas.home", Type: "A", Value: "192.168.1.2", ClientIPPrefixes: []string{""}},
+	} {
+		if _, err := newLocalRecords([]LocalRecord{bad}); err == nil {
+			t.Fatalf("did not error: %+v", bad)
+		}
+	}
+	records, err := newLocalRecords([]LocalRecord{
+		{Name: "NAS.home.", Type: "a", Value: "192.168.1.2"},
+		{Name: "192.168.1.2", Type: "PTR", Value: "nas.home", TTL: 10},
+		{Name: "home", Type: "MX", Value: "10 mail.home"},
+		{Name: "home", Type: "TXT", Value: string(make([]byte, 300))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := records["nas.home"][0].resource; rec.Type != TypeA || rec.TTL != DefaultLocalRecordTTL || !reflect.DeepEqual(rec.Data, []byte{192, 168, 1, 2}) {
+		t.Fatalf("%+v", rec)
+	}
+	if rec := records["2.1.168.192.in-addr.arpa"][0].resource; rec.Type != TypePTR || rec.TTL != 10 || string(rec.Data) != "\x03nas\x04home\x00" {
+		t.Fatalf("%+v", rec)
+	}
+	if rec := records["home"][0].resource; rec.Type != TypeMX || string(rec.Data) != "\x00\x0a\x04mail\x04home\x00" {
+		t.Fatalf("%+v", rec)
+	}
+	if rec := records["home"][1].resource; rec.Type != TypeTXT || len(rec.Data) != 302 || rec.Data[0] != 255 || rec.Data[256] != 45 {
+		t.Fatalf("%+v", rec)
+	}
+}
+
+func TestDaemon_RespondLocally(t *testing.T) {
+	daemon := &Daemon{}
+	var err error
+	daemon.localRecords, err = newLocalRecords([]LocalRecord{
+		{Name: "nas.home", Type: "A", Value: "192.168.1.2"},
+		{Name: "nas.home", Type: "A", Value: "10.8.0.2", ClientIPPrefixes: []string{"10.8."}},
+		{Name: "nas.home", Type: "TXT", Value: "my nas"},
+		{Name: "*.home", Type: "A", Value: "192.168.1.1"},
+		{Name: "files.home", Type: "CNAME", Value: "nas.home"},
+		{Name: "www.home", Type: "CNAME", Value: "www.example.com"},
+		{Name: "vpn.home", Type: "A", Value: "10.8.0.1", ClientIPPrefixes: []string{"10.8."}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	respond := func(clientIP, name string, qType uint16) *Message {
+		packet := daemon.RespondLocally(clientIP, &Message{ID: 123, Questions: []Question{{Name: name, Type: qType, Class: ClassIN}}})
+		if packet == nil {
+			return nil
+		}
+		response, err := ParseMessage(packet)
+		if err != nil || response.ID != 123 || response.Flags&FlagAuthoritative == 0 || response.RCode() != RCodeNoError {
+			t.Fatalf("%+v %v", response, err)
+		}
+		return response
+	}
+	// Exact name, and client-specific record takes precedence over the others
+	if response := respond("192.168.1.30", "NAS.home", TypeA); len(response.Answers) != 1 || response.Answers[0].Name != "NAS.home" ||
+		!net.IP(response.Answers[0].Data).Equal(net.IPv4(192, 168, 1, 2)) {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("10.8.0.5", "nas.home", TypeA); len(response.Answers) != 1 || !net.IP(response.Answers[0].Data).Equal(net.IPv4(10, 8, 0, 2)) {
+		t.Fatalf("%+v", response)
+	}
+	// Name without record of the queried type gets an empty response
+	if response := respond("192.168.1.30", "nas.home", TypeAAAA); len(response.Answers) != 0 {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("192.168.1.30", "nas.home", TypeANY); len(response.Answers) != 2 {
+		t.Fatalf("%+v", response)
+	}
+	// Wildcard covers names that do not have records of their own
+	if response := respond("192.168.1.30", "printer.office.home", TypeA); len(response.Answers) != 1 || response.Answers[0].Name != "printer.office.home" ||
+		!net.IP(response.Answers[0].Data).Equal(net.IPv4(192, 168, 1, 1)) {
+		t.Fatalf("%+v", response)
+	}
+	// CNAME is followed to local target
+	if response := respond("192.168.1.30", "files.home", TypeA); len(response.Answers) != 2 || response.Answers[0].Type != TypeCNAME ||
+		response.Answers[1].Name != "nas.home" || response.Answers[1].Type != TypeA {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("192.168.1.30", "www.home", TypeA); len(response.Answers) != 1 || response.Answers[0].Type != TypeCNAME {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("192.168.1.30", "files.home", TypeCNAME); len(response.Answers) != 1 || response.Answers[0].Type != TypeCNAME {
+		t.Fatalf("%+v", response)
+	}
+	// Names without local records, and records restricted to other clients, are left to blacklist and forwarders
+	if response := respond("192.168.1.30", "example.com", TypeA); response != nil {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("192.168.1.30", "home", TypeA); response != nil {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("192.168.1.30", "vpn.home", TypeA); response != nil {
+		t.Fatalf("%+v", response)
+	}
+	if response := respond("10.8.0.5", "vpn.home", TypeA); len(response.Answers) != 1 {
+		t.Fatalf("%+v", response)
+	}
+}
@@ -0,0 +1,398 @@
+package dnsd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Resource record types and classes that are of interest to the DNS daemon.
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypePTR   uint16 = 12
+	TypeMX    uint16 = 15
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeSRV   uint16 = 33
+	TypeOPT   uint16 = 41
+	TypeHTTPS uint16 = 65
+	TypeANY   uint16 = 255
+	ClassIN   uint16 = 1
+)
+
+// Header flags and response codes.
+const (
+	FlagResponse           uint16 = 1 << 15
+	FlagAuthoritative      uint16 = 1 << 10
+	FlagTruncated          uint16 = 1 << 9
+	FlagRecursionDesired   uint16 = 1 << 8
+	FlagRecursionAvailable uint16 = 1 << 7
+	flagOpcodeMask         uint16 = 0xf << 11
+	flagRCodeMask          uint16 = 0xf
+
+	RCodeNoError  uint16 = 0
+	RCodeFormErr  uint16 = 1
+	RCodeServFail uint16 = 2
+	RCodeNXDomain uint16 = 3
+	RCodeRefused  uint16 = 5
+)
+
+const (
+	HeaderSize        = 12  // HeaderSize is the length of DNS message header.
+	MaxNameLen        = 255 // MaxNameLen is the maximum length of a domain name in wire format.
+	MaxLabelLen       = 63  // MaxLabelLen is the maximum length of a label in domain name.
+	MaxNamePointerHop = 32  // MaxNamePointerHop is the maximum number of compression pointers to follow in a name.
+	MinUDPPayloadSize = 512 // MinUDPPayloadSize is the size of UDP response acceptable to all clients, larger responses require EDNS.
+)
+
+var (
+	ErrMessageTruncated = errors.New("DNS message is truncated")
+	ErrBadName          = errors.New("DNS message contains a malformed name")
+)
+
+// Question is an entry in the question section of DNS message.
+type Question struct {
+	Name  string // Name is the domain name in dotted form without the trailing dot, the root domain is an empty string.
+	Type  uint16
+	Class uint16
+}
+
+// Resource is a resource record in the answer, authority, or additional section of DNS message.
+type Resource struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte // Data is the record data in wire format, domain names inside the data are never compressed.
+}
+
+// Message is a DNS query or response.
+type Message struct {
+	ID          uint16
+	Flags       uint16 // Flags are the second word of header: QR, opcode, AA, TC, RD, RA, and response code.
+	Questions   []Question
+	Answers     []Resource
+	Authorities []Resource
+	Additionals []Resource
+}
+
+// Opcode returns the kind of query, 0 is a standard query.
+func (msg *Message) Opcode() uint16 {
+	return (msg.Flags & flagOpcodeMask) >> 11
+}
+
+// RCode returns the response code.
+func (msg *Message) RCode() uint16 {
+	return msg.Flags & flagRCodeMask
+}
+
+// IsResponse returns true if the message is a response rather than a query.
+func (msg *Message) IsResponse() bool {
+	return msg.Flags&FlagResponse != 0
+}
+
+// Name returns the name in lower case of the first question, or an empty string if there is no question.
+func (msg *Message) Name() string {
+	if len(msg.Questions) == 0 {
+		return ""
+	}
+	return strings.ToLower(msg.Questions[0].Name)
+}
+
+/*
+Reply creates a response to the query with the response code. The response carries over query's ID, opcode,
+recursion-desired flag, and questions, and it indicates that recursion is available.
+*/
+func (msg *Message) Reply(rcode uint16) *Message {
+	return &Message{
+		ID:        msg.ID,
+		Flags:     FlagResponse | FlagRecursionAvailable | msg.Flags&(flagOpcodeMask|FlagRecursionDesired) | rcode&flagRCodeMask,
+		Questions: append([]Question{}, msg.Questions...),
+	}
+}
+
+/*
+MaxUDPResponseSize returns the size of UDP response acceptable to the client that sent the query, which is advertised by
+EDNS (OPT record) of the query, or 512 bytes if the query does not use EDNS.
+*/
+func (msg *Message) MaxUDPResponseSize() int {
+	size := MinUDPPayloadSize
+	if msg == nil {
+		return size
+	}
+	for _, record := range msg.Additionals {
+		if record.Type == TypeOPT && int(record.Class) > size {
+			size = int(record.Class)
+		}
+	}
+	if size > MaxPacketSize {
+		size = MaxPacketSize
+	}
+	return size
+}
+
+/*
+TruncateForUDP returns the response packet as-is if it fits in the size. Otherwise, it returns a response that carries
+only the header and question with the truncated (TC) flag set, so that the client will retry the query over TCP.
+*/
+func TruncateForUDP(response []byte, maxSize int) []byte {
+	if len(response) <= maxSize || len(response) < HeaderSize {
+		return response
+	}
+	if msg, err := ParseMessage(response); err == nil {
+		truncated := &Message{ID: msg.ID, Flags: msg.Flags | FlagTruncated, Questions: msg.Questions}
+		if packet, err := truncated.Pack(); err == nil && len(packet) <= maxSize {
+			return packet
+		}
+	}
+	// Fall back to the header alone if the response cannot be parsed
+	header := make([]byte, HeaderSize)
+	copy(header, response)
+	binary.BigEndian.PutUint16(header[2:], binary.BigEndian.Uint16(header[2:])|FlagTruncated)
+	return header
+}
+
+// parseName decodes the (possibly compressed) domain name at the offset, and returns the offset right after the name.
+func parseName(packet []byte, offset int) (name string, next int, err error) {
+	var labels []string
+	nameLen, hops := 1, 0
+	next = -1
+	for {
+		if offset >= len(packet) {
+			return "", 0, ErrMessageTruncated
+		}
+		labelLen := int(packet[offset])
+		switch labelLen & 0xc0 {
+		case 0:
+			if labelLen == 0 {
+				if next == -1 {
+					next = offset + 1
+				}
+				return strings.Join(labels, "."), next, nil
+			}
+			if offset+1+labelLen > len(packet) {
+				return "", 0, ErrMessageTruncated
+			}
+			label := packet[offset+1 : offset+1+labelLen]
+			if bytes.IndexByte(label, '.') != -1 {
+				return "", 0, ErrBadName
+			}
+			if nameLen += labelLen + 1; nameLen > MaxNameLen {
+				return "", 0, ErrBadName
+			}
+			labels = append(labels, string(label))
+			offset += 1 + labelLen
+		case 0xc0:
+			// Compression pointer refers to the remainder of name elsewhere in the message
+			if offset+2 > len(packet) {
+				return "", 0, ErrMessageTruncated
+			}
+			if next == -1 {
+				next = offset + 2
+			}
+			if hops++; hops > MaxNamePointerHop {
+				return "", 0, ErrBadName
+			}
+			offset = int(binary.BigEndian.Uint16(packet[offset:]) & 0x3fff)
+		default:
+			return "", 0, ErrBadName
+		}
+	}
+}
+
+// appendName appends the uncompressed wire format of domain name to the buffer.
+func appendName(buf []byte, name string) ([]byte, error) {
+	if name == "" || name == "." {
+		return append(buf, 0), nil
+	}
+	name = strings.TrimSuffix(name, ".")
+	if len(name)+2 > MaxNameLen {
+		return nil, ErrBadName
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > MaxLabelLen {
+			return nil, ErrBadName
+		}
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0), nil
+}
+
+/*
+decompressData returns the record data with domain names in it decompressed, so that the record may be moved into
+another message. Data of record types that do not contain names is returned as-is.
+*/
+func decompressData(packet []byte, recordType uint16, offset, end int) ([]byte, error) {
+	var fixedPrefix, numNames, fixedSuffix int
+	switch recordType {
+	case TypeNS, TypeCNAME, TypePTR:
+		numNames = 1
+	case TypeMX:
+		fixedPrefix, numNames = 2, 1
+	case TypeSRV:
+		fixedPrefix, numNames = 6, 1
+	case TypeSOA:
+		numNames, fixedSuffix = 2, 20
+	default:
+		return append([]byte{}, packet[offset:end]...), nil
+	}
+	if offset+fixedPrefix > end {
+		return nil, ErrMessageTruncated
+	}
+	data := append([]byte{}, packet[offset:offset+fixedPrefix]...)
+	offset += fixedPrefix
+	for i := 0; i < numNames; i++ {
+		name, next, err := parseName(packet[:end], offset)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = appendName(data, name); err != nil {
+			return nil, err
+		}
+		offset = next
+	}
+	if offset+fixedSuffix != end {
+		return nil, ErrMessageTruncated
+	}
+	return append(data, packet[offset:end]...), nil
+}
+
+// ParseMessage decodes a DNS message in wire format (without the TCP length prefix).
+func ParseMessage(packet []byte) (*Message, error) {
+	if len(packet) < HeaderSize {
+		return nil, ErrMessageTruncated
+	}
+	msg := &Message{
+		ID:    binary.BigEndian.Uint16(packet[0:]),
+		Flags: binary.BigEndian.Uint16(packet[2:]),
+	}
+	numQuestions := int(binary.BigEndian.Uint16(packet[4:]))
+	offset := HeaderSize
+	for i := 0; i < numQuestions; i++ {
+		name, next, err := parseName(packet, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(packet) {
+			return nil, ErrMessageTruncated
+		}
+		msg.Questions = append(msg.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(packet[next:]),
+			Class: binary.BigEndian.Uint16(packet[next+2:]),
+		})
+		offset = next + 4
+	}
+	for section, dest := range []*[]Resource{&msg.Answers, &msg.Authorities, &msg.Additionals} {
+		numRecords := int(binary.BigEndian.Uint16(packet[6+2*section:]))
+		for i := 0; i < numRecords; i++ {
+			name, next, err := parseName(packet, offset)
+			if err != nil {
+				return nil, err
+			}
+			if next+10 > len(packet) {
+				return nil, ErrMessageTruncated
+			}
+			record := Resource{
+				Name:  name,
+				Type:  binary.BigEndian.Uint16(packet[next:]),
+				Class: binary.BigEndian.Uint16(packet[next+2:]),
+				TTL:   binary.BigEndian.Uint32(packet[next+4:]),
+			}
+			dataEnd := next + 10 + int(binary.BigEndian.Uint16(packet[next+8:]))
+			if dataEnd > len(packet) {
+				return nil, ErrMessageTruncated
+			}
+			if record.Data, err = decompressData(packet, record.Type, next+10, dataEnd); err != nil {
+				return nil, err
+			}
+			*dest = append(*dest, record)
+			offset = dataEnd
+		}
+	}
+	return msg, nil
+}
+
+// messagePacker encodes a message and compresses the domain names of questions and records.
+type messagePacker struct {
+	buf   []byte
+	names map[string]int // names are the offsets of domain names (and their suffixes) that have been written
+}
+
+// name appends the domain name, the name or its suffix is replaced by a pointer if it has been written earlier.
+func (packer *messagePacker) name(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if _, err := appendName(nil, name); err != nil {
+		return err
+	}
+	for name != "" {
+		if offset, found := packer.names[strings.ToLower(name)]; found {
+			packer.buf = append(packer.buf, byte(0xc0|offset>>8), byte(offset))
+			return nil
+		}
+		if len(packer.buf) < 0x4000 {
+			packer.names[strings.ToLower(name)] = len(packer.buf)
+		}
+		label := name
+		if dot := strings.IndexByte(name, '.'); dot != -1 {
+			label, name = name[:dot], name[dot+1:]
+		} else {
+			name = ""
+		}
+		packer.buf = append(packer.buf, byte(len(label)))
+		packer.buf = append(packer.buf, label...)
+	}
+	packer.buf = append(packer.buf, 0)
+	return nil
+}
+
+// Pack encodes the message in wire format (without the TCP length prefix).
+func (msg *Message) Pack() ([]byte, error) {
+	packer := &messagePacker{buf: make([]byte, HeaderSize, 512), names: make(map[string]int)}
+	sections := [][]Resource{msg.Answers, msg.Authorities, msg.Additionals}
+	binary.BigEndian.PutUint16(packer.buf[0:], msg.ID)
+	binary.BigEndian.PutUint16(packer.buf[2:], msg.Flags)
+	binary.BigEndian.PutUint16(packer.buf[4:], uint16(len(msg.Questions)))
+	for i, section := range sections {
+		binary.BigEndian.PutUint16(packer.buf[6+2*i:], uint16(len(section)))
+	}
+	for _, question := range msg.Questions {
+		if err := packer.name(question.Name); err != nil {
+			return nil, err
+		}
+		packer.buf = append(packer.buf, byte(question.Type>>8), byte(question.Type), byte(question.Class>>8), byte(question.Class))
+	}
+	for _, section := range sections {
+		for _, record := range section {
+			if err := packer.name(record.Name); err != nil {
+				return nil, err
+			}
+			if len(record.Data) > 0xffff {
+				return nil, fmt.Errorf("data of record %s is too long", record.Name)
+			}
+			var fixed [10]byte
+			binary.BigEndian.PutUint16(fixed[0:], record.Type)
+			binary.BigEndian.PutUint16(fixed[2:], record.Class)
+			binary.BigEndian.PutUint32(fixed[4:], record.TTL)
+			binary.BigEndian.PutUint16(fixed[8:], uint16(len(record.Data)))
+			packer.buf = append(packer.buf, fixed[:]...)
+			packer.buf = append(packer.buf, record.Data...)
+		}
+	}
+	return packer.buf, nil
+}
+
+// NewAddressResource returns an A record for an IPv4 address, or an AAAA record for an IPv6 address.
+func NewAddressResource(name string, ttl uint32, ip net.IP) Resource {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return Resource{Name: name, Type: TypeA, Class: ClassIN, TTL: ttl, Data: []byte(ipv4)}
+	}
+	return Resource{Name: name, Type: TypeAAAA, Class: ClassIN, TTL: ttl, Data: []byte(ip.To16())}
+}
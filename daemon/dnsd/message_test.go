@@ -0,0 +1,94 @@
+package dnsd
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	// Bad messages
+	for _, packet := range []string{
+		"",
+		"e5750120000100000000",               // header is truncated
+		"e57501200001000000000000",           // question is missing
+		"e575012000010000000000000667697468", // name is truncated
+		"e5750120000100000000000006676974687562c00c00010001", // pointer loop
+		"e575012000010000000000000667697468756200",           // type and class are missing
+	} {
+		raw, err := hex.DecodeString(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg, err := ParseMessage(raw); err == nil {
+			t.Fatalf("%s %+v", packet, msg)
+		}
+	}
+	// A query with EDNS record
+	msg, err := ParseMessage(GithubComUDPQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 0xe575 || msg.IsResponse() || msg.Opcode() != 0 || msg.Flags&FlagRecursionDesired == 0 ||
+		!reflect.DeepEqual(msg.Questions, []Question{{Name: "github.coM", Type: TypeA, Class: ClassIN}}) ||
+		len(msg.Additionals) != 1 || msg.Additionals[0].Type != TypeOPT || msg.Name() != "github.com" {
+		t.Fatalf("%+v", msg)
+	}
+	packet, err := msg.Pack()
+	if err != nil || !reflect.DeepEqual(packet, GithubComUDPQuery) {
+		t.Fatal(hex.EncodeToString(packet), err)
+	}
+}
+
+func TestMessage_Pack(t *testing.T) {
+	msg := &Message{
+		ID:        1234,
+		Flags:     FlagRecursionDesired,
+		Questions: []Question{{Name: "example.com", Type: TypeMX, Class: ClassIN}},
+	}
+	if _, err := (&Message{Questions: []Question{{Name: "bad..name"}}}).Pack(); err == nil {
+		t.Fatal("did not error")
+	}
+	response := msg.Reply(RCodeNoError)
+	if response.ID != 1234 || !response.IsResponse() || response.Flags&FlagRecursionDesired == 0 || response.Flags&FlagRecursionAvailable == 0 {
+		t.Fatalf("%+v", response)
+	}
+	mxData, _ := appendName([]byte{0, 10}, "mail.example.com")
+	response.Answers = []Resource{
+		{Name: "example.com", Type: TypeMX, Class: ClassIN, TTL: 300, Data: mxData},
+		NewAddressResource("mail.example.com", 60, []byte{1, 2, 3, 4}),
+	}
+	packet, err := response.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The name of the first answer is compressed into a pointer to the question
+	if packet[29] != 0xc0 || packet[30] != 12 {
+		t.Fatal(hex.EncodeToString(packet))
+	}
+	parsed, err := ParseMessage(packet)
+	if err != nil || !reflect.DeepEqual(parsed, response) {
+		t.Fatalf("%+v %v", parsed, err)
+	}
+	if record := NewAddressResource("example.com", 1, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}); record.Type != TypeAAAA || len(record.Data) != 16 {
+		t.Fatalf("%+v", record)
+	}
+}
+
+func TestDecompressData(t *testing.T) {
+	// A response that answers CNAME of www.example.com with a name compressed into pointers
+	packet, err := hex.DecodeString("000181800001000100000000037777770765786" +
+		"16d706c6503636f6d0000050001c00c000500010000012c0006036364" +
+		"6ec010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cname, next, err := parseName(msg.Answers[0].Data, 0)
+	if err != nil || cname != "cdn.example.com" || next != len(msg.Answers[0].Data) {
+		t.Fatal(cname, next, err)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/HouzuoGuo/laitos/misc"
 	"github.com/HouzuoGuo/laitos/testingstub"
 	"io/ioutil"
-	"math/rand"
 	"net"
 	"strconv"
 	"strings"
@@ -24,11 +23,7 @@ func (daemon *Daemon) HandleTCPQuery(clientConn net.Conn) {
 	defer clientConn.Close()
 	// Check address against rate limit and allowed IP prefixes
 	clientIP := clientConn.RemoteAddr().(*net.TCPAddr).IP.String()
-	if !daemon.rateLimit.Add(clientIP, true) {
-		return
-	}
-	if !daemon.checkAllowClientIP(clientIP) {
-		daemon.logger.Warning("HandleTCPQuery", clientIP, nil, "client IP is not allowed to query")
+	if !daemon.AllowQuery(clientIP) {
 		return
 	}
 	// Read query length
@@ -51,65 +46,13 @@ func (daemon *Daemon) HandleTCPQuery(clientConn net.Conn) {
 		daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to read query from client")
 		return
 	}
-	// Parse request and formulate a response
-	requestedDomainName := ExtractDomainName(queryBuf)
-	var responseLen int
-	var responseLenBuf []byte
-	var responseBuf []byte
-	var doForward bool
-	if requestedDomainName == "" {
-		// If I cannot figure out what domain is from the query, simply forward it without much concern.
-		daemon.logger.Info("HandleTCPQuery", clientIP, nil, "handle non-name query")
-		doForward = true
-	} else {
-		// This is a domain name query, check the name against black list and then forward.
-		if daemon.IsInBlacklist(requestedDomainName) {
-			daemon.logger.Info("HandleTCPQuery", clientIP, nil, "handle black-listed domain \"%s\"", requestedDomainName)
-			responseBuf = RespondWith0(queryBuf)
-			responseLen = len(responseBuf)
-			responseLenBuf = make([]byte, 2)
-			responseLenBuf[0] = byte(responseLen / 256)
-			responseLenBuf[1] = byte(responseLen % 256)
-		} else {
-			daemon.logger.Info("HandleTCPQuery", clientIP, nil, "handle domain \"%s\"", requestedDomainName)
-			doForward = true
-		}
-	}
-	// If queried domain is not black listed, forward the query to forwarder.
-	if doForward {
-		// Ask a randomly chosen TCP forwarder to process the query
-		myForwarder, err := net.DialTimeout("tcp", daemon.Forwarders[rand.Intn(len(daemon.Forwarders))], IOTimeoutSec*time.Second)
-		if err != nil {
-			daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to connect to forwarder")
-			return
-		}
-		defer myForwarder.Close()
-		// Send original query to forwarder without modification
-		myForwarder.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
-		if _, err = myForwarder.Write(queryLenBuf); err != nil {
-			daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to write length to forwarder")
-			return
-		} else if _, err = myForwarder.Write(queryBuf); err != nil {
-			daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to write query to forwarder")
-			return
-		}
-		// Retrieve forwarder's response
-		responseLenBuf = make([]byte, 2)
-		if _, err = myForwarder.Read(responseLenBuf); err != nil {
-			daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to read length from forwarder")
-			return
-		}
-		responseLen = int(responseLenBuf[0])*256 + int(responseLenBuf[1])
-		if responseLen > MaxPacketSize || responseLen < 1 {
-			daemon.logger.Warning("HandleTCPQuery", clientIP, nil, "bad response length from forwarder")
-			return
-		}
-		responseBuf = make([]byte, responseLen)
-		if _, err = myForwarder.Read(responseBuf); err != nil {
-			daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to read response from forwarder")
-			return
-		}
+	// Formulate a response from black list, cache, or forwarder
+	responseBuf, err := daemon.Resolve(clientIP, "tcp", queryBuf)
+	if err != nil {
+		daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to resolve query")
+		return
 	}
+	responseLenBuf := []byte{byte(len(responseBuf) / 256), byte(len(responseBuf) % 256)}
 	// Send response to my client
 	if _, err = clientConn.Write(responseLenBuf); err != nil {
 		daemon.logger.Warning("HandleTCPQuery", clientIP, err, "failed to answer length to client")
@@ -0,0 +1,94 @@
+package dnsd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/misc"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var TLSDurationStats = misc.NewStats() // TLSDurationStats stores statistics of duration of all DNS-over-TLS queries.
+
+/*
+HandleTLSConnection answers DNS-over-TLS queries (RFC 7858) from a client connection. A client may send many queries
+over the connection without waiting for their responses, hence each query is answered as soon as its response is ready.
+The connection is closed when client stays idle beyond IO timeout.
+*/
+func (daemon *Daemon) HandleTLSConnection(clientConn net.Conn) {
+	defer clientConn.Close()
+	clientIP := clientConn.RemoteAddr().(*net.TCPAddr).IP.String()
+	writeMutex := new(sync.Mutex)
+	pendingQueries := new(sync.WaitGroup)
+	defer pendingQueries.Wait()
+	for {
+		/*
+			Check address against rate limit and allowed IP prefixes for every query. The first check takes place
+			before TLS handshake, which only begins upon the first read.
+		*/
+		if !daemon.AllowQuery(clientIP) {
+			return
+		}
+		clientConn.SetReadDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+		queryBuf, err := readTCPMessage(clientConn)
+		if err != nil {
+			if err != io.EOF && !strings.Contains(err.Error(), "closed") {
+				daemon.logger.Warning("HandleTLSConnection", clientIP, err, "failed to read query from client")
+			}
+			return
+		}
+		pendingQueries.Add(1)
+		go func(queryBuf []byte) {
+			defer pendingQueries.Done()
+			// Put query duration (including IO time) into statistics
+			beginTimeNano := time.Now().UnixNano()
+			defer func() {
+				TLSDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
+			}()
+			responseBuf, err := daemon.Resolve(clientIP, "tls", queryBuf)
+			if err != nil {
+				daemon.logger.Warning("HandleTLSConnection", clientIP, err, "failed to resolve query")
+				return
+			}
+			writeMutex.Lock()
+			defer writeMutex.Unlock()
+			clientConn.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+			if err := writeTCPMessage(clientConn, responseBuf); err != nil {
+				daemon.logger.Warning("HandleTLSConnection", clientIP, err, "failed to answer to client")
+			}
+		}(queryBuf)
+	}
+}
+
+/*
+You may call this function only after having called Initialise()!
+Start DNS daemon to listen on DNS-over-TLS port only, until daemon is told to stop.
+*/
+func (daemon *Daemon) StartAndBlockTLS() error {
+	listenAddr := net.JoinHostPort(daemon.Address, strconv.Itoa(daemon.TLSPort))
+	listener, err := tls.Listen("tcp", listenAddr, daemon.tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	daemon.tlsListener = listener
+	// Process incoming DNS-over-TLS connections
+	daemon.logger.Info("StartAndBlockTLS", listenAddr, nil, "going to listen for queries")
+	for {
+		if misc.EmergencyLockDown {
+			return misc.ErrEmergencyLockDown
+		}
+		clientConn, err := listener.Accept()
+		if err != nil {
+			if strings.Contains(err.Error(), "closed") {
+				return nil
+			}
+			return fmt.Errorf("DNSD.StartAndBlockTLS: failed to accept new connection - %v", err)
+		}
+		go daemon.HandleTLSConnection(clientConn)
+	}
+}
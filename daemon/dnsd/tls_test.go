@@ -0,0 +1,148 @@
+package dnsd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key into the directory, and returns their paths.
+func writeTestCertificate(t *testing.T, dir string) (certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestDNSD_StartAndBlockTLS(t *testing.T) {
+	// Forwarder is a plain resolver that answers every query with an address
+	resolver, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resolver.Close()
+	go func() {
+		for {
+			conn, err := resolver.Accept()
+			if err != nil {
+				return
+			}
+			if query, err := readTCPMessage(conn); err == nil {
+				writeTCPMessage(conn, answerTestQuery(t, query))
+			}
+			conn.Close()
+		}
+	}()
+	dir, err := ioutil.TempDir("", "laitos-dnsd-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeTestCertificate(t, dir)
+
+	daemon := &Daemon{
+		Address:              "127.0.0.1",
+		AllowQueryIPPrefixes: []string{"192."},
+		Forwarders:           []string{resolver.Addr().String()},
+		TLSPort:              45118,
+	}
+	if err := daemon.Initialise(); err == nil {
+		t.Fatal("did not error on missing certificate")
+	}
+	daemon.TLSCertPath = certPath
+	daemon.TLSKeyPath = keyPath
+	if err := daemon.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if daemon.TCPPort != 0 || daemon.UDPPort != 0 {
+		t.Fatal("should not have listened on plain ports", daemon.TCPPort, daemon.UDPPort)
+	}
+	daemon.blackList["blocked.example.com"] = struct{}{}
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- daemon.StartAndBlockTLS()
+	}()
+	time.Sleep(1 * time.Second)
+
+	conn, err := tls.Dial("tcp", "127.0.0.1:45118", &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+	// Send two queries without waiting for their responses
+	for id, name := range map[uint16]string{1: "blocked.example.com", 2: "allowed.example.com"} {
+		query, err := (&Message{ID: id, Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}}}).Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeTCPMessage(conn, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		packet, err := readTCPMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := ParseMessage(packet)
+		if err != nil || len(response.Answers) != 1 {
+			t.Fatalf("%+v %v", response, err)
+		}
+		answeredIP := net.IP(response.Answers[0].Data)
+		if response.ID == 1 && !answeredIP.Equal(net.IPv4zero) || response.ID == 2 && !answeredIP.Equal(net.IPv4(10, 0, 0, 1)) {
+			t.Fatalf("%+v", response)
+		}
+	}
+	// Client IP that is not allowed to query does not get to complete TLS handshake
+	daemon.allowQueryMutex.Lock()
+	daemon.AllowQueryIPPrefixes = []string{"192."}
+	daemon.allowQueryMutex.Unlock()
+	if _, err := tls.Dial("tcp", "127.0.0.1:45118", &tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Fatal("should not have completed handshake")
+	}
+	// Daemon must stop in a second
+	daemon.Stop()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("did not stop")
+	}
+}
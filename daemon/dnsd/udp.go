@@ -15,28 +15,27 @@ import (
 var UDPDurationStats = misc.NewStats() // UDPDurationStats stores statistics of duration of all UDP DNS queries.
 
 // Send forward queries to forwarder and forward the response to my DNS client.
-func (daemon *Daemon) HandleUDPQueries(myQueue chan *UDPQuery, forwarderConn net.Conn) {
-	packetBuf := make([]byte, MaxPacketSize)
+func (daemon *Daemon) HandleUDPQueries(myQueue chan *UDPQuery, forwarder Forwarder) {
 	for {
 		query := <-myQueue
 		// Put query duration (including IO time) into statistics
 		beginTimeNano := time.Now().UnixNano()
-		// Set deadline for IO with forwarder
-		forwarderConn.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
-		if _, err := forwarderConn.Write(query.QueryPacket); err != nil {
-			daemon.logger.Warning("HandleUDPQueries", query.ClientAddr.String(), err, "failed to write to forwarder")
-			UDPDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
-			continue
-		}
-		packetLength, err := forwarderConn.Read(packetBuf)
+		response, err := forwarder.Exchange(query.QueryPacket)
 		if err != nil {
-			daemon.logger.Warning("HandleUDPQueries", query.ClientAddr.String(), err, "failed to read from forwarder")
+			daemon.logger.Warning("HandleUDPQueries", query.ClientAddr.String(), err, "failed to exchange query with forwarder")
 			UDPDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
 			continue
 		}
+		queryMessage := query.Query
+		if queryMessage != nil {
+			daemon.cache.Store(queryMessage, response)
+		} else {
+			// Non-name query still tells the size of response acceptable to the client
+			queryMessage, _ = ParseMessage(query.QueryPacket)
+		}
 		// Set deadline for responding to my DNS client
 		query.MyServer.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
-		if _, err := query.MyServer.WriteTo(packetBuf[:packetLength], query.ClientAddr); err != nil {
+		if _, err := query.MyServer.WriteTo(TruncateForUDP(response, queryMessage.MaxUDPResponseSize()), query.ClientAddr); err != nil {
 			daemon.logger.Warning("HandleUDPQueries", query.ClientAddr.String(), err, "failed to answer to client")
 			UDPDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
 			continue
@@ -52,7 +51,12 @@ func (daemon *Daemon) HandleBlackHoleAnswer(myQueue chan *UDPQuery) {
 		// Put query duration (including IO time) into statistics
 		beginTimeNano := time.Now().UnixNano()
 		// Set deadline for responding to my DNS client
-		blackHoleAnswer := RespondWith0(query.QueryPacket)
+		blackHoleAnswer, err := RespondWithBlackHole(query.Query, daemon.BlacklistNXDomain)
+		if err != nil {
+			daemon.logger.Warning("HandleBlackHoleAnswer", query.ClientAddr.String(), err, "failed to create response")
+			UDPDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
+			continue
+		}
 		query.MyServer.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
 		if _, err := query.MyServer.WriteTo(blackHoleAnswer, query.ClientAddr); err != nil {
 			daemon.logger.Warning("HandleUDPQueries", query.ClientAddr.String(), err, "IO failure")
@@ -80,7 +84,7 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 	daemon.logger.Info("StartAndBlockUDP", listenAddr, nil, "going to listen for queries")
 	// Start queues that will respond to DNS clients
 	for i, queue := range daemon.udpForwarderQueue {
-		go daemon.HandleUDPQueries(queue, daemon.udpForwardConn[i])
+		go daemon.HandleUDPQueries(queue, daemon.udpForwarders[i])
 	}
 	for _, queue := range daemon.udpBlackHoleQueue {
 		go daemon.HandleBlackHoleAnswer(queue)
@@ -100,11 +104,7 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 		}
 		// Check address against rate limit and allowed IP prefixes
 		clientIP := clientAddr.IP.String()
-		if !daemon.rateLimit.Add(clientIP, true) {
-			continue
-		}
-		if !daemon.checkAllowClientIP(clientIP) {
-			daemon.logger.Warning("UDPLoop", clientIP, nil, "client IP is not allowed to query")
+		if !daemon.allowUDPQuery(clientIP) {
 			continue
 		}
 
@@ -112,7 +112,7 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 		randForwarder := rand.Intn(len(daemon.udpForwarderQueue))
 		forwardPacket := make([]byte, packetLength)
 		copy(forwardPacket, packetBuf[:packetLength])
-		domainName := ExtractDomainName(forwardPacket)
+		query, domainName := ParseNameQuery(forwardPacket)
 		if domainName == "" {
 			// If I cannot figure out what domain is from the query, simply forward it without much concern.
 			daemon.logger.Info(fmt.Sprintf("UDP-%d", randForwarder), clientIP, nil,
@@ -122,8 +122,18 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 				MyServer:    udpServer,
 				QueryPacket: forwardPacket,
 			}
+		} else if localResponse := daemon.RespondLocally(clientIP, query); localResponse != nil {
+			// The name has local records
+			beginTimeNano := time.Now().UnixNano()
+			daemon.logger.Info("UDPLoop", clientIP, nil, "handle domain \"%s\" from local records", domainName)
+			udpServer.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+			if _, err := udpServer.WriteTo(TruncateForUDP(localResponse, query.MaxUDPResponseSize()), clientAddr); err != nil {
+				daemon.logger.Warning("UDPLoop", clientIP, err, "failed to answer to client")
+			}
+			UDPDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
 		} else if daemon.IsInBlacklist(domainName) {
 			// Requested domain name is black-listed
+			BlacklistHits.Increase("udp")
 			randBlackListResponder := rand.Intn(len(daemon.udpBlackHoleQueue))
 			daemon.logger.Info(fmt.Sprintf("UDP-%d", randBlackListResponder), clientIP, nil,
 				"handle black-listed domain \"%s\" (backlog %d)", domainName, len(daemon.udpBlackHoleQueue[randBlackListResponder]))
@@ -131,7 +141,17 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 				ClientAddr:  clientAddr,
 				MyServer:    udpServer,
 				QueryPacket: forwardPacket,
+				Query:       query,
 			}
+		} else if cachedResponse := daemon.cache.Lookup(query); cachedResponse != nil {
+			// The same question was answered moments ago
+			beginTimeNano := time.Now().UnixNano()
+			daemon.logger.Info("UDPLoop", clientIP, nil, "handle domain \"%s\" from cache", domainName)
+			udpServer.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+			if _, err := udpServer.WriteTo(TruncateForUDP(cachedResponse, query.MaxUDPResponseSize()), clientAddr); err != nil {
+				daemon.logger.Warning("UDPLoop", clientIP, err, "failed to answer to client")
+			}
+			UDPDurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
 		} else {
 			// This is a normal domain name query and not black-listed
 			daemon.logger.Info(fmt.Sprintf("UDP-%d", randForwarder), clientIP, nil,
@@ -140,6 +160,7 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 				ClientAddr:  clientAddr,
 				MyServer:    udpServer,
 				QueryPacket: forwardPacket,
+				Query:       query,
 			}
 		}
 	}
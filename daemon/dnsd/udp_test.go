@@ -0,0 +1,150 @@
+package dnsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncateForUDP(t *testing.T) {
+	query := &Message{ID: 1, Questions: []Question{{Name: "example.com", Type: TypeTXT, Class: ClassIN}}}
+	if size := query.MaxUDPResponseSize(); size != MinUDPPayloadSize {
+		t.Fatal(size)
+	}
+	query.Additionals = []Resource{{Type: TypeOPT, Class: 4096}}
+	if size := query.MaxUDPResponseSize(); size != 4096 {
+		t.Fatal(size)
+	}
+	query.Additionals = []Resource{{Type: TypeOPT, Class: 65535}}
+	if size := query.MaxUDPResponseSize(); size != MaxPacketSize {
+		t.Fatal(size)
+	}
+	if size := (*Message)(nil).MaxUDPResponseSize(); size != MinUDPPayloadSize {
+		t.Fatal(size)
+	}
+	response := query.Reply(RCodeNoError)
+	response.Answers = []Resource{{Name: "example.com", Type: TypeTXT, Class: ClassIN, TTL: 60, Data: append([]byte{255}, strings.Repeat("a", 255)...)}}
+	packet, err := response.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Response that fits is left intact
+	if truncated := TruncateForUDP(packet, MinUDPPayloadSize); string(truncated) != string(packet) {
+		t.Fatal(truncated)
+	}
+	// Large response only keeps the question
+	for i := 0; i < 10; i++ {
+		response.Answers = append(response.Answers, response.Answers[0])
+	}
+	if packet, err = response.Pack(); err != nil {
+		t.Fatal(err)
+	}
+	truncated, err := ParseMessage(TruncateForUDP(packet, MinUDPPayloadSize))
+	if err != nil || truncated.ID != 1 || truncated.Flags&FlagTruncated == 0 || truncated.Name() != "example.com" || len(truncated.Answers) != 0 {
+		t.Fatalf("%+v %v", truncated, err)
+	}
+	// Malformed response is reduced to header
+	if truncated := TruncateForUDP(packet[:MinUDPPayloadSize+1], MinUDPPayloadSize); len(truncated) != HeaderSize {
+		t.Fatal(truncated)
+	}
+}
+
+func TestDNSD_UDPResponseSize(t *testing.T) {
+	// Forwarder is a plain resolver that answers every query with a large text record
+	resolver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resolver.Close()
+	go func() {
+		buf := make([]byte, MaxPacketSize)
+		for {
+			packetLen, clientAddr, err := resolver.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query, err := ParseMessage(buf[:packetLen])
+			if err != nil {
+				continue
+			}
+			response := query.Reply(RCodeNoError)
+			for i := 0; i < 8; i++ {
+				response.Answers = append(response.Answers, Resource{Name: query.Questions[0].Name, Type: TypeTXT, Class: ClassIN, TTL: 60,
+					Data: append([]byte{255}, strings.Repeat("a", 255)...)})
+			}
+			packet, err := response.Pack()
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			resolver.WriteTo(packet, clientAddr)
+		}
+	}()
+	daemon := &Daemon{
+		Address:              "127.0.0.1",
+		AllowQueryIPPrefixes: []string{"192."},
+		Forwarders:           []string{resolver.LocalAddr().String()},
+		UDPPort:              45119,
+		PerIPLimit:           100,
+	}
+	if err := daemon.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- daemon.StartAndBlockUDP()
+	}()
+	time.Sleep(1 * time.Second)
+
+	exchange := func(query *Message) *Message {
+		queryPacket, err := query.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.Dial("udp", "127.0.0.1:45119")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(IOTimeoutSec * time.Second))
+		if _, err := conn.Write(queryPacket); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, MaxPacketSize)
+		packetLen, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packetLen > query.MaxUDPResponseSize() {
+			t.Fatal("response is too large", packetLen)
+		}
+		response, err := ParseMessage(buf[:packetLen])
+		if err != nil || response.ID != query.ID {
+			t.Fatalf("%+v %v", response, err)
+		}
+		return response
+	}
+	// Client without EDNS gets a truncated response from forwarder, and then from cache
+	for i := 0; i < 2; i++ {
+		query := &Message{ID: uint16(i), Questions: []Question{{Name: "example.com", Type: TypeTXT, Class: ClassIN}}}
+		if response := exchange(query); response.Flags&FlagTruncated == 0 || len(response.Answers) != 0 {
+			t.Fatalf("%+v", response)
+		}
+	}
+	// Client with a large EDNS buffer gets the entire response
+	query := &Message{ID: 2, Questions: []Question{{Name: "example.com", Type: TypeTXT, Class: ClassIN}},
+		Additionals: []Resource{{Type: TypeOPT, Class: 4096}}}
+	if response := exchange(query); response.Flags&FlagTruncated != 0 || len(response.Answers) != 8 {
+		t.Fatalf("%+v", response)
+	}
+	daemon.Stop()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("did not stop")
+	}
+}
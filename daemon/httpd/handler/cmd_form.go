@@ -56,6 +56,7 @@ func (form *HandleCommandForm) Handle(w http.ResponseWriter, r *http.Request) {
 			result := form.cmdProc.Process(toolbox.Command{
 				Content:    cmd,
 				TimeoutSec: CommandFormTimeoutSec,
+				ClientID:   GetRealClientIP(r),
 			})
 			w.Write([]byte(fmt.Sprintf(HandleCommandFormPage, html.EscapeString(result.CombinedOutput))))
 		}
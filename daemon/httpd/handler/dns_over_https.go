@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/HouzuoGuo/laitos/daemon/common"
+	"github.com/HouzuoGuo/laitos/daemon/dnsd"
+	"github.com/HouzuoGuo/laitos/misc"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DNSMessageContentType is the content type of DNS message in wire format carried by DNS-over-HTTPS requests and responses.
+const DNSMessageContentType = "application/dns-message"
+
+/*
+Answer DNS-over-HTTPS queries (RFC 8484) using the DNS daemon, which checks client IP against its allowed prefixes and
+rate limit, and answers the query from black list, cache, or forwarder.
+A query is either carried by GET request in base64url-encoded parameter "dns", or by POST request body.
+*/
+type HandleDNSOverHTTPS struct {
+	DNSDaemon *dnsd.Daemon `json:"-"` // DNSDaemon is assumed to be already initialised
+
+	logger misc.Logger
+}
+
+func (doh *HandleDNSOverHTTPS) Initialise(logger misc.Logger, _ *common.CommandProcessor) error {
+	doh.logger = logger
+	if doh.DNSDaemon == nil {
+		return errors.New("HandleDNSOverHTTPS.Initialise: DNS daemon must be configured")
+	}
+	return nil
+}
+
+func (doh *HandleDNSOverHTTPS) Handle(w http.ResponseWriter, r *http.Request) {
+	NoCache(w)
+	// IPv6 address of a client carries square brackets
+	clientIP := strings.Trim(GetRealClientIP(r), "[]")
+	var query []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		query, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(r.FormValue("dns"), "="))
+		if err != nil || len(query) == 0 {
+			http.Error(w, "parameter dns must carry a base64url-encoded query", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != DNSMessageContentType {
+			http.Error(w, "content type must be "+DNSMessageContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+		query, err = ioutil.ReadAll(io.LimitReader(r.Body, dnsd.MaxPacketSize+1))
+		if err != nil || len(query) == 0 || len(query) > dnsd.MaxPacketSize {
+			http.Error(w, "request body must carry a query", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method must be GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !doh.DNSDaemon.AllowQuery(clientIP) {
+		http.Error(w, "client is not allowed to query", http.StatusForbidden)
+		return
+	}
+	response, err := doh.DNSDaemon.Resolve(clientIP, "https", query)
+	if err != nil {
+		doh.logger.Warning("HandleDNSOverHTTPS", clientIP, err, "failed to resolve query")
+		http.Error(w, "failed to resolve query", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", DNSMessageContentType)
+	w.Write(response)
+}
+
+func (_ *HandleDNSOverHTTPS) GetRateLimitFactor() int {
+	// A browser or phone may send many queries in a short period of time, the DNS daemon further limits the rate.
+	return 20
+}
+
+func (_ *HandleDNSOverHTTPS) SelfTest() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/HouzuoGuo/laitos/daemon/dnsd"
+	"github.com/HouzuoGuo/laitos/misc"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleDNSOverHTTPS(t *testing.T) {
+	// Forwarder is a plain resolver that answers every query with an address
+	resolver, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resolver.Close()
+	go func() {
+		for {
+			conn, err := resolver.Accept()
+			if err != nil {
+				return
+			}
+			var queryLen uint16
+			if binary.Read(conn, binary.BigEndian, &queryLen) == nil {
+				queryPacket := make([]byte, queryLen)
+				if _, err := io.ReadFull(conn, queryPacket); err == nil {
+					query, _ := dnsd.ParseMessage(queryPacket)
+					response := query.Reply(dnsd.RCodeNoError)
+					response.Answers = []dnsd.Resource{dnsd.NewAddressResource(query.Questions[0].Name, 60, net.IPv4(10, 0, 0, 1))}
+					responsePacket, _ := response.Pack()
+					conn.Write(append([]byte{byte(len(responsePacket) >> 8), byte(len(responsePacket))}, responsePacket...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	dnsDaemon := &dnsd.Daemon{
+		Address:              "127.0.0.1",
+		AllowQueryIPPrefixes: []string{"192.0.2."},
+		Forwarders:           []string{resolver.Addr().String()},
+		TCPPort:              53,
+	}
+	if err := dnsDaemon.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	doh := &HandleDNSOverHTTPS{}
+	if err := doh.Initialise(misc.Logger{}, nil); err == nil {
+		t.Fatal("did not error on missing DNS daemon")
+	}
+	doh.DNSDaemon = dnsDaemon
+	if err := doh.Initialise(misc.Logger{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	query, err := (&dnsd.Message{ID: 0, Questions: []dnsd.Question{{Name: "example.com", Type: dnsd.TypeA, Class: dnsd.ClassIN}}}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyResponse := func(recorder *httptest.ResponseRecorder) {
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != DNSMessageContentType {
+			t.Fatal(recorder.Code, recorder.Body.String())
+		}
+		response, err := dnsd.ParseMessage(recorder.Body.Bytes())
+		if err != nil || response.Name() != "example.com" || len(response.Answers) != 1 || !net.IP(response.Answers[0].Data).Equal(net.IPv4(10, 0, 0, 1)) {
+			t.Fatalf("%+v %v", response, err)
+		}
+	}
+	// GET carries query in base64url without padding
+	recorder := httptest.NewRecorder()
+	doh.Handle(recorder, httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(query), nil))
+	verifyResponse(recorder)
+	// POST carries query in request body
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(query))
+	request.Header.Set("Content-Type", DNSMessageContentType)
+	doh.Handle(recorder, request)
+	verifyResponse(recorder)
+	// Bad requests
+	recorder = httptest.NewRecorder()
+	doh.Handle(recorder, httptest.NewRequest(http.MethodGet, "/dns-query?dns=!!!", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatal(recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	doh.Handle(recorder, httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(query)))
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Fatal(recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	doh.Handle(recorder, httptest.NewRequest(http.MethodPut, "/dns-query", bytes.NewReader(query)))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatal(recorder.Code)
+	}
+	// Client IP must be allowed by DNS daemon
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	request.RemoteAddr = "198.51.100.1:1234"
+	doh.Handle(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatal(recorder.Code)
+	}
+}
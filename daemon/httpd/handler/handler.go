@@ -7,6 +7,7 @@ import (
 	"github.com/HouzuoGuo/laitos/daemon/common"
 	"github.com/HouzuoGuo/laitos/daemon/dnsd"
 	"github.com/HouzuoGuo/laitos/daemon/plainsocket"
+	"github.com/HouzuoGuo/laitos/daemon/scheduler"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd/mailcmd"
 	"github.com/HouzuoGuo/laitos/daemon/sockd"
@@ -93,23 +94,30 @@ maintenance.go of maintenance package.
 func GetLatestStats() string {
 	numDecimals := 2
 	factor := 1000000000.0
+	dnsCacheLookups := dnsd.CacheLookups.Get()
 	return fmt.Sprintf(`Web and bot commands: %s
 DNS server  TCP|UDP:  %s | %s
+DNS server  TLS:      %s
+DNS cache hit|miss:   %d | %d
 Web servers:          %s
 Mail commands:        %s
 Text server TCP|UDP:  %s | %s
 Mail server:          %s
 Sock server TCP|UDP:  %s | %s
 Telegram commands:    %s
+Scheduled commands:   %s
 `,
 		common.DurationStats.Format(factor, numDecimals),
 		dnsd.TCPDurationStats.Format(factor, numDecimals), dnsd.UDPDurationStats.Format(factor, numDecimals),
+		dnsd.TLSDurationStats.Format(factor, numDecimals),
+		dnsCacheLookups["hit"], dnsCacheLookups["miss"],
 		DurationStats.Format(factor, numDecimals),
 		mailcmd.DurationStats.Format(factor, numDecimals),
 		plainsocket.TCPDurationStats.Format(factor, numDecimals), plainsocket.UDPDurationStats.Format(factor, numDecimals),
 		smtpd.DurationStats.Format(factor, numDecimals),
 		sockd.TCPDurationStats.Format(factor, numDecimals), sockd.UDPDurationStats.Format(factor, numDecimals),
-		telegrambot.DurationStats.Format(factor, numDecimals))
+		telegrambot.DurationStats.Format(factor, numDecimals),
+		scheduler.DurationStats.Format(factor, numDecimals))
 }
 
 // Inspect system and environment and return their information in text form. Double as a health check endpoint.
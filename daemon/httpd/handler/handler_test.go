@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"github.com/HouzuoGuo/laitos/daemon/common"
+	"strings"
 	"testing"
 )
 
@@ -11,3 +13,19 @@ func TestXMLEscape(t *testing.T) {
 }
 
 // API handlers are tested in httpd_test.go
+
+func TestGetPrometheusMetrics(t *testing.T) {
+	common.FeatureCommands.Increase(`.x"y`)
+	metrics := GetPrometheusMetrics()
+	for _, expected := range []string{
+		"# TYPE laitos_duration_seconds summary\n",
+		`laitos_duration_seconds_count{component="httpd"} 0` + "\n",
+		`laitos_feature_commands_total{trigger=".x\"y"} 1` + "\n",
+		"# TYPE laitos_goroutines gauge\n",
+		"laitos_emergency_lock_down 0\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Fatal(expected, metrics)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/daemon/common"
+	"github.com/HouzuoGuo/laitos/daemon/dnsd"
+	"github.com/HouzuoGuo/laitos/daemon/plainsocket"
+	"github.com/HouzuoGuo/laitos/daemon/scheduler"
+	"github.com/HouzuoGuo/laitos/daemon/smtpd"
+	"github.com/HouzuoGuo/laitos/daemon/smtpd/mailcmd"
+	"github.com/HouzuoGuo/laitos/daemon/sockd"
+	"github.com/HouzuoGuo/laitos/daemon/telegrambot"
+	"github.com/HouzuoGuo/laitos/misc"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PrometheusContentType is the content type of Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusLabelEscape escapes backslash, double quote, and line feed in a label value.
+var prometheusLabelEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+/*
+GetDurationStats returns duration statistics of all front-end daemons by their component name. The durations are in
+nanoseconds.
+*/
+func GetDurationStats() map[string]*misc.Stats {
+	return map[string]*misc.Stats{
+		"command":         common.DurationStats,
+		"dnsd_tcp":        dnsd.TCPDurationStats,
+		"dnsd_tls":        dnsd.TLSDurationStats,
+		"dnsd_udp":        dnsd.UDPDurationStats,
+		"httpd":           DurationStats,
+		"mailcmd":         mailcmd.DurationStats,
+		"plainsocket_tcp": plainsocket.TCPDurationStats,
+		"plainsocket_udp": plainsocket.UDPDurationStats,
+		"scheduler":       scheduler.DurationStats,
+		"smtpd":           smtpd.DurationStats,
+		"sockd_tcp":       sockd.TCPDurationStats,
+		"sockd_udp":       sockd.UDPDurationStats,
+		"telegrambot":     telegrambot.DurationStats,
+	}
+}
+
+// prometheusWriter writes metrics in Prometheus text exposition format.
+type prometheusWriter struct {
+	out bytes.Buffer
+}
+
+// header writes help text and type of a metric.
+func (prom *prometheusWriter) header(name, metricType, help string) {
+	prom.out.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType))
+}
+
+// sample writes a value of the metric, optionally with a label.
+func (prom *prometheusWriter) sample(name, labelName, labelValue string, value float64) {
+	if labelName == "" {
+		prom.out.WriteString(fmt.Sprintf("%s %v\n", name, value))
+	} else {
+		prom.out.WriteString(fmt.Sprintf("%s{%s=\"%s\"} %v\n", name, labelName, prometheusLabelEscape.Replace(labelValue), value))
+	}
+}
+
+// counters writes a counter metric with one sample per named counter, in the order of their names.
+func (prom *prometheusWriter) counters(name, help, labelName string, counters *misc.Counters) {
+	prom.header(name, "counter", help)
+	counts := counters.Get()
+	labelValues := make([]string, 0, len(counts))
+	for labelValue := range counts {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	for _, labelValue := range labelValues {
+		prom.sample(name, labelName, labelValue, float64(counts[labelValue]))
+	}
+}
+
+// GetPrometheusMetrics returns program statistics and runtime status in Prometheus text exposition format.
+func GetPrometheusMetrics() string {
+	var prom prometheusWriter
+	// Duration of requests and commands served by front-end daemons
+	prom.header("laitos_duration_seconds", "summary", "Duration of requests and commands served by daemons.")
+	durationStats := GetDurationStats()
+	components := make([]string, 0, len(durationStats))
+	for component := range durationStats {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		count, total := durationStats[component].GetCountAndTotal()
+		prom.sample("laitos_duration_seconds_sum", "component", component, total/float64(time.Second))
+		prom.sample("laitos_duration_seconds_count", "component", component, float64(count))
+	}
+	// Counters of events
+	prom.counters("laitos_rate_limit_rejections_total", "Number of requests rejected by rate limit.", "component", misc.RateLimitRejections)
+	prom.counters("laitos_dns_blacklist_hits_total", "Number of DNS queries answered with black hole.", "protocol", dnsd.BlacklistHits)
+	prom.counters("laitos_dns_cache_lookups_total", "Number of DNS queries looked up in response cache.", "result", dnsd.CacheLookups)
+	prom.counters("laitos_feature_commands_total", "Number of toolbox commands executed.", "trigger", common.FeatureCommands)
+	prom.counters("laitos_feature_errors_total", "Number of toolbox commands that resulted in an error.", "trigger", common.FeatureErrors)
+	// Runtime status
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	prom.header("laitos_memory_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	prom.sample("laitos_memory_heap_alloc_bytes", "", "", float64(memStats.HeapAlloc))
+	prom.header("laitos_memory_sys_bytes", "gauge", "Bytes of memory obtained from the operating system.")
+	prom.sample("laitos_memory_sys_bytes", "", "", float64(memStats.Sys))
+	prom.header("laitos_goroutines", "gauge", "Number of goroutines.")
+	prom.sample("laitos_goroutines", "", "", float64(runtime.NumGoroutine()))
+	prom.header("laitos_uptime_seconds", "gauge", "Number of seconds since the program started.")
+	prom.sample("laitos_uptime_seconds", "", "", time.Since(misc.StartupTime).Seconds())
+	prom.header("laitos_banned_actors", "gauge", "Number of clients who are currently banned.")
+	bannedActors, _ := misc.Bans.GetBanned()
+	prom.sample("laitos_banned_actors", "", "", float64(len(bannedActors)))
+	var lockDown float64
+	if misc.EmergencyLockDown {
+		lockDown = 1
+	}
+	prom.header("laitos_emergency_lock_down", "gauge", "1 if emergency lock down is in effect, 0 otherwise.")
+	prom.sample("laitos_emergency_lock_down", "", "", lockDown)
+	return prom.out.String()
+}
+
+// Expose program statistics and runtime status in Prometheus text exposition format for a Prometheus server to scrape.
+type HandlePrometheus struct {
+}
+
+func (_ *HandlePrometheus) Initialise(misc.Logger, *common.CommandProcessor) error {
+	return nil
+}
+
+func (_ *HandlePrometheus) Handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", PrometheusContentType)
+	NoCache(w)
+	if !WarnIfNoHTTPS(r, w) {
+		return
+	}
+	w.Write([]byte(GetPrometheusMetrics()))
+}
+
+func (_ *HandlePrometheus) GetRateLimitFactor() int {
+	return 2
+}
+
+func (_ *HandlePrometheus) SelfTest() error {
+	return nil
+}
@@ -83,6 +83,7 @@ func (hand *HandleTwilioSMSHook) Handle(w http.ResponseWriter, r *http.Request)
 	ret := hand.cmdProc.Process(toolbox.Command{
 		TimeoutSec: TwilioHandlerTimeoutSec,
 		Content:    r.FormValue("Body"),
+		ClientID:   phoneNumber,
 	})
 	// Generate normal XML response
 	w.Write([]byte(fmt.Sprintf(xml.Header+`
@@ -205,6 +206,7 @@ func (hand *HandleTwilioCallCallback) Handle(w http.ResponseWriter, r *http.Requ
 	ret := hand.cmdProc.Process(toolbox.Command{
 		TimeoutSec: TwilioHandlerTimeoutSec,
 		Content:    DTMFDecode(dtmfInput),
+		ClientID:   phoneNumber,
 	})
 	combinedOutput := ret.CombinedOutput
 	if phoneticSpelling {
@@ -299,6 +299,13 @@ func TestAPIHandlers(httpd *Daemon, t testingstub.T) {
 	if err != nil || resp.StatusCode != http.StatusOK || !strings.Contains(string(resp.Body), "bin") {
 		t.Fatal(err, string(resp.Body))
 	}
+	// Prometheus metrics should include the command that has just run
+	resp, err = inet.DoHTTP(inet.HTTPRequest{Header: basicAuth}, addr+"/prometheus")
+	if err != nil || resp.StatusCode != http.StatusOK ||
+		!strings.Contains(string(resp.Body), `laitos_feature_commands_total{trigger=".s"}`) ||
+		!strings.Contains(string(resp.Body), `laitos_duration_seconds_count{component="httpd"}`) {
+		t.Fatal(err, string(resp.Body))
+	}
 	// Gitlab handle
 	resp, err = inet.DoHTTP(inet.HTTPRequest{Header: basicAuth}, addr+"/gitlab")
 	if err != nil || resp.StatusCode != http.StatusOK || strings.Index(string(resp.Body), "Enter path to browse") == -1 {
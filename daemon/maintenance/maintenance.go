@@ -8,6 +8,7 @@ import (
 	"github.com/HouzuoGuo/laitos/daemon/httpd"
 	"github.com/HouzuoGuo/laitos/daemon/httpd/handler"
 	"github.com/HouzuoGuo/laitos/daemon/plainsocket"
+	"github.com/HouzuoGuo/laitos/daemon/scheduler"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd/mailcmd"
 	"github.com/HouzuoGuo/laitos/daemon/sockd"
@@ -55,11 +56,26 @@ type Daemon struct {
 	MailCmdRunnerToTest *mailcmd.CommandRunner  `json:"-"`          // MailCmdRunnerToTest is mail command runner to be tested during health check.
 	HTTPHandlersToCheck httpd.HandlerCollection `json:"-"`          // HTTPHandlersToCheck are the URL handlers of an HTTP daemon to be tested during health check.
 
-	loopIsRunning int32     // Value is 1 only when maintenance loop is running
-	stop          chan bool // Signal maintenance loop to stop
+	loopIsRunning int32        // Value is 1 only when maintenance loop is running
+	stop          chan bool    // Signal maintenance loop to stop
+	featuresMutex sync.RWMutex // featuresMutex protects FeaturesToTest from being replaced while it is read
 	logger        misc.Logger
 }
 
+// SetFeaturesToTest replaces the toolbox features to be tested during health check, e.g. after configuration reload.
+func (daemon *Daemon) SetFeaturesToTest(features *toolbox.FeatureSet) {
+	daemon.featuresMutex.Lock()
+	defer daemon.featuresMutex.Unlock()
+	daemon.FeaturesToTest = features
+}
+
+// getFeaturesToTest returns the latest toolbox features to be tested during health check.
+func (daemon *Daemon) getFeaturesToTest() *toolbox.FeatureSet {
+	daemon.featuresMutex.RLock()
+	defer daemon.featuresMutex.RUnlock()
+	return daemon.FeaturesToTest
+}
+
 /*
 GetLatestStats returns statistic information from all front-end daemons, each on their own line.
 Due to inevitable cyclic import, this function is defined twice, once in handler.go of handler package, the other in
@@ -68,23 +84,30 @@ maintenance.go of maintenance package.
 func GetLatestStats() string {
 	numDecimals := 2
 	factor := 1000000000.0
+	dnsCacheLookups := dnsd.CacheLookups.Get()
 	return fmt.Sprintf(`Web and bot commands: %s
 DNS server  TCP|UDP:  %s | %s
+DNS server  TLS:      %s
+DNS cache hit|miss:   %d | %d
 Web servers:          %s
 Mail commands:        %s
 Text server TCP|UDP:  %s | %s
 Mail server:          %s
 Sock server TCP|UDP:  %s | %s
 Telegram commands:    %s
+Scheduled commands:   %s
 `,
 		common.DurationStats.Format(factor, numDecimals),
 		dnsd.TCPDurationStats.Format(factor, numDecimals), dnsd.UDPDurationStats.Format(factor, numDecimals),
+		dnsd.TLSDurationStats.Format(factor, numDecimals),
+		dnsCacheLookups["hit"], dnsCacheLookups["miss"],
 		handler.DurationStats.Format(factor, numDecimals),
 		mailcmd.DurationStats.Format(factor, numDecimals),
 		plainsocket.TCPDurationStats.Format(factor, numDecimals), plainsocket.UDPDurationStats.Format(factor, numDecimals),
 		smtpd.DurationStats.Format(factor, numDecimals),
 		sockd.TCPDurationStats.Format(factor, numDecimals), sockd.UDPDurationStats.Format(factor, numDecimals),
-		telegrambot.DurationStats.Format(factor, numDecimals))
+		telegrambot.DurationStats.Format(factor, numDecimals),
+		scheduler.DurationStats.Format(factor, numDecimals))
 }
 
 // runPortsCheck knocks on TCP ports that are to be checked in parallel, it returns an error if any of the ports fails to connect.
@@ -145,8 +168,8 @@ func (daemon *Daemon) Execute() (string, bool) {
 	}()
 	go func() {
 		// Toolbox feature self test - the routine itself also uses concurrency internally
-		if daemon.FeaturesToTest != nil {
-			featureErr = daemon.FeaturesToTest.SelfTest()
+		if features := daemon.getFeaturesToTest(); features != nil {
+			featureErr = features.SelfTest()
 		}
 		waitAllChecks.Done()
 	}()
@@ -22,10 +22,11 @@ type Daemon struct {
 	PerIPLimit int                      `json:"PerIPLimit"` // PerIPLimit is approximately how many concurrent users are expected to be using the server from same IP address
 	Processor  *common.CommandProcessor `json:"-"`          // Feature command processor
 
-	tcpListener net.Listener    // Once TCP daemon is started, this is its listener.
-	udpListener *net.UDPConn    // Once UDP daemon is started, this is its listener.
-	rateLimit   *misc.RateLimit // Rate limit counter per IP address
-	logger      misc.Logger     // logger
+	tcpListener  net.Listener    // Once TCP daemon is started, this is its listener.
+	udpListener  *net.UDPConn    // Once UDP daemon is started, this is its listener.
+	rateLimitTCP *misc.RateLimit // Rate limit counter per IP address of TCP clients
+	rateLimitUDP *misc.RateLimit // Rate limit counter per IP address of UDP clients
+	logger       misc.Logger     // logger
 }
 
 // Check configuration and initialise internal states.
@@ -51,12 +52,20 @@ func (daemon *Daemon) Initialise() error {
 		// No reasonable defaults for these two, sorry.
 		return errors.New("plainsocket.Initialise: either or both TCP and UDP ports must be specified and be greater than 0")
 	}
-	daemon.rateLimit = &misc.RateLimit{
+	daemon.rateLimitTCP = &misc.RateLimit{
 		MaxCount: daemon.PerIPLimit,
 		UnitSecs: RateLimitIntervalSec,
 		Logger:   daemon.logger,
 	}
-	daemon.rateLimit.Initialise()
+	daemon.rateLimitTCP.Initialise()
+	// UDP clients may carry spoofed IP, hence neither the rate limit nor an incorrect PIN gets them banned.
+	daemon.rateLimitUDP = &misc.RateLimit{
+		MaxCount:      daemon.PerIPLimit,
+		UnitSecs:      RateLimitIntervalSec,
+		Logger:        daemon.logger,
+		ExemptFromBan: true,
+	}
+	daemon.rateLimitUDP.Initialise()
 	return nil
 }
 
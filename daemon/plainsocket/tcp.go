@@ -53,7 +53,7 @@ func (daemon *Daemon) HandleTCPConnection(clientConn net.Conn) {
 	defer clientConn.Close()
 	clientIP := clientConn.RemoteAddr().(*net.TCPAddr).IP.String()
 	// Check connection against rate limit even before reading a line of command
-	if !daemon.rateLimit.Add(clientIP, true) {
+	if !daemon.rateLimitTCP.Add(clientIP, true) {
 		return
 	}
 	daemon.logger.Info("HandleTCPConnection", clientIP, nil, "working on the connection")
@@ -69,11 +69,11 @@ func (daemon *Daemon) HandleTCPConnection(clientConn net.Conn) {
 			return
 		}
 		// Check against conversation rate limit
-		if !daemon.rateLimit.Add(clientIP, true) {
+		if !daemon.rateLimitTCP.Add(clientIP, true) {
 			return
 		}
 		// Process line of command and respond
-		result := daemon.Processor.Process(toolbox.Command{Content: string(line), TimeoutSec: CommandTimeoutSec})
+		result := daemon.Processor.Process(toolbox.Command{Content: string(line), TimeoutSec: CommandTimeoutSec, ClientID: clientIP})
 		clientConn.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
 		clientConn.Write([]byte(result.CombinedOutput))
 		clientConn.Write([]byte("\r\n"))
@@ -52,7 +52,7 @@ func (daemon *Daemon) StartAndBlockUDP() error {
 		}
 		// Check IP address against (connection) rate limit
 		clientIP := clientAddr.IP.String()
-		if !daemon.rateLimit.Add(clientIP, true) {
+		if !daemon.rateLimitUDP.Add(clientIP, true) {
 			continue
 		}
 
@@ -87,11 +87,12 @@ func (daemon *Daemon) HandleUDPConnection(clientIP string, clientAddr *net.UDPAd
 			return
 		}
 		// Check against conversation rate limit
-		if !daemon.rateLimit.Add(clientIP, true) {
+		if !daemon.rateLimitUDP.Add(clientIP, true) {
 			return
 		}
 		// Process line of command and respond
-		result := daemon.Processor.Process(toolbox.Command{Content: string(line), TimeoutSec: CommandTimeoutSec})
+		// The source address of UDP packet may be forged, hence an incorrect PIN does not get the client banned.
+		result := daemon.Processor.Process(toolbox.Command{Content: string(line), TimeoutSec: CommandTimeoutSec, ClientID: clientIP, SpoofableClientID: true})
 		daemon.udpListener.SetWriteDeadline(time.Now().Add(IOTimeoutSec * time.Second))
 		if _, err := daemon.udpListener.WriteToUDP([]byte(result.CombinedOutput), clientAddr); err != nil {
 			daemon.logger.Warning("HandleUDPConnection", clientIP, err, "failed to write response")
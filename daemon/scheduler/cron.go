@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronFieldRanges are the lowest and highest acceptable values of minute, hour, day of month, month, and day of week.
+var cronFieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+/*
+CronSchedule is a parsed cron-style expression of five space-separated fields - minute, hour, day of month, month, and
+day of week (0 and 7 are both Sunday). Each field may be "*", a number, a range "a-b", either "*" or a range followed by
+a step "/n", or a comma-separated list of them.
+Like cron, if both day of month and day of week are restricted, a day matching either of them is a match.
+*/
+type CronSchedule struct {
+	Expression string // Expression is the original cron-style expression
+
+	allowed       [5]map[int]bool
+	isDOMWildcard bool
+	isDOWWildcard bool
+}
+
+// ParseCronSchedule parses a cron-style expression. See CronSchedule for syntax.
+func ParseCronSchedule(expression string) (*CronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression \"%s\" must have exactly 5 fields", expression)
+	}
+	sched := &CronSchedule{Expression: expression}
+	for i, field := range fields {
+		allowed, err := parseCronField(field, cronFieldRanges[i][0], cronFieldRanges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression \"%s\" field %d - %v", expression, i+1, err)
+		}
+		sched.allowed[i] = allowed
+	}
+	// Sunday may be written as either 0 or 7
+	if sched.allowed[4][7] {
+		sched.allowed[4][0] = true
+	}
+	sched.isDOMWildcard = strings.HasPrefix(fields[2], "*")
+	sched.isDOWWildcard = strings.HasPrefix(fields[4], "*")
+	return sched, nil
+}
+
+// parseCronField returns the set of values allowed by a single field of cron expression.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	allowed := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		// Separate optional step from the range
+		step := 1
+		if slash := strings.Index(part, "/"); slash != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[slash+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("bad step in \"%s\"", part)
+			}
+			part = part[:slash]
+		}
+		// Determine the range
+		from, to := min, max
+		if part != "*" {
+			fromTo := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(fromTo[0]); err != nil {
+				return nil, fmt.Errorf("bad number in \"%s\"", part)
+			}
+			to = from
+			if len(fromTo) == 2 {
+				if to, err = strconv.Atoi(fromTo[1]); err != nil {
+					return nil, fmt.Errorf("bad number in \"%s\"", part)
+				}
+			} else if step > 1 {
+				// "a/n" means from a to the maximum value
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("\"%s\" is not within [%d, %d]", part, min, max)
+		}
+		for i := from; i <= to; i += step {
+			allowed[i] = true
+		}
+	}
+	return allowed, nil
+}
+
+// IsDue returns true only if the schedule matches the minute of the time.
+func (sched *CronSchedule) IsDue(t time.Time) bool {
+	if !sched.allowed[0][t.Minute()] || !sched.allowed[1][t.Hour()] || !sched.allowed[3][int(t.Month())] {
+		return false
+	}
+	domMatch := sched.allowed[2][t.Day()]
+	dowMatch := sched.allowed[4][int(t.Weekday())]
+	switch {
+	case sched.isDOMWildcard && sched.isDOWWildcard:
+		return true
+	case sched.isDOMWildcard:
+		return dowMatch
+	case sched.isDOWWildcard:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
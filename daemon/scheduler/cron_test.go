@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, bad := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"a * * * *", "5-1 * * * *", "*/0 * * * *", "*/a * * * *", "1- * * * *"} {
+		if _, err := ParseCronSchedule(bad); err == nil {
+			t.Fatal("did not error", bad)
+		}
+	}
+	// 2017-12-25 is a Monday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2017, month, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		expression string
+		due        []time.Time
+		notDue     []time.Time
+	}{
+		{"* * * * *", []time.Time{at(12, 25, 0, 0), at(1, 1, 23, 59)}, nil},
+		{"30 7 * * *", []time.Time{at(12, 25, 7, 30)}, []time.Time{at(12, 25, 7, 31), at(12, 25, 8, 30)}},
+		{"*/15 9-17 * * 1-5", []time.Time{at(12, 25, 9, 0), at(12, 25, 17, 45)}, []time.Time{at(12, 25, 9, 10), at(12, 24, 9, 0), at(12, 25, 18, 0)}},
+		{"0 0 1,15 * *", []time.Time{at(12, 1, 0, 0), at(12, 15, 0, 0)}, []time.Time{at(12, 2, 0, 0)}},
+		{"0 12 * 6 7", []time.Time{at(6, 4, 12, 0)}, []time.Time{at(6, 5, 12, 0), at(12, 24, 12, 0)}},
+		{"5/20 * * * *", []time.Time{at(1, 1, 0, 5), at(1, 1, 0, 45)}, []time.Time{at(1, 1, 0, 0), at(1, 1, 0, 25+1)}},
+		// Restricted day of month and day of week match either of them
+		{"0 0 1 * 1", []time.Time{at(12, 1, 0, 0), at(12, 25, 0, 0)}, []time.Time{at(12, 26, 0, 0)}},
+	}
+	for _, test := range tests {
+		sched, err := ParseCronSchedule(test.expression)
+		if err != nil {
+			t.Fatal(test.expression, err)
+		}
+		for _, due := range test.due {
+			if !sched.IsDue(due) {
+				t.Fatal(test.expression, "should be due at", due)
+			}
+		}
+		for _, notDue := range test.notDue {
+			if sched.IsDue(notDue) {
+				t.Fatal(test.expression, "should not be due at", notDue)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/daemon/common"
+	"github.com/HouzuoGuo/laitos/daemon/telegrambot"
+	"github.com/HouzuoGuo/laitos/inet"
+	"github.com/HouzuoGuo/laitos/misc"
+	"github.com/HouzuoGuo/laitos/testingstub"
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const CommandTimeoutSec = 10 * 60 // CommandTimeoutSec is the default timeout of scheduled commands
+
+var DurationStats = misc.NewStats() // DurationStats stores statistics of duration of all scheduled commands.
+
+// Task is a toolbox command that runs on a schedule, its result is delivered to mail recipients and telegram chats.
+type Task struct {
+	Schedule        string   `json:"Schedule"`        // Schedule is a cron-style expression, see CronSchedule for syntax.
+	Command         string   `json:"Command"`         // Command is the toolbox command, it goes through command filters like all other daemons.
+	TimeoutSec      int      `json:"TimeoutSec"`      // TimeoutSec is the number of seconds the command may run
+	MailRecipients  []string `json:"MailRecipients"`  // MailRecipients are addresses that receive command result by mail
+	TelegramChatIDs []int64  `json:"TelegramChatIDs"` // TelegramChatIDs are telegram chats that receive command result
+
+	schedule *CronSchedule
+}
+
+/*
+Daemon runs toolbox commands on a cron-style schedule and delivers their result by mail and telegram. The commands go
+through command processor in the same way as commands received by other daemons.
+*/
+type Daemon struct {
+	Tasks       []*Task                  `json:"Tasks"` // Tasks are the toolbox commands to run
+	Processor   *common.CommandProcessor `json:"-"`     // Processor runs the task commands
+	MailClient  inet.MailClient          `json:"-"`     // MailClient delivers task results to mail recipients
+	TelegramBot *telegrambot.Daemon      `json:"-"`     // TelegramBot delivers task results to telegram chats
+
+	loopIsRunning int32     // Value is 1 only when scheduler loop is running
+	stop          chan bool // Signal scheduler loop to stop
+	logger        misc.Logger
+}
+
+/*
+Initialise validates task configuration and prepares internal states. This function must be called before using the
+daemon.
+*/
+func (daemon *Daemon) Initialise() error {
+	if daemon.Processor == nil || daemon.Processor.IsEmpty() {
+		return fmt.Errorf("scheduler.Initialise: command processor and its filters must be configured")
+	}
+	daemon.logger = misc.Logger{ComponentName: "scheduler", ComponentID: strconv.Itoa(len(daemon.Tasks))}
+	daemon.Processor.SetLogger(daemon.logger)
+	if errs := daemon.Processor.IsSaneForInternet(); len(errs) > 0 {
+		return fmt.Errorf("scheduler.Initialise: %+v", errs)
+	}
+	if len(daemon.Tasks) == 0 {
+		return errors.New("scheduler.Initialise: there are no tasks")
+	}
+	for i, task := range daemon.Tasks {
+		var err error
+		if task.schedule, err = ParseCronSchedule(task.Schedule); err != nil {
+			return fmt.Errorf("scheduler.Initialise: task %d - %v", i, err)
+		}
+		if strings.TrimSpace(task.Command) == "" {
+			return fmt.Errorf("scheduler.Initialise: task %d does not have a command", i)
+		}
+		if len(task.MailRecipients) > 0 && !daemon.MailClient.IsConfigured() {
+			return fmt.Errorf("scheduler.Initialise: task %d has mail recipients but MailClient is not configured", i)
+		}
+		if len(task.TelegramChatIDs) > 0 && (daemon.TelegramBot == nil || daemon.TelegramBot.AuthorizationToken == "") {
+			return fmt.Errorf("scheduler.Initialise: task %d has telegram chats but TelegramBot is not configured", i)
+		}
+		if task.TimeoutSec < 1 {
+			task.TimeoutSec = CommandTimeoutSec
+		}
+	}
+	daemon.stop = make(chan bool)
+	return nil
+}
+
+// RunTask runs the task command and delivers its result. Return the command result.
+func (daemon *Daemon) RunTask(index int) *toolbox.Result {
+	beginTimeNano := time.Now().UnixNano()
+	defer func() {
+		DurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
+	}()
+	task := daemon.Tasks[index]
+	clientID := "task" + strconv.Itoa(index)
+	result := daemon.Processor.Process(toolbox.Command{TimeoutSec: task.TimeoutSec, Content: task.Command, ClientID: clientID})
+	if len(task.MailRecipients) > 0 {
+		if err := daemon.MailClient.Send(inet.OutgoingMailSubjectKeyword+"-scheduler-"+result.Command.Content, result.CombinedOutput, task.MailRecipients...); err != nil {
+			daemon.logger.Warning("RunTask", clientID, err, "failed to send result mail")
+		}
+	}
+	for _, chatID := range task.TelegramChatIDs {
+		if err := daemon.TelegramBot.ReplyTo(chatID, result.CombinedOutput); err != nil {
+			daemon.logger.Warning("RunTask", clientID, err, "failed to send result to telegram chat")
+		}
+	}
+	return result
+}
+
+// runDueTasks runs tasks that are due at the time, each in their own goroutine.
+func (daemon *Daemon) runDueTasks(t time.Time) {
+	for i, task := range daemon.Tasks {
+		if task.schedule.IsDue(t) {
+			daemon.logger.Info("runDueTasks", "task"+strconv.Itoa(i), nil, "task is due according to schedule \"%s\"", task.Schedule)
+			go daemon.RunTask(i)
+		}
+	}
+}
+
+/*
+You may call this function only after having called Initialise()!
+Start scheduler loop and block caller until Stop function is called. Tasks are checked at the beginning of each minute.
+*/
+func (daemon *Daemon) StartAndBlock() error {
+	daemon.logger.Info("StartAndBlock", "", nil, "going to run %d tasks on schedule", len(daemon.Tasks))
+	for {
+		if misc.EmergencyLockDown {
+			atomic.StoreInt32(&daemon.loopIsRunning, 0)
+			return misc.ErrEmergencyLockDown
+		}
+		atomic.StoreInt32(&daemon.loopIsRunning, 1)
+		nextMinute := time.Now().Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-daemon.stop:
+			atomic.StoreInt32(&daemon.loopIsRunning, 0)
+			return nil
+		case <-time.After(time.Until(nextMinute)):
+			daemon.runDueTasks(nextMinute)
+		}
+	}
+}
+
+// Stop previously started scheduler loop.
+func (daemon *Daemon) Stop() {
+	if atomic.CompareAndSwapInt32(&daemon.loopIsRunning, 1, 0) {
+		daemon.stop <- true
+	}
+}
+
+// Run unit tests on scheduler daemon. See TestScheduler_StartAndBlock for daemon setup.
+func TestScheduler(daemon *Daemon, t testingstub.T) {
+	// Run the first task right away
+	result := daemon.RunTask(0)
+	if result.Error != nil || result.CombinedOutput == "" {
+		t.Fatal(result)
+	}
+	// Scheduler loop should successfully start within two seconds
+	var stoppedNormally bool
+	go func() {
+		if err := daemon.StartAndBlock(); err != nil {
+			t.Fatal(err)
+		}
+		stoppedNormally = true
+	}()
+	time.Sleep(2 * time.Second)
+	daemon.Stop()
+	time.Sleep(1 * time.Second)
+	if !stoppedNormally {
+		t.Fatal("did not stop")
+	}
+	// Repeatedly stopping the daemon should have no negative consequence
+	daemon.Stop()
+	daemon.Stop()
+}
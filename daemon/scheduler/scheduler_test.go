@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"github.com/HouzuoGuo/laitos/daemon/common"
+	"strings"
+	"testing"
+)
+
+func TestScheduler_StartAndBlock(t *testing.T) {
+	daemon := Daemon{}
+	if err := daemon.Initialise(); err == nil || !strings.Contains(err.Error(), "filters must be configured") {
+		t.Fatal(err)
+	}
+	daemon.Processor = common.GetInsaneCommandProcessor()
+	if err := daemon.Initialise(); err == nil || !strings.Contains(err.Error(), common.ErrBadProcessorConfig) {
+		t.Fatal(err)
+	}
+	daemon.Processor = common.GetTestCommandProcessor()
+	if err := daemon.Initialise(); err == nil || !strings.Contains(err.Error(), "no tasks") {
+		t.Fatal(err)
+	}
+	daemon.Tasks = []*Task{{Schedule: "bad", Command: "verysecret .s echo hi"}}
+	if err := daemon.Initialise(); err == nil || !strings.Contains(err.Error(), "5 fields") {
+		t.Fatal(err)
+	}
+	daemon.Tasks = []*Task{{Schedule: "* * * * *", Command: "verysecret .s echo hi", TelegramChatIDs: []int64{1}}}
+	if err := daemon.Initialise(); err == nil || !strings.Contains(err.Error(), "TelegramBot") {
+		t.Fatal(err)
+	}
+	daemon.Tasks = []*Task{{Schedule: "0 0 1 1 *", Command: "verysecret .s echo hi"}}
+	if err := daemon.Initialise(); err != nil || daemon.Tasks[0].TimeoutSec != CommandTimeoutSec {
+		t.Fatal(err)
+	}
+	TestScheduler(&daemon, t)
+}
@@ -20,8 +20,8 @@ const CommandTimeoutSec = 120 // CommandTimeoutSec is the default command timeou
 var DurationStats = misc.NewStats() // DurationStats stores statistics of duration of all processed mails.
 
 /*
-CommandRunner looks for exactly one feature command from an incoming mail, runs it and reply the sender with command
-results. Usually used in combination of laitos' own SMTP daemon, but it can also work independently with another MTA
+CommandRunner looks for exactly one feature command (which may be a batch of commands) from an incoming mail, runs it and
+reply the sender with command results. Usually used in combination of laitos' own SMTP daemon, but it can also work independently with another MTA
 such as the forwarding-mail-to-program mechanism from postfix.
 */
 type CommandRunner struct {
@@ -40,6 +40,8 @@ func (runner *CommandRunner) Initialise() error {
 	}
 	runner.logger = misc.Logger{ComponentName: "mailcmd", ComponentID: runner.ReplyMailClient.MailFrom}
 	runner.Processor.SetLogger(runner.logger)
+	// Most mails are not commands, their senders should not be banned for not having a PIN.
+	runner.Processor.ExemptFromBan = true
 	if errs := runner.Processor.IsSaneForInternet(); len(errs) > 0 {
 		return fmt.Errorf("mailcmd.Process: %+v", errs)
 	}
@@ -116,6 +118,7 @@ func (runner *CommandRunner) Process(mailContent []byte, replyAddresses ...strin
 		result := runner.Processor.Process(toolbox.Command{
 			Content:    string(body),
 			TimeoutSec: CommandTimeoutSec,
+			ClientID:   prop.FromAddress,
 		})
 		// If this part does not have a PIN/shortcut match, simply move on to the next part.
 		if result.Error == filter.ErrPINAndShortcutNotFound {
@@ -72,10 +72,12 @@ func (daemon *Daemon) Initialise() error {
 		UnitSecs: RateLimitIntervalSec,
 	}
 	daemon.rateLimitTCP.Initialise()
+	// UDP clients may carry spoofed IP, hence the rate limit does not ban.
 	daemon.rateLimitUDP = &misc.RateLimit{
-		Logger:   daemon.logger,
-		MaxCount: daemon.PerIPLimit * 100,
-		UnitSecs: RateLimitIntervalSec,
+		Logger:        daemon.logger,
+		MaxCount:      daemon.PerIPLimit * 100,
+		UnitSecs:      RateLimitIntervalSec,
+		ExemptFromBan: true,
 	}
 	daemon.rateLimitUDP.Initialise()
 
@@ -153,13 +153,13 @@ func (bot *Daemon) ProcessMessages(updates APIUpdates) {
 			continue
 		}
 		// Find and run command in background
-		go func(ding APIUpdate, beginTimeNano int64) {
-			result := bot.Processor.Process(toolbox.Command{TimeoutSec: CommandTimeoutSec, Content: ding.Message.Text})
+		go func(ding APIUpdate, origin string, beginTimeNano int64) {
+			result := bot.Processor.Process(toolbox.Command{TimeoutSec: CommandTimeoutSec, Content: ding.Message.Text, ClientID: origin})
 			if err := bot.ReplyTo(ding.Message.Chat.ID, result.CombinedOutput); err != nil {
 				bot.logger.Warning("ProcessMessages", ding.Message.Chat.UserName, err, "failed to send message reply")
 			}
 			DurationStats.Trigger(float64(time.Now().UnixNano() - beginTimeNano))
-		}(ding, beginTimeNano)
+		}(ding, origin, beginTimeNano)
 	}
 }
 
@@ -39,6 +39,7 @@ type HTTPResponse struct {
 	StatusCode int
 	Header     http.Header
 	Body       []byte
+	TLS        *tls.ConnectionState // TLS connection details, it is nil for plain HTTP.
 }
 
 // If HTTP status is not 2xx, return an error. Otherwise return nil.
@@ -98,5 +99,6 @@ func DoHTTP(reqParam HTTPRequest, urlTemplate string, urlValues ...interface{})
 	resp.Body, err = ioutil.ReadAll(response.Body)
 	resp.Header = response.Header
 	resp.StatusCode = response.StatusCode
+	resp.TLS = response.TLS
 	return
 }
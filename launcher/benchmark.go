@@ -52,6 +52,8 @@ func (bench *Benchmark) RunBenchmarkAndProfiler() {
 			// There is no benchmark for maintenance daemon
 		case PlainSocketName:
 			go bench.BenchmarkPlainSocketDaemon()
+		case SchedulerName:
+			// There is no benchmark for scheduler daemon
 		case SMTPDName:
 			go bench.BenchmarkSMTPDaemon()
 		case SOCKDName:
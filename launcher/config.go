@@ -10,6 +10,7 @@ import (
 	"github.com/HouzuoGuo/laitos/daemon/httpd/handler"
 	"github.com/HouzuoGuo/laitos/daemon/maintenance"
 	"github.com/HouzuoGuo/laitos/daemon/plainsocket"
+	"github.com/HouzuoGuo/laitos/daemon/scheduler"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd/mailcmd"
 	"github.com/HouzuoGuo/laitos/daemon/sockd"
@@ -30,12 +31,42 @@ type StandardFilters struct {
 	// For input command content
 	TranslateSequences filter.TranslateSequences `json:"TranslateSequences"`
 	PINAndShortcuts    filter.PINAndShortcuts    `json:"PINAndShortcuts"`
+	TOTP               filter.TOTP               `json:"TOTP"`
+	TriggerAccess      filter.TriggerAccess      `json:"TriggerAccess"`
 
 	// For command execution result
 	NotifyViaEmail filter.NotifyViaEmail `json:"NotifyViaEmail"`
 	LintText       filter.LintText       `json:"LintText"`
 }
 
+/*
+GetCommandProcessor assembles a command processor from the filters and features. If one-time code is configured while
+PIN and shortcuts are not, the one-time code is used in place of PIN.
+*/
+func (filters *StandardFilters) GetCommandProcessor(features *toolbox.FeatureSet, auditLog *misc.AuditLog) *common.CommandProcessor {
+	cmdFilters := make([]filter.CommandFilter, 0, 3)
+	if filters.PINAndShortcuts.IsConfigured() || !filters.TOTP.IsConfigured() {
+		cmdFilters = append(cmdFilters, &filters.PINAndShortcuts)
+	}
+	if filters.TOTP.IsConfigured() {
+		filters.TOTP.Initialise()
+		cmdFilters = append(cmdFilters, &filters.TOTP)
+	}
+	cmdFilters = append(cmdFilters, &filters.TranslateSequences)
+	return &common.CommandProcessor{
+		Features:       features,
+		CommandFilters: cmdFilters,
+		ResultFilters: []filter.ResultFilter{
+			&filter.ResetCombinedText{}, // this is mandatory but not configured by user's config file
+			&filters.LintText,
+			&filter.SayEmptyOutput{}, // this is mandatory but not configured by user's config file
+			&filters.NotifyViaEmail,
+		},
+		TriggerAccess: &filters.TriggerAccess,
+		AuditLog:      auditLog,
+	}
+}
+
 // Configure path to HTTP handlers and handler themselves.
 type HTTPHandlers struct {
 	InformationEndpoint string `json:"InformationEndpoint"`
@@ -45,6 +76,8 @@ type HTTPHandlers struct {
 
 	CommandFormEndpoint string `json:"CommandFormEndpoint"`
 
+	DNSOverHTTPSEndpoint string `json:"DNSOverHTTPSEndpoint"`
+
 	GitlabBrowserEndpoint       string                      `json:"GitlabBrowserEndpoint"`
 	GitlabBrowserEndpointConfig handler.HandleGitlabBrowser `json:"GitlabBrowserEndpointConfig"`
 
@@ -61,6 +94,8 @@ type HTTPHandlers struct {
 	MicrosoftBotEndpoint3       string                     `json:"MicrosoftBotEndpoint3"`
 	MicrosoftBotEndpointConfig3 handler.HandleMicrosoftBot `json:"MicrosoftBotEndpointConfig3"`
 
+	PrometheusEndpoint string `json:"PrometheusEndpoint"`
+
 	WebProxyEndpoint string `json:"WebProxyEndpoint"`
 
 	TwilioSMSEndpoint        string                       `json:"TwilioSMSEndpoint"`
@@ -75,8 +110,10 @@ type Config struct {
 		structure because certain toolbox features (such as AES file decryption) may hold large amount of data in
 		memory. Therefore, all daemon preparation and initialisation routines operate on reference to this FeatureSet.
 	*/
-	Features   *toolbox.FeatureSet `json:"Features"`
-	MailClient inet.MailClient     `json:"MailClient"` // MailClient is the common client configuration for sending notification emails and mail command runner results.
+	Features    *toolbox.FeatureSet `json:"Features"`
+	MailClient  inet.MailClient     `json:"MailClient"`  // MailClient is the common client configuration for sending notification emails and mail command runner results.
+	AuditLog    *misc.AuditLog      `json:"AuditLog"`    // AuditLog keeps a persistent record of commands processed by all daemons.
+	BanRegistry *misc.BanRegistry   `json:"BanRegistry"` // BanRegistry bans clients who repeatedly fail PIN verification or exceed rate limits.
 
 	Maintenance *maintenance.Daemon `json:"Maintenance"` // Daemon configures behaviour of periodic health-check/system maintenance
 
@@ -94,6 +131,9 @@ type Config struct {
 	PlainSocketDaemon  *plainsocket.Daemon `json:"PlainSocketDaemon"`  // Plain text protocol TCP and UDP daemon configuration
 	PlainSocketFilters StandardFilters     `json:"PlainSocketFilters"` // Plain text daemon filter configuration
 
+	Scheduler        *scheduler.Daemon `json:"Scheduler"`        // Scheduler runs toolbox commands on a schedule
+	SchedulerFilters StandardFilters   `json:"SchedulerFilters"` // SchedulerFilters configure command processor for scheduled commands
+
 	SockDaemon *sockd.Daemon `json:"SockDaemon"` // Intentionally undocumented
 
 	TelegramBot     *telegrambot.Daemon `json:"TelegramBot"`     // Telegram bot configuration
@@ -101,13 +141,17 @@ type Config struct {
 
 	SupervisorNotificationRecipients []string `json:"SupervisorNotificationRecipients"` // Email addresses of supervisor notification recipients
 
-	logger                misc.Logger // logger handles log output from configuration serialisation and initialisation routines.
+	logger                misc.Logger            // logger handles log output from configuration serialisation and initialisation routines.
+	sections              map[string]interface{} // sections are the top-level configuration sections in their original JSON form.
+	reloadMutex           sync.Mutex             // reloadMutex prevents concurrent reloading of configuration.
+	banRegistryInit       sync.Once
 	maintenanceInit       sync.Once
 	dnsDaemonInit         sync.Once
 	httpDaemonInit        sync.Once
 	mailCommandRunnerInit sync.Once
 	mailDaemonInit        sync.Once
 	plainSocketDaemonInit sync.Once
+	schedulerInit         sync.Once
 	sockDaemonInit        sync.Once
 	telegramBotInit       sync.Once
 }
@@ -125,6 +169,12 @@ func (config *Config) Initialise() error {
 	if config.Features == nil {
 		config.Features = &toolbox.FeatureSet{}
 	}
+	if config.AuditLog == nil {
+		config.AuditLog = &misc.AuditLog{}
+	}
+	if config.BanRegistry == nil {
+		config.BanRegistry = &misc.BanRegistry{}
+	}
 	if config.DNSDaemon == nil {
 		config.DNSDaemon = &dnsd.Daemon{}
 	}
@@ -140,6 +190,9 @@ func (config *Config) Initialise() error {
 	if config.PlainSocketDaemon == nil {
 		config.PlainSocketDaemon = &plainsocket.Daemon{}
 	}
+	if config.Scheduler == nil {
+		config.Scheduler = &scheduler.Daemon{}
+	}
 	if config.SockDaemon == nil {
 		config.SockDaemon = &sockd.Daemon{}
 	}
@@ -150,9 +203,18 @@ func (config *Config) Initialise() error {
 	config.HTTPFilters.NotifyViaEmail.MailClient = config.MailClient
 	config.MailFilters.NotifyViaEmail.MailClient = config.MailClient
 	config.PlainSocketFilters.NotifyViaEmail.MailClient = config.MailClient
+	config.SchedulerFilters.NotifyViaEmail.MailClient = config.MailClient
 	config.TelegramFilters.NotifyViaEmail.MailClient = config.MailClient
-	// SendMail feature also shares the common mail client
+	// SendMail and MQTT features also share the common mail client
 	config.Features.SendMail.MailClient = config.MailClient
+	config.Features.MQTT.MailClient = config.MailClient
+	// EnvControl feature inspects the common audit log
+	if err := config.AuditLog.Initialise(); err != nil {
+		return err
+	}
+	config.Features.EnvControl.AuditLog = config.AuditLog
+	// EnvControl feature may reload configuration from the file
+	config.Features.EnvControl.ReloadConfig = config.ReloadFromFile
 	if err := config.Features.Initialise(); err != nil {
 		return err
 	}
@@ -169,12 +231,31 @@ func (config *Config) DeserialiseFromJSON(in []byte) error {
 	if err := json.Unmarshal(in, config); err != nil {
 		return err
 	}
+	// Remember the original sections to tell which of them have changed when configuration is reloaded
+	if err := json.Unmarshal(in, &config.sections); err != nil {
+		return err
+	}
 	if err := config.Initialise(); err != nil {
 		return err
 	}
 	return nil
 }
 
+/*
+GetBanRegistry initialises the ban registry from configuration and makes it effective for all daemons, then returns it.
+Call this function before starting daemons.
+*/
+func (config *Config) GetBanRegistry() *misc.BanRegistry {
+	config.banRegistryInit.Do(func() {
+		if err := config.BanRegistry.Initialise(); err != nil {
+			config.logger.Abort("GetBanRegistry", "", err, "failed to initialise")
+			return
+		}
+		misc.Bans = config.BanRegistry
+	})
+	return config.BanRegistry
+}
+
 // Construct a DNS daemon from configuration and return.
 func (config *Config) GetDNSD() *dnsd.Daemon {
 	config.dnsDaemonInit.Do(func() {
@@ -205,19 +286,7 @@ func (config *Config) GetMaintenance() *maintenance.Daemon {
 func (config *Config) GetHTTPD() *httpd.Daemon {
 	config.httpDaemonInit.Do(func() {
 		// Assemble command processor from features and filters
-		config.HTTPDaemon.Processor = &common.CommandProcessor{
-			Features: config.Features,
-			CommandFilters: []filter.CommandFilter{
-				&config.HTTPFilters.PINAndShortcuts,
-				&config.HTTPFilters.TranslateSequences,
-			},
-			ResultFilters: []filter.ResultFilter{
-				&filter.ResetCombinedText{}, // this is mandatory but not configured by user's config file
-				&config.HTTPFilters.LintText,
-				&filter.SayEmptyOutput{}, // this is mandatory but not configured by user's config file
-				&config.HTTPFilters.NotifyViaEmail,
-			},
-		}
+		config.HTTPDaemon.Processor = config.HTTPFilters.GetCommandProcessor(config.Features, config.AuditLog)
 		// Make handler factories
 		handlers := httpd.HandlerCollection{}
 		if config.HTTPHandlers.InformationEndpoint != "" {
@@ -251,6 +320,10 @@ func (config *Config) GetHTTPD() *httpd.Daemon {
 		if config.HTTPHandlers.CommandFormEndpoint != "" {
 			handlers[config.HTTPHandlers.CommandFormEndpoint] = &handler.HandleCommandForm{}
 		}
+		if config.HTTPHandlers.DNSOverHTTPSEndpoint != "" {
+			// DNS-over-HTTPS queries are answered by DNS daemon, whose configuration must be present.
+			handlers[config.HTTPHandlers.DNSOverHTTPSEndpoint] = &handler.HandleDNSOverHTTPS{DNSDaemon: config.GetDNSD()}
+		}
 		if config.HTTPHandlers.GitlabBrowserEndpoint != "" {
 			config.HTTPHandlers.GitlabBrowserEndpointConfig.MailClient = config.MailClient
 			handlers[config.HTTPHandlers.GitlabBrowserEndpoint] = &config.HTTPHandlers.GitlabBrowserEndpointConfig
@@ -278,6 +351,9 @@ func (config *Config) GetHTTPD() *httpd.Daemon {
 			hand := config.HTTPHandlers.MicrosoftBotEndpointConfig3
 			handlers[config.HTTPHandlers.MicrosoftBotEndpoint3] = &hand
 		}
+		if config.HTTPHandlers.PrometheusEndpoint != "" {
+			handlers[config.HTTPHandlers.PrometheusEndpoint] = &handler.HandlePrometheus{}
+		}
 		if proxyEndpoint := config.HTTPHandlers.WebProxyEndpoint; proxyEndpoint != "" {
 			handlers[proxyEndpoint] = &handler.HandleWebProxy{OwnEndpoint: proxyEndpoint}
 		}
@@ -322,19 +398,7 @@ independent mail command runner is useful in certain scenarios, such as integrat
 func (config *Config) GetMailCommandRunner() *mailcmd.CommandRunner {
 	config.mailCommandRunnerInit.Do(func() {
 		// Assemble command processor from features and filters
-		config.MailCommandRunner.Processor = &common.CommandProcessor{
-			Features: config.Features,
-			CommandFilters: []filter.CommandFilter{
-				&config.MailFilters.PINAndShortcuts,
-				&config.MailFilters.TranslateSequences,
-			},
-			ResultFilters: []filter.ResultFilter{
-				&filter.ResetCombinedText{}, // this is mandatory but not configured by user's config file
-				&config.MailFilters.LintText,
-				&filter.SayEmptyOutput{}, // this is mandatory but not configured by user's config file
-				&config.MailFilters.NotifyViaEmail,
-			},
-		}
+		config.MailCommandRunner.Processor = config.MailFilters.GetCommandProcessor(config.Features, config.AuditLog)
 		config.MailCommandRunner.ReplyMailClient = config.MailClient
 	})
 	return config.MailCommandRunner
@@ -363,19 +427,7 @@ It will use common mail client for sending outgoing emails.
 func (config *Config) GetPlainSocketDaemon() *plainsocket.Daemon {
 	config.plainSocketDaemonInit.Do(func() {
 		// Assemble command processor from features and filters
-		config.PlainSocketDaemon.Processor = &common.CommandProcessor{
-			Features: config.Features,
-			CommandFilters: []filter.CommandFilter{
-				&config.PlainSocketFilters.PINAndShortcuts,
-				&config.PlainSocketFilters.TranslateSequences,
-			},
-			ResultFilters: []filter.ResultFilter{
-				&filter.ResetCombinedText{}, // this is mandatory but not configured by user's config file
-				&config.PlainSocketFilters.LintText,
-				&filter.SayEmptyOutput{}, // this is mandatory but not configured by user's config file
-				&config.PlainSocketFilters.NotifyViaEmail,
-			},
-		}
+		config.PlainSocketDaemon.Processor = config.PlainSocketFilters.GetCommandProcessor(config.Features, config.AuditLog)
 		// Call initialise so that daemon is ready to start
 		if err := config.PlainSocketDaemon.Initialise(); err != nil {
 			config.logger.Abort("GetPlainSocketDaemon", "", err, "failed to initialise")
@@ -385,6 +437,24 @@ func (config *Config) GetPlainSocketDaemon() *plainsocket.Daemon {
 	return config.PlainSocketDaemon
 }
 
+/*
+Construct a scheduler daemon that runs toolbox commands on a schedule, and return.
+It will use common mail client and telegram bot's authorization token to deliver command results.
+*/
+func (config *Config) GetScheduler() *scheduler.Daemon {
+	config.schedulerInit.Do(func() {
+		// Assemble command processor from features and filters
+		config.Scheduler.Processor = config.SchedulerFilters.GetCommandProcessor(config.Features, config.AuditLog)
+		config.Scheduler.MailClient = config.MailClient
+		config.Scheduler.TelegramBot = config.TelegramBot
+		if err := config.Scheduler.Initialise(); err != nil {
+			config.logger.Abort("GetScheduler", "", err, "failed to initialise")
+			return
+		}
+	})
+	return config.Scheduler
+}
+
 // Intentionally undocumented
 func (config *Config) GetSockDaemon() *sockd.Daemon {
 	config.sockDaemonInit.Do(func() {
@@ -401,19 +471,7 @@ func (config *Config) GetSockDaemon() *sockd.Daemon {
 func (config *Config) GetTelegramBot() *telegrambot.Daemon {
 	config.telegramBotInit.Do(func() {
 		// Assemble telegram bot from features and filters
-		config.TelegramBot.Processor = &common.CommandProcessor{
-			Features: config.Features,
-			CommandFilters: []filter.CommandFilter{
-				&config.TelegramFilters.PINAndShortcuts,
-				&config.TelegramFilters.TranslateSequences,
-			},
-			ResultFilters: []filter.ResultFilter{
-				&filter.ResetCombinedText{}, // this is mandatory but not configured by user's config file
-				&config.TelegramFilters.LintText,
-				&filter.SayEmptyOutput{}, // this is mandatory but not configured by user's config file
-				&config.TelegramFilters.NotifyViaEmail,
-			},
-		}
+		config.TelegramBot.Processor = config.TelegramFilters.GetCommandProcessor(config.Features, config.AuditLog)
 		if err := config.TelegramBot.Initialise(); err != nil {
 			config.logger.Abort("GetTelegramBot", "", err, "failed to initialise")
 			return
@@ -5,6 +5,7 @@ import (
 	"github.com/HouzuoGuo/laitos/daemon/httpd"
 	"github.com/HouzuoGuo/laitos/daemon/maintenance"
 	"github.com/HouzuoGuo/laitos/daemon/plainsocket"
+	"github.com/HouzuoGuo/laitos/daemon/scheduler"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd"
 	"github.com/HouzuoGuo/laitos/daemon/smtpd/mailcmd"
 	"github.com/HouzuoGuo/laitos/daemon/sockd"
@@ -91,6 +92,7 @@ var sampleConfigJSON = `
       "ClientAppID": "dummy id",
       "ClientAppSecret": "dummy secret"
     },
+    "PrometheusEndpoint": "/prometheus",
     "TwilioCallEndpoint": "/call_greeting",
     "TwilioCallEndpointConfig": {
       "CallGreeting": "Hi there"
@@ -186,6 +188,26 @@ var sampleConfigJSON = `
       ]
     }
   },
+  "Scheduler": {
+    "Tasks": [
+      {
+        "Schedule": "0 7 * * *",
+        "Command": "verysecret .secho scheduled",
+        "MailRecipients": [
+          "howard@localhost"
+        ]
+      }
+    ]
+  },
+  "SchedulerFilters": {
+    "LintText": {
+      "MaxLength": 4096,
+      "TrimSpaces": true
+    },
+    "PINAndShortcuts": {
+      "PIN": "verysecret"
+    }
+  },
   "SockDaemon": {
     "Address": "127.0.0.1",
     "Password": "1234567",
@@ -217,6 +239,12 @@ var sampleConfigJSON = `
         "telegramshortcut": ".secho telegramshortcut"
       }
     },
+    "TriggerAccess": {
+      "DenyTriggers": [
+        ".e kill",
+        ".e stop"
+      ]
+    },
     "TranslateSequences": {
       "Sequences": [
         [
@@ -259,6 +287,8 @@ func TestConfig(t *testing.T) {
 	plainsocket.TestTCPServer(config.GetPlainSocketDaemon(), t)
 	plainsocket.TestUDPServer(config.GetPlainSocketDaemon(), t)
 
+	scheduler.TestScheduler(config.GetScheduler(), t)
+
 	sockd.TestSockd(config.GetSockDaemon(), t)
 
 	telegrambot.TestTelegramBot(config.GetTelegramBot(), t)
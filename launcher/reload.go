@@ -0,0 +1,189 @@
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/daemon/common"
+	"github.com/HouzuoGuo/laitos/daemon/httpd/handler"
+	"github.com/HouzuoGuo/laitos/misc"
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ReloadedConfigSections are the top-level configuration sections that take effect in running daemons upon configuration
+reload, all other sections only take effect after a restart.
+*/
+var ReloadedConfigSections = map[string]bool{
+	"Features":           true,
+	"HTTPFilters":        true,
+	"MailFilters":        true,
+	"PlainSocketFilters": true,
+	"SchedulerFilters":   true,
+	"TelegramFilters":    true,
+}
+
+// RestartRequiredBy maps a top-level configuration section to the daemons that must restart to apply changes of the section.
+var RestartRequiredBy = map[string][]string{
+	"AuditLog":          {HTTPDName, InsecureHTTPDName, PlainSocketName, SchedulerName, SMTPDName, TelegramName},
+	"BanRegistry":       {DNSDName, HTTPDName, InsecureHTTPDName, PlainSocketName, SMTPDName, SOCKDName, TelegramName},
+	"DNSDaemon":         {DNSDName, HTTPDName, InsecureHTTPDName, SOCKDName},
+	"HTTPDaemon":        {HTTPDName, InsecureHTTPDName},
+	"HTTPHandlers":      {HTTPDName, InsecureHTTPDName},
+	"MailClient":        {HTTPDName, InsecureHTTPDName, MaintenanceName, SchedulerName, SMTPDName},
+	"MailCommandRunner": {SMTPDName},
+	"MailDaemon":        {SMTPDName},
+	"Maintenance":       {MaintenanceName},
+	"PlainSocketDaemon": {PlainSocketName},
+	"Scheduler":         {SchedulerName},
+	"SockDaemon":        {SOCKDName},
+	"TelegramBot":       {SchedulerName, TelegramName},
+}
+
+/*
+Reload deserialises new configuration from JSON input, validates it, and then replaces features and filters of all
+command processors that have been constructed from this configuration. If the new configuration is invalid, nothing is
+replaced and an error is returned.
+Return names of daemons that must restart to apply changes that cannot be reloaded, such as listener address and port.
+*/
+func (config *Config) Reload(in []byte) (restartDaemons []string, err error) {
+	config.reloadMutex.Lock()
+	defer config.reloadMutex.Unlock()
+	newConfig := &Config{}
+	// Features of an invalid configuration are never used, release their resources such as browser instances.
+	defer func() {
+		if err != nil {
+			releaseFeatures(newConfig.Features)
+		}
+	}()
+	if err = newConfig.DeserialiseFromJSON(in); err != nil {
+		return
+	}
+	// The running audit log has to continue its hash chain, hence it is shared by the new features and processors.
+	newConfig.Features.EnvControl.AuditLog = config.AuditLog
+	newConfig.Features.EnvControl.ReloadConfig = config.Features.EnvControl.ReloadConfig
+	// Construct new command processors and make sure all of them are sane before replacing any of the running ones
+	type reloadTarget struct {
+		name    string
+		running *common.CommandProcessor
+		filters *StandardFilters
+		newProc *common.CommandProcessor
+	}
+	targets := []*reloadTarget{
+		{name: HTTPDName, running: config.HTTPDaemon.Processor, filters: &newConfig.HTTPFilters},
+		{name: SMTPDName, running: config.MailCommandRunner.Processor, filters: &newConfig.MailFilters},
+		{name: PlainSocketName, running: config.PlainSocketDaemon.Processor, filters: &newConfig.PlainSocketFilters},
+		{name: SchedulerName, running: config.Scheduler.Processor, filters: &newConfig.SchedulerFilters},
+		{name: TelegramName, running: config.TelegramBot.Processor, filters: &newConfig.TelegramFilters},
+	}
+	for _, target := range targets {
+		if target.running == nil {
+			continue
+		}
+		target.newProc = target.filters.GetCommandProcessor(newConfig.Features, config.AuditLog)
+		if errs := target.newProc.IsSaneForInternet(); len(errs) > 0 {
+			err = fmt.Errorf("Reload: new configuration of %s is not sane - %+v", target.name, errs)
+			return
+		}
+	}
+	previousInFlight := make([]*sync.WaitGroup, 0, len(targets))
+	for _, target := range targets {
+		if target.newProc != nil {
+			previousInFlight = append(previousInFlight, target.running.Reload(target.newProc))
+			config.logger.Info("Reload", target.name, nil, "reloaded features and filters")
+		}
+	}
+	// The new filters are owned by the new configuration and processors, only the features are kept for the next reload.
+	previousFeatures := config.Features
+	config.Features = newConfig.Features
+	config.logger.Info("Reload", "", nil, "enabled features are - %v", config.Features.GetTriggers())
+	// Health checks move on to the new features too, so that they do not test the released ones.
+	if config.Maintenance != nil {
+		config.Maintenance.SetFeaturesToTest(config.Features)
+	}
+	if info, isInfo := config.HTTPDaemon.HandlerCollection[config.HTTPHandlers.InformationEndpoint].(*handler.HandleSystemInfo); isInfo {
+		info.FeaturesToCheck = config.Features
+	}
+	// Release the previous features after commands and jobs that are still using them have finished.
+	go func() {
+		for _, inFlight := range previousInFlight {
+			inFlight.Wait()
+		}
+		releaseFeatures(previousFeatures)
+	}()
+	// Find out the daemons affected by changes that are not reloaded
+	restartDaemonNames := make(map[string]struct{})
+	for section := range mergeSectionNames(config.sections, newConfig.sections) {
+		if ReloadedConfigSections[section] {
+			if newSection, exists := newConfig.sections[section]; exists {
+				config.sections[section] = newSection
+			} else {
+				delete(config.sections, section)
+			}
+		} else if !reflect.DeepEqual(config.sections[section], newConfig.sections[section]) {
+			config.logger.Warning("Reload", section, nil, "changes to this section require a restart")
+			for _, name := range RestartRequiredBy[section] {
+				restartDaemonNames[name] = struct{}{}
+			}
+		}
+	}
+	restartDaemons = make([]string, 0, len(restartDaemonNames))
+	for name := range restartDaemonNames {
+		restartDaemons = append(restartDaemons, name)
+	}
+	sort.Strings(restartDaemons)
+	return
+}
+
+/*
+releaseFeatures stops the browser instances and MQTT subscriptions of features that are no longer used. They are the
+only resources (renderer processes and broker connections) kept beyond the commands that use them, other features free
+their resources as soon as each command finishes.
+*/
+func releaseFeatures(features *toolbox.FeatureSet) {
+	if features == nil {
+		return
+	}
+	if features.Browser.IsConfigured() {
+		features.Browser.Renderers.KillAll()
+	}
+	features.MQTT.StopSubscriptions()
+}
+
+// mergeSectionNames returns the union of section names from both configuration sections.
+func mergeSectionNames(a, b map[string]interface{}) map[string]struct{} {
+	ret := make(map[string]struct{})
+	for name := range a {
+		ret[name] = struct{}{}
+	}
+	for name := range b {
+		ret[name] = struct{}{}
+	}
+	return ret
+}
+
+/*
+ReloadFromFile re-reads the configuration file that launched this program and reloads features and filters from it.
+Return a human-readable description of the outcome.
+*/
+func (config *Config) ReloadFromFile() (string, error) {
+	if misc.ConfigFilePath == "" {
+		return "", errors.New("ReloadFromFile: the program was not launched from a configuration file")
+	}
+	configBytes, err := ioutil.ReadFile(misc.ConfigFilePath)
+	if err != nil {
+		return "", err
+	}
+	restartDaemons, err := config.Reload(configBytes)
+	if err != nil {
+		return "", err
+	}
+	if len(restartDaemons) == 0 {
+		return "OK - reloaded features and filters", nil
+	}
+	return "OK - reloaded features and filters, restart to apply other changes to: " + strings.Join(restartDaemons, ", "), nil
+}
@@ -0,0 +1,103 @@
+package launcher
+
+import (
+	"github.com/HouzuoGuo/laitos/daemon/httpd"
+	"github.com/HouzuoGuo/laitos/daemon/httpd/handler"
+	"github.com/HouzuoGuo/laitos/daemon/maintenance"
+	"github.com/HouzuoGuo/laitos/toolbox"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const reloadConfigJSON = `{
+  "PlainSocketDaemon": {
+    "Address": "127.0.0.1",
+    "TCPPort": %PORT%
+  },
+  "PlainSocketFilters": {
+    "LintText": {
+      "MaxLength": 35,
+      "TrimSpaces": true
+    },
+    "PINAndShortcuts": {
+      "PIN": "%PIN%"
+    }
+  }
+}`
+
+func makeReloadConfigJSON(port, pin string) []byte {
+	return []byte(strings.NewReplacer("%PORT%", port, "%PIN%", pin).Replace(reloadConfigJSON))
+}
+
+func TestConfig_Reload(t *testing.T) {
+	var config Config
+	if err := config.DeserialiseFromJSON(makeReloadConfigJSON("18321", "oldsecret")); err != nil {
+		t.Fatal(err)
+	}
+	proc := config.GetPlainSocketDaemon().Processor
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "oldsecret.s echo hi"}); result.Error != nil || result.CombinedOutput != "hi" {
+		t.Fatal(result)
+	}
+	// Invalid JSON does not change anything
+	if _, err := config.Reload([]byte("{")); err == nil {
+		t.Fatal("did not error")
+	}
+	// Insane configuration does not change anything
+	if _, err := config.Reload(makeReloadConfigJSON("18321", "short")); err == nil {
+		t.Fatal("did not error")
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "oldsecret.s echo hi"}); result.Error != nil || result.CombinedOutput != "hi" {
+		t.Fatal(result)
+	}
+	// Change of PIN takes effect right away
+	restartDaemons, err := config.Reload(makeReloadConfigJSON("18321", "newsecret"))
+	if err != nil || len(restartDaemons) != 0 {
+		t.Fatal(restartDaemons, err)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "oldsecret.s echo hi"}); result.Error == nil {
+		t.Fatal(result)
+	}
+	if result := proc.Process(toolbox.Command{TimeoutSec: 5, Content: "newsecret.s echo hi"}); result.Error != nil || result.CombinedOutput != "hi" {
+		t.Fatal(result)
+	}
+	// Change of port requires a restart
+	restartDaemons, err = config.Reload(makeReloadConfigJSON("18322", "newsecret"))
+	if err != nil || !reflect.DeepEqual(restartDaemons, []string{PlainSocketName}) {
+		t.Fatal(restartDaemons, err)
+	}
+	// The restart is still required until it actually happens
+	restartDaemons, err = config.Reload(makeReloadConfigJSON("18322", "newsecret"))
+	if err != nil || !reflect.DeepEqual(restartDaemons, []string{PlainSocketName}) {
+		t.Fatal(restartDaemons, err)
+	}
+	// Features may reload the configuration too
+	if config.Features.EnvControl.ReloadConfig == nil {
+		t.Fatal("reload function is not assigned")
+	}
+}
+
+func TestConfig_ReloadHealthCheck(t *testing.T) {
+	var config Config
+	if err := config.DeserialiseFromJSON(makeReloadConfigJSON("18323", "oldsecret")); err != nil {
+		t.Fatal(err)
+	}
+	config.GetPlainSocketDaemon()
+	// Health checks are set up the same way as GetMaintenance and GetHTTPD do
+	var maint maintenance.Daemon
+	maint.FeaturesToTest = config.Features
+	config.Maintenance = &maint
+	info := &handler.HandleSystemInfo{FeaturesToCheck: config.Features}
+	config.HTTPHandlers.InformationEndpoint = "/info"
+	config.HTTPDaemon.HandlerCollection = httpd.HandlerCollection{"/info": info}
+	previousFeatures := config.Features
+	if _, err := config.Reload(makeReloadConfigJSON("18323", "newsecret")); err != nil {
+		t.Fatal(err)
+	}
+	if config.Features == previousFeatures || maint.FeaturesToTest != config.Features || info.FeaturesToCheck != config.Features {
+		t.Fatal("health checks did not move on to the new features")
+	}
+	if err := maint.FeaturesToTest.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"github.com/HouzuoGuo/laitos/misc"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -23,6 +26,7 @@ const (
 	InsecureHTTPDName = "insecurehttpd"
 	MaintenanceName   = "maintenance"
 	PlainSocketName   = "plainsocket"
+	SchedulerName     = "scheduler"
 	SMTPDName         = "smtpd"
 	SOCKDName         = "sockd"
 	TelegramName      = "telegram"
@@ -39,10 +43,10 @@ const (
 )
 
 // AllDaemons is an unsorted list of string daemon names.
-var AllDaemons = []string{DNSDName, HTTPDName, InsecureHTTPDName, MaintenanceName, PlainSocketName, SMTPDName, SOCKDName, TelegramName}
+var AllDaemons = []string{DNSDName, HTTPDName, InsecureHTTPDName, MaintenanceName, PlainSocketName, SchedulerName, SMTPDName, SOCKDName, TelegramName}
 
 // ShedOrder is the sequence of daemon names to be taken offline one after another in case of program crash.
-var ShedOrder = []string{MaintenanceName, DNSDName, SOCKDName, SMTPDName, HTTPDName, InsecureHTTPDName, PlainSocketName, TelegramName}
+var ShedOrder = []string{MaintenanceName, SchedulerName, DNSDName, SOCKDName, SMTPDName, HTTPDName, InsecureHTTPDName, PlainSocketName, TelegramName}
 
 /*
 RemoveFromFlags removes CLI flag from input flags base on a condition function (true to remove). The input flags must
@@ -84,7 +88,7 @@ type Supervisor struct {
 	// CLIFlags are the thorough list of original program flags to launch laitos. This must not include the leading executable path.
 	CLIFlags []string
 	// Config is laitos configuration deserialised from user's config JSON file.
-	Config Config
+	Config *Config
 	// DaemonNames are the original set of daemon names that user asked to start.
 	DaemonNames []string
 	// shedSequence is the sequence at which daemon shedding takes place. Each latter array has one daemon less than the previous.
@@ -93,6 +97,9 @@ type Supervisor struct {
 	mainStdout *misc.ByteLogWriter
 	// mainStderr forwards verbatim main program output to stdout and keeps latest several KB for notification.
 	mainStderr *misc.ByteLogWriter
+	// mainProcess is the currently running main program, it receives hang-up signal forwarded by supervisor.
+	mainProcess      *os.Process
+	mainProcessMutex sync.Mutex
 
 	logger misc.Logger
 }
@@ -175,6 +182,26 @@ Latest stderr: %s
 	}
 }
 
+/*
+forwardHangUp relays hang-up signal received by supervisor to the running main program, which then reloads its
+configuration.
+*/
+func (sup *Supervisor) forwardHangUp() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			sup.mainProcessMutex.Lock()
+			if sup.mainProcess != nil {
+				if err := sup.mainProcess.Signal(syscall.SIGHUP); err != nil {
+					sup.logger.Warning("forwardHangUp", "", err, "failed to forward hang-up signal to main program")
+				}
+			}
+			sup.mainProcessMutex.Unlock()
+		}
+	}()
+}
+
 /*
 Start will fork and launch laitos main program. If the main program crashes repeatedly within 20 minutes, the supervisor
 will restart the main program with a reduced set of features and send a notification email.
@@ -182,6 +209,7 @@ The function blocks caller and runs forever.
 */
 func (sup *Supervisor) Start() {
 	sup.initialise()
+	sup.forwardHangUp()
 	paramChoice := 0
 	lastAttemptTime := time.Now().Unix()
 	executablePath, err := os.Executable()
@@ -207,7 +235,14 @@ func (sup *Supervisor) Start() {
 			time.Sleep(StartAttemptIntervalSec * time.Second)
 			continue
 		}
-		if err := mainProgram.Wait(); err != nil {
+		sup.mainProcessMutex.Lock()
+		sup.mainProcess = mainProgram.Process
+		sup.mainProcessMutex.Unlock()
+		err := mainProgram.Wait()
+		sup.mainProcessMutex.Lock()
+		sup.mainProcess = nil
+		sup.mainProcessMutex.Unlock()
+		if err != nil {
 			sup.logger.Warning("Start", strconv.Itoa(paramChoice), err, "main program has crashed")
 			sup.notifyFailure(cliFlags, err)
 			if time.Now().Unix()-lastAttemptTime < FailureThresholdSec {
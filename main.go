@@ -80,6 +80,29 @@ func MakeEncryptedArchive(srcDir, archivePath string) {
 	}
 }
 
+/*
+VerifyAuditLog reads the audit log secret from standard input, then checks integrity of the command audit log file and
+exits the program with status 1 upon failure.
+*/
+func VerifyAuditLog(logPath string) {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("Please enter the audit log secret (no echo):")
+	SetTermEcho(false)
+	secret, _, err := reader.ReadLine()
+	SetTermEcho(true)
+	if err != nil {
+		misc.DefaultLogger.Abort("VerifyAuditLog", "main", err, "failed to read secret")
+		return
+	}
+	numRecords, lastHash, err := misc.VerifyAuditLog(logPath, strings.TrimSpace(string(secret)))
+	if err == nil {
+		fmt.Printf("Success - %d records, the last record hash is %s\n", numRecords, lastHash)
+	} else {
+		fmt.Printf("Error: %v (after %d records have been verified)\n", err, numRecords)
+		os.Exit(1)
+	}
+}
+
 // StartPasswordWebServer starts the password input web server.
 func StartPasswordWebServer(port int, url, archivePath string) {
 	ws := passwdserver.WebServer{
@@ -124,7 +147,7 @@ func main() {
 	var disableConflicts, tuneSystem, debug, swapOff, benchmark bool
 	var gomaxprocs int
 	flag.StringVar(&misc.ConfigFilePath, launcher.ConfigFlagName, "", "(Mandatory) path to configuration file in JSON syntax")
-	flag.StringVar(&daemonList, launcher.DaemonsFlagName, "", "(Mandatory) comma-separated daemons to start (dnsd, httpd, insecurehttpd, maintenance, plainsocket, smtpd, telegram)")
+	flag.StringVar(&daemonList, launcher.DaemonsFlagName, "", "(Mandatory) comma-separated daemons to start (dnsd, httpd, insecurehttpd, maintenance, plainsocket, scheduler, smtpd, telegram)")
 	flag.BoolVar(&disableConflicts, "disableconflicts", false, "(Optional) automatically stop and disable other daemon programs that may cause port usage conflicts")
 	flag.BoolVar(&swapOff, "swapoff", false, "(Optional) turn off all swap files and partitions for improved system security")
 	flag.BoolVar(&tuneSystem, "tunesystem", false, "(Optional) tune operating system parameters for optimal performance")
@@ -145,6 +168,9 @@ func main() {
 	flag.StringVar(&dataUtil, "datautil", "", "(Optional) program data encryption utility: extract|archive")
 	flag.StringVar(&dataUtilDir, "datautildir", "", "(Optional) program data encryption utility: extract destination or archive source directory")
 	flag.StringVar(&dataUtilFile, "datautilfile", "", "(Optional) program data encryption utility: extract from or archive file location")
+	// Command audit log utility flag
+	var auditLogVerify string
+	flag.StringVar(&auditLogVerify, "auditlogverify", "", "(Optional) verify integrity of the command audit log file")
 	// Internal supervisor flag
 	var isSupervisor = true
 	flag.BoolVar(&isSupervisor, launcher.SupervisorFlagName, true, "(Internal use only) enter supervisor mode")
@@ -166,6 +192,14 @@ func main() {
 		return
 	}
 
+	// ========================================================================
+	// Utility mode - Verify command audit log and do not run daemons.
+	// ========================================================================
+	if auditLogVerify != "" {
+		VerifyAuditLog(auditLogVerify)
+		return
+	}
+
 	// ========================================================================
 	// Encrypted data archive launcher mode - launch the password input web server.
 	// ========================================================================
@@ -227,7 +261,7 @@ func main() {
 	// protected by supervisor by default.
 	// ========================================================================
 	if isSupervisor {
-		supervisor := &launcher.Supervisor{CLIFlags: os.Args[1:], Config: config, DaemonNames: daemonNames}
+		supervisor := &launcher.Supervisor{CLIFlags: os.Args[1:], Config: &config, DaemonNames: daemonNames}
 		supervisor.Start()
 		return
 	}
@@ -256,6 +290,8 @@ func main() {
 		logger.Warning("main", "", nil, "System tuning result is: \n%s", toolbox.TuneLinux())
 	}
 	ReseedPseudoRand()
+	// Clients who repeatedly fail PIN verification or exceed rate limits are banned by all daemons
+	config.GetBanRegistry()
 	daemonErrs := make(chan error, len(daemonNames))
 	for _, daemonName := range daemonNames {
 		// Daemons are started asynchronously, the order of startup does not matter.
@@ -280,6 +316,10 @@ func main() {
 			go func() {
 				daemonErrs <- config.GetPlainSocketDaemon().StartAndBlock()
 			}()
+		case launcher.SchedulerName:
+			go func() {
+				daemonErrs <- config.GetScheduler().StartAndBlock()
+			}()
 		case launcher.SMTPDName:
 			go func() {
 				daemonErrs <- config.GetMailDaemon().StartAndBlock()
@@ -295,6 +335,28 @@ func main() {
 		}
 	}
 
+	/*
+		DNS-over-HTTPS queries are answered by DNS daemon, which updates its ad-block black list only when it is started.
+		If web server answers the queries on its own, the black list has to be kept up to date here instead.
+	*/
+	if config.HTTPHandlers.DNSOverHTTPSEndpoint != "" {
+		var dnsdStarted, httpdStarted bool
+		for _, daemonName := range daemonNames {
+			switch daemonName {
+			case launcher.DNSDName:
+				dnsdStarted = true
+			case launcher.HTTPDName, launcher.InsecureHTTPDName:
+				httpdStarted = true
+			}
+		}
+		if httpdStarted && !dnsdStarted {
+			go config.GetDNSD().KeepUpdatingBlackList(nil)
+		}
+	}
+
+	// Features and filters of the daemons may be reloaded from configuration file without a restart
+	ReloadConfigOnHangup(&config)
+
 	// ========================================================================
 	// Daemon mode - optionally run benchmark in the background.
 	// ========================================================================
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/HouzuoGuo/laitos/daemon/dnsd"
+	"github.com/HouzuoGuo/laitos/launcher"
 	"github.com/HouzuoGuo/laitos/misc"
 	"io/ioutil"
 	pseudoRand "math/rand"
@@ -44,6 +45,21 @@ func DumpGoroutinesOnInterrupt() {
 	}()
 }
 
+// ReloadConfigOnHangup installs a hang-up signal handler that reloads features and filters from the configuration file.
+func ReloadConfigOnHangup(config *launcher.Config) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			if out, err := config.ReloadFromFile(); err == nil {
+				logger.Warning("ReloadConfigOnHangup", "", nil, "%s", out)
+			} else {
+				logger.Warning("ReloadConfigOnHangup", "", err, "failed to reload configuration file \"%s\"", misc.ConfigFilePath)
+			}
+		}
+	}()
+}
+
 // ReseedPseudoRand regularly reseeds global pseudo random generator using cryptographic random number generator.
 func ReseedPseudoRand() {
 	go func() {
@@ -0,0 +1,251 @@
+package misc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AuditHeadFileSuffix is appended to audit log file path to form the path of file that memorises the latest record.
+	AuditHeadFileSuffix = ".head"
+	// AuditInvalidFileSuffix is appended to audit log file path, followed by a timestamp, to set aside a log that failed verification.
+	AuditInvalidFileSuffix = ".invalid-"
+)
+
+// AuditRecord describes a toolbox command processed by a command processor.
+type AuditRecord struct {
+	Timestamp  time.Time `json:"Timestamp"`  // Timestamp is the moment when command processing finished
+	Channel    string    `json:"Channel"`    // Channel is the name of daemon that received the command
+	ClientID   string    `json:"ClientID"`   // ClientID identifies the origin of command, such as IP address or phone number.
+	UserName   string    `json:"UserName"`   // UserName is the PIN user who issued the command
+	Trigger    string    `json:"Trigger"`    // Trigger is the prefix of toolbox feature that was invoked
+	Content    string    `json:"Content"`    // Content is the command content that may have been redacted
+	OK         bool      `json:"OK"`         // OK is true only if the command did not result in an error
+	DurationMS int64     `json:"DurationMS"` // DurationMS is the number of milliseconds spent in processing the command
+	PrevHash   string    `json:"PrevHash"`   // PrevHash is the hash of previous record, it is empty for the very first record.
+	Hash       string    `json:"Hash"`       // Hash is calculated from previous hash and content of this record
+}
+
+/*
+CalculateHash returns hex-encoded HMAC-SHA256 of the record's content keyed by the secret, excluding the record's own
+hash. Without the secret, nobody can forge a record that passes verification.
+*/
+func (rec AuditRecord) CalculateHash(secret string) string {
+	rec.Hash = ""
+	serialised, err := json.Marshal(rec)
+	if err != nil {
+		// An ordinary struct should never fail to serialise
+		panic(err)
+	}
+	return calculateAuditHMAC(secret, serialised)
+}
+
+// calculateAuditHMAC returns hex-encoded HMAC-SHA256 of the content keyed by the secret.
+func calculateAuditHMAC(secret string, content []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formatAuditHead returns the content of head file that memorises the latest record, the content is signed by the secret.
+func formatAuditHead(secret string, numRecords int64, lastHash string) string {
+	head := fmt.Sprintf("%d %s", numRecords, lastHash)
+	return fmt.Sprintf("%s %s\n", head, calculateAuditHMAC(secret, []byte(head)))
+}
+
+// String returns the record formatted into a single line of text, excluding the hashes.
+func (rec AuditRecord) String() string {
+	return fmt.Sprintf("%s %s %s %s %s ok=%v %dms %s",
+		rec.Timestamp.Format("2006-01-02 15:04:05"), rec.Channel, rec.ClientID, rec.UserName, rec.Trigger, rec.OK, rec.DurationMS, rec.Content)
+}
+
+/*
+AuditLog appends command records to a file, one record per line in JSON. Each record carries the hash of previous record
+so that modification or removal of any record breaks the chain. The latest record count and hash are memorised in a
+separate head file, which helps to detect truncation at the end of the log. The hashes are keyed by a secret that is
+kept away from the log file, so that whoever is able to write the log file still cannot forge the chain.
+Remember to call Initialise() before use!
+*/
+type AuditLog struct {
+	FilePath string `json:"FilePath"` // FilePath is the location of the log file
+	Secret   string `json:"Secret"`   // Secret is the key of record hashes, it must not be stored alongside the log file.
+
+	numRecords int64
+	lastHash   string
+	mutex      *sync.Mutex
+	logger     Logger
+}
+
+// IsConfigured returns true only if the log file path is present.
+func (audit *AuditLog) IsConfigured() bool {
+	return audit != nil && audit.FilePath != ""
+}
+
+/*
+Initialise reads the latest record from existing log file, so that new records may continue the hash chain. If the
+existing log file fails verification, it is set aside along with its head file, and a new log file is started.
+*/
+func (audit *AuditLog) Initialise() error {
+	audit.mutex = new(sync.Mutex)
+	audit.logger = Logger{ComponentName: "AuditLog", ComponentID: audit.FilePath}
+	if !audit.IsConfigured() {
+		return nil
+	}
+	if audit.Secret == "" {
+		return errors.New("AuditLog.Initialise: Secret must not be empty")
+	}
+	numRecords, lastHash, err := VerifyAuditLog(audit.FilePath, audit.Secret)
+	if err != nil {
+		/*
+			New records must not chain onto a log that failed verification, or the log would never pass verification
+			again. Keep the invalid log for investigation and start over.
+		*/
+		invalidPath := audit.FilePath + AuditInvalidFileSuffix + time.Now().Format("20060102150405")
+		for _, suffix := range []string{"", AuditHeadFileSuffix} {
+			if renameErr := os.Rename(audit.FilePath+suffix, invalidPath+suffix); renameErr != nil && !os.IsNotExist(renameErr) {
+				return fmt.Errorf("AuditLog.Initialise: failed to set aside log file that failed verification (%v) - %v", err, renameErr)
+			}
+		}
+		audit.logger.Warning("Initialise", "", err, "!!! THE LOG FILE MAY HAVE BEEN TAMPERED WITH !!! it failed verification and is "+
+			"moved to %s, new records will go to a new log file", invalidPath)
+		numRecords, lastHash = 0, ""
+	}
+	audit.numRecords = numRecords
+	audit.lastHash = lastHash
+	return nil
+}
+
+// Append chains the record to the previous one and writes it to the log file.
+func (audit *AuditLog) Append(rec AuditRecord) error {
+	if !audit.IsConfigured() {
+		return nil
+	}
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	rec.PrevHash = audit.lastHash
+	rec.Hash = rec.CalculateHash(audit.Secret)
+	serialised, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(audit.FilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	if _, err := logFile.Write(append(serialised, '\n')); err != nil {
+		return err
+	}
+	if err := logFile.Sync(); err != nil {
+		return err
+	}
+	audit.numRecords++
+	audit.lastHash = rec.Hash
+	return ioutil.WriteFile(audit.FilePath+AuditHeadFileSuffix, []byte(formatAuditHead(audit.Secret, audit.numRecords, audit.lastHash)), 0600)
+}
+
+// GetLatest returns up to the specified number of latest records, the latest record comes first.
+func (audit *AuditLog) GetLatest(maxRecords int) (ret []AuditRecord, err error) {
+	ret = make([]AuditRecord, 0, maxRecords)
+	if !audit.IsConfigured() {
+		return
+	}
+	audit.mutex.Lock()
+	content, err := ioutil.ReadFile(audit.FilePath)
+	audit.mutex.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	for i := len(lines) - 1; i >= 0 && len(ret) < maxRecords; i-- {
+		var rec AuditRecord
+		if jsonErr := json.Unmarshal([]byte(lines[i]), &rec); jsonErr == nil {
+			ret = append(ret, rec)
+		}
+	}
+	return
+}
+
+/*
+VerifyAuditLog reads all records from the log file and checks the integrity of hash chain keyed by the secret, as well
+as the latest record memorised by head file. Return number of records and hash of the last record that were successfully
+verified, and an error if any tampering, truncation, or corruption is detected.
+*/
+func VerifyAuditLog(filePath, secret string) (numRecords int64, lastHash string, err error) {
+	logFile, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Without the log file, the head file should not exist either.
+			if _, headErr := os.Stat(filePath + AuditHeadFileSuffix); headErr == nil {
+				err = errors.New("log file is missing but its head file exists")
+			} else {
+				err = nil
+			}
+		}
+		return
+	}
+	defer logFile.Close()
+	scanner := bufio.NewScanner(logFile)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err = json.Unmarshal(line, &rec); err != nil {
+			err = fmt.Errorf("record %d is corrupted - %v", numRecords+1, err)
+			return
+		}
+		if rec.PrevHash != lastHash {
+			err = fmt.Errorf("record %d does not chain to its previous record", numRecords+1)
+			return
+		}
+		if !hmac.Equal([]byte(rec.CalculateHash(secret)), []byte(rec.Hash)) {
+			err = fmt.Errorf("record %d has been modified", numRecords+1)
+			return
+		}
+		numRecords++
+		lastHash = rec.Hash
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	// Compare the last record against head file
+	head, headErr := ioutil.ReadFile(filePath + AuditHeadFileSuffix)
+	if headErr != nil {
+		if numRecords > 0 {
+			err = fmt.Errorf("failed to read head file - %v", headErr)
+		}
+		return
+	}
+	headFields := strings.Fields(string(head))
+	if len(headFields) != 3 {
+		err = errors.New("head file is corrupted")
+		return
+	}
+	if !hmac.Equal([]byte(calculateAuditHMAC(secret, []byte(headFields[0]+" "+headFields[1]))), []byte(headFields[2])) {
+		err = errors.New("head file has been modified")
+		return
+	}
+	headNumRecords, _ := strconv.ParseInt(headFields[0], 10, 64)
+	if headNumRecords != numRecords || headFields[1] != lastHash {
+		err = fmt.Errorf("log file has %d records but head file expects %d, the log may have been truncated", numRecords, headNumRecords)
+	}
+	return
+}
@@ -0,0 +1,135 @@
+package misc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "laitos-TestAuditLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	logPath := tmpFile.Name()
+	os.Remove(logPath)
+	defer os.Remove(logPath)
+	defer os.Remove(logPath + AuditHeadFileSuffix)
+
+	// Unconfigured audit log does nothing
+	audit := AuditLog{}
+	if err := audit.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Append(AuditRecord{Content: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	// Verify a log that does not yet exist
+	if num, hash, err := VerifyAuditLog(logPath, "secret"); err != nil || num != 0 || hash != "" {
+		t.Fatal(num, hash, err)
+	}
+	// Secret is mandatory
+	audit = AuditLog{FilePath: logPath}
+	if err := audit.Initialise(); err == nil {
+		t.Fatal("did not error")
+	}
+	audit = AuditLog{FilePath: logPath, Secret: "secret"}
+	if err := audit.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"a", "b", "c"} {
+		if err := audit.Append(AuditRecord{Channel: "test", Trigger: ".s", Content: content, OK: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	num, lastHash, err := VerifyAuditLog(logPath, "secret")
+	if err != nil || num != 3 || lastHash == "" {
+		t.Fatal(num, lastHash, err)
+	}
+	// Records cannot be verified without the correct secret
+	if num, _, err := VerifyAuditLog(logPath, "wrong"); err == nil || num != 0 || !strings.Contains(err.Error(), "modified") {
+		t.Fatal(num, err)
+	}
+	if latest, err := audit.GetLatest(2); err != nil || len(latest) != 2 || latest[0].Content != "c" || latest[1].Content != "b" {
+		t.Fatal(latest, err)
+	}
+	// Re-initialise and continue the chain
+	audit = AuditLog{FilePath: logPath, Secret: "secret"}
+	if err := audit.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Append(AuditRecord{Content: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if num, _, err := VerifyAuditLog(logPath, "secret"); err != nil || num != 4 {
+		t.Fatal(num, err)
+	}
+	original, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Modify a record
+	if err := ioutil.WriteFile(logPath, []byte(strings.Replace(string(original), `"Content":"b"`, `"Content":"x"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if num, _, err := VerifyAuditLog(logPath, "secret"); err == nil || num != 1 || !strings.Contains(err.Error(), "modified") {
+		t.Fatal(num, err)
+	}
+	// Remove a record
+	lines := strings.Split(string(original), "\n")
+	if err := ioutil.WriteFile(logPath, []byte(strings.Join(append([]string{lines[0]}, lines[2:]...), "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if num, _, err := VerifyAuditLog(logPath, "secret"); err == nil || num != 1 || !strings.Contains(err.Error(), "chain") {
+		t.Fatal(num, err)
+	}
+	// Truncate the last record
+	if err := ioutil.WriteFile(logPath, []byte(strings.Join(lines[:3], "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if num, _, err := VerifyAuditLog(logPath, "secret"); err == nil || num != 3 || !strings.Contains(err.Error(), "truncated") {
+		t.Fatal(num, err)
+	}
+	// Forge the head file to hide the truncation
+	head, err := ioutil.ReadFile(logPath + AuditHeadFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var third AuditRecord
+	if err := json.Unmarshal([]byte(lines[2]), &third); err != nil {
+		t.Fatal(err)
+	}
+	headFields := strings.Fields(string(head))
+	forgedHead := fmt.Sprintf("3 %s %s\n", third.Hash, headFields[2])
+	if err := ioutil.WriteFile(logPath+AuditHeadFileSuffix, []byte(forgedHead), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if num, _, err := VerifyAuditLog(logPath, "secret"); err == nil || num != 3 || !strings.Contains(err.Error(), "head file has been modified") {
+		t.Fatal(num, err)
+	}
+	// A log that failed verification is set aside, and new records go to a new log file.
+	audit = AuditLog{FilePath: logPath, Secret: "secret"}
+	if err := audit.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	// Forget about the warning logged by Initialise, for it would upset the logger test that counts log entries.
+	LatestLogs, LatestWarnings = NewRingBuffer(NumLatestLogEntries), NewRingBuffer(NumLatestLogEntries)
+	invalidFiles, err := filepath.Glob(logPath + AuditInvalidFileSuffix + "*")
+	if err != nil || len(invalidFiles) != 2 {
+		t.Fatal(invalidFiles, err)
+	}
+	for _, invalidFile := range invalidFiles {
+		defer os.Remove(invalidFile)
+	}
+	if err := audit.Append(AuditRecord{Content: "e"}); err != nil {
+		t.Fatal(err)
+	}
+	if num, _, err := VerifyAuditLog(logPath, "secret"); err != nil || num != 1 {
+		t.Fatal(num, err)
+	}
+}
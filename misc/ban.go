@@ -0,0 +1,224 @@
+package misc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBanFailureWindowSec = 10 * 60          // DefaultBanFailureWindowSec is the default interval at which failure counters are reset
+	DefaultBanSec              = 10 * 60          // DefaultBanSec is the default duration of an actor's first ban
+	DefaultMaxBanSec           = 7 * 24 * 60 * 60 // DefaultMaxBanSec is the default maximum duration of a ban
+)
+
+// ErrBanned is returned to an actor who is currently banned.
+var ErrBanned = errors.New("banned due to repeated failures")
+
+/*
+Bans is the ban registry shared by all daemons of this program. By default it is not configured and does not ban
+anyone, program launcher replaces it with user's configuration before starting daemons.
+*/
+var Bans = &BanRegistry{}
+
+// Ban is the record of an actor who has been banned.
+type Ban struct {
+	NumBans int       `json:"NumBans"` // NumBans is the number of times the actor has been banned, it escalates the duration of next ban.
+	Until   time.Time `json:"Until"`   // Until is the time at which the latest ban expires.
+}
+
+/*
+BanRegistry counts failures (such as failed PIN attempts and rate limit violations) of actors (such as IP addresses,
+phone numbers, and chat users), and bans an actor once its failures reach the limit within a time window. Each
+subsequent ban of the same actor lasts twice as long as the previous one. Bans are optionally persisted on disk so that
+they survive program restart.
+Remember to call Initialise() before use!
+*/
+type BanRegistry struct {
+	MaxFailures      int    `json:"MaxFailures"`      // MaxFailures is the number of failures within time window that gets an actor banned. 0 disables banning.
+	FailureWindowSec int64  `json:"FailureWindowSec"` // FailureWindowSec is the interval at which failure counters are reset.
+	BanSec           int64  `json:"BanSec"`           // BanSec is the duration of an actor's first ban.
+	MaxBanSec        int64  `json:"MaxBanSec"`        // MaxBanSec is the maximum duration of a ban.
+	FilePath         string `json:"FilePath"`         // FilePath is the optional location of file that persists bans.
+
+	failures      map[string]int
+	lastResetTime time.Time
+	bans          map[string]*Ban
+	mutex         *sync.Mutex
+	logger        Logger
+}
+
+// IsConfigured returns true only if the registry is supposed to ban actors.
+func (reg *BanRegistry) IsConfigured() bool {
+	return reg != nil && reg.MaxFailures > 0
+}
+
+// Initialise sets default values for unspecified durations and reads persisted bans from file.
+func (reg *BanRegistry) Initialise() error {
+	reg.logger = Logger{ComponentName: "BanRegistry", ComponentID: reg.FilePath}
+	reg.mutex = new(sync.Mutex)
+	reg.failures = make(map[string]int)
+	reg.lastResetTime = time.Now()
+	reg.bans = make(map[string]*Ban)
+	if reg.FailureWindowSec < 1 {
+		reg.FailureWindowSec = DefaultBanFailureWindowSec
+	}
+	if reg.BanSec < 1 {
+		reg.BanSec = DefaultBanSec
+	}
+	if reg.MaxBanSec < reg.BanSec {
+		reg.MaxBanSec = DefaultMaxBanSec
+		if reg.MaxBanSec < reg.BanSec {
+			reg.MaxBanSec = reg.BanSec
+		}
+	}
+	if reg.FilePath == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(reg.FilePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("BanRegistry.Initialise: failed to read file \"%s\" - %v", reg.FilePath, err)
+	}
+	if err := json.Unmarshal(content, &reg.bans); err != nil {
+		return fmt.Errorf("BanRegistry.Initialise: failed to deserialise file \"%s\" - %v", reg.FilePath, err)
+	}
+	if reg.bans == nil {
+		reg.bans = make(map[string]*Ban)
+	}
+	return nil
+}
+
+// save writes all ban records into the file, if the file is configured. Caller must hold the mutex.
+func (reg *BanRegistry) save() {
+	if reg.FilePath == "" {
+		return
+	}
+	content, err := json.Marshal(reg.bans)
+	if err == nil {
+		err = ioutil.WriteFile(reg.FilePath, content, 0600)
+	}
+	if err != nil {
+		reg.logger.Warning("save", "", err, "failed to persist bans")
+	}
+}
+
+/*
+RecordFailure increases failure counter of the actor by one. If the failures have reached the limit, the actor will be
+banned. Actor of empty string is ignored.
+*/
+func (reg *BanRegistry) RecordFailure(actor string) {
+	if !reg.IsConfigured() || actor == "" {
+		return
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	now := time.Now()
+	// Reset all counters if the time window has past
+	if now.Sub(reg.lastResetTime) >= time.Duration(reg.FailureWindowSec)*time.Second {
+		reg.failures = make(map[string]int)
+		reg.lastResetTime = now
+		// Forget about actors whose ban has expired long ago
+		for name, ban := range reg.bans {
+			if now.Sub(ban.Until) > time.Duration(reg.MaxBanSec)*time.Second {
+				delete(reg.bans, name)
+			}
+		}
+	}
+	if ban, exists := reg.bans[actor]; exists && now.Before(ban.Until) {
+		return
+	}
+	reg.failures[actor]++
+	if reg.failures[actor] < reg.MaxFailures {
+		return
+	}
+	delete(reg.failures, actor)
+	ban, exists := reg.bans[actor]
+	if !exists {
+		ban = &Ban{}
+		reg.bans[actor] = ban
+	}
+	// Each subsequent ban lasts twice as long as the previous one
+	banSec := reg.BanSec
+	for i := 0; i < ban.NumBans && banSec < reg.MaxBanSec; i++ {
+		banSec *= 2
+	}
+	if banSec > reg.MaxBanSec {
+		banSec = reg.MaxBanSec
+	}
+	ban.NumBans++
+	ban.Until = now.Add(time.Duration(banSec) * time.Second)
+	reg.logger.Warning("RecordFailure", actor, nil, "banned for %d seconds after %d failures (ban #%d)", banSec, reg.MaxFailures, ban.NumBans)
+	reg.save()
+}
+
+// IsBanned returns true only if the actor is currently banned.
+func (reg *BanRegistry) IsBanned(actor string) bool {
+	if !reg.IsConfigured() || actor == "" {
+		return false
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	ban, exists := reg.bans[actor]
+	return exists && time.Now().Before(ban.Until)
+}
+
+// GetBanned returns the actors who are currently banned, sorted by name.
+func (reg *BanRegistry) GetBanned() (actors []string, bans []Ban) {
+	actors = make([]string, 0, 8)
+	bans = make([]Ban, 0, 8)
+	if !reg.IsConfigured() {
+		return
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	now := time.Now()
+	for name, ban := range reg.bans {
+		if now.Before(ban.Until) {
+			actors = append(actors, name)
+		}
+	}
+	sort.Strings(actors)
+	for _, name := range actors {
+		bans = append(bans, *reg.bans[name])
+	}
+	return
+}
+
+/*
+Clear lifts the ban of the actor and forgets about its failures, so that its next ban will be as short as the first.
+Return true only if the actor was known to the registry.
+*/
+func (reg *BanRegistry) Clear(actor string) bool {
+	if !reg.IsConfigured() {
+		return false
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	_, hasBan := reg.bans[actor]
+	_, hasFailure := reg.failures[actor]
+	delete(reg.bans, actor)
+	delete(reg.failures, actor)
+	if hasBan {
+		reg.save()
+	}
+	return hasBan || hasFailure
+}
+
+// ClearAll lifts all bans and forgets about all failures.
+func (reg *BanRegistry) ClearAll() {
+	if !reg.IsConfigured() {
+		return
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.bans = make(map[string]*Ban)
+	reg.failures = make(map[string]int)
+	reg.save()
+}
@@ -0,0 +1,123 @@
+package misc
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBanRegistry(t *testing.T) {
+	// Ban warnings must not be counted by logger test cases that inspect the shared log buffers
+	defer func(logs, warnings *RingBuffer) {
+		LatestLogs = logs
+		LatestWarnings = warnings
+	}(LatestLogs, LatestWarnings)
+	LatestLogs = NewRingBuffer(NumLatestLogEntries)
+	LatestWarnings = NewRingBuffer(NumLatestLogEntries)
+	// Registry that is not configured does not ban anyone
+	reg := &BanRegistry{}
+	reg.RecordFailure("a")
+	if reg.IsBanned("a") || reg.Clear("a") {
+		t.Fatal("should not have banned")
+	}
+	// Ban after three failures
+	reg = &BanRegistry{MaxFailures: 3, BanSec: 1, MaxBanSec: 3, FilePath: "/tmp/laitos-TestBanRegistry"}
+	os.Remove(reg.FilePath)
+	defer os.Remove(reg.FilePath)
+	if err := reg.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if reg.FailureWindowSec != DefaultBanFailureWindowSec {
+		t.Fatal(reg.FailureWindowSec)
+	}
+	reg.RecordFailure("a")
+	reg.RecordFailure("a")
+	reg.RecordFailure("b")
+	if reg.IsBanned("a") || reg.IsBanned("b") {
+		t.Fatal("banned too early")
+	}
+	reg.RecordFailure("a")
+	if !reg.IsBanned("a") || reg.IsBanned("b") {
+		t.Fatal("did not ban")
+	}
+	if actors, bans := reg.GetBanned(); !reflect.DeepEqual(actors, []string{"a"}) || len(bans) != 1 || bans[0].NumBans != 1 {
+		t.Fatal(actors, bans)
+	}
+	// Bans are persisted
+	persisted := &BanRegistry{MaxFailures: 3, FilePath: reg.FilePath}
+	if err := persisted.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if !persisted.IsBanned("a") || persisted.IsBanned("b") {
+		t.Fatal("did not persist")
+	}
+	// The first ban expires in a second
+	time.Sleep(1100 * time.Millisecond)
+	if reg.IsBanned("a") {
+		t.Fatal("did not expire")
+	}
+	// The second ban lasts twice as long
+	reg.RecordFailure("a")
+	reg.RecordFailure("a")
+	reg.RecordFailure("a")
+	time.Sleep(1100 * time.Millisecond)
+	if actors, bans := reg.GetBanned(); !reflect.DeepEqual(actors, []string{"a"}) || bans[0].NumBans != 2 {
+		t.Fatal(actors, bans)
+	}
+	// Clear ban of an actor
+	if !reg.Clear("a") || reg.IsBanned("a") || reg.Clear("a") {
+		t.Fatal("did not clear")
+	}
+	// Clear all bans
+	for i := 0; i < 3; i++ {
+		reg.RecordFailure("b")
+	}
+	if !reg.IsBanned("b") {
+		t.Fatal("did not ban")
+	}
+	reg.ClearAll()
+	if reg.IsBanned("b") {
+		t.Fatal("did not clear")
+	}
+	persisted = &BanRegistry{MaxFailures: 3, FilePath: reg.FilePath}
+	if err := persisted.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if actors, _ := persisted.GetBanned(); len(actors) != 0 {
+		t.Fatal(actors)
+	}
+}
+
+func TestRateLimitBan(t *testing.T) {
+	defer func(logs, warnings *RingBuffer, bans *BanRegistry) {
+		LatestLogs = logs
+		LatestWarnings = warnings
+		Bans = bans
+	}(LatestLogs, LatestWarnings, Bans)
+	LatestLogs = NewRingBuffer(NumLatestLogEntries)
+	LatestWarnings = NewRingBuffer(NumLatestLogEntries)
+	Bans = &BanRegistry{MaxFailures: 2}
+	if err := Bans.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	// Exceeding the limit in two units of time gets the actor banned
+	limit := &RateLimit{UnitSecs: 1, MaxCount: 1}
+	limit.Initialise()
+	exemptLimit := &RateLimit{UnitSecs: 1, MaxCount: 1, ExemptFromBan: true}
+	exemptLimit.Initialise()
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			limit.Add("a", false)
+			exemptLimit.Add("b", false)
+		}
+		time.Sleep(1100 * time.Millisecond)
+	}
+	if !Bans.IsBanned("a") || limit.Add("a", false) {
+		t.Fatal("did not ban")
+	}
+	// Rate limit exempted from ban does not record failures
+	if Bans.IsBanned("b") || !exemptLimit.Add("b", false) {
+		t.Fatal("should not have banned")
+	}
+}
@@ -5,15 +5,23 @@ import (
 	"time"
 )
 
+// RateLimitRejections counts the number of hits rejected by rate limits, by the component name of their loggers.
+var RateLimitRejections = NewCounters()
+
 /*
 RateLimit tracks number of hits performed by each source ("actor") to determine whether a source has exceeded
 specified rate limit. Instead of being a rolling counter, the tracking data is reset to empty at regular interval.
 Remember to call Initialise() before use!
 */
 type RateLimit struct {
-	UnitSecs      int64
-	MaxCount      int
-	Logger        Logger
+	UnitSecs int64
+	MaxCount int
+	Logger   Logger
+	/*
+		ExemptFromBan stops the rate limit from recording violations in the ban registry. This is useful when the source
+		of hits may be spoofed, such as IP address of a UDP packet, so that nobody gets banned on behalf of others.
+	*/
+	ExemptFromBan bool
 	lastTimestamp int64
 	counter       map[string]int
 	logged        map[string]struct{}
@@ -30,8 +38,15 @@ func (limit *RateLimit) Initialise() {
 	}
 }
 
-// Increase counter of the actor by one. If the counter exceeds max limit, return false, otherwise return true.
+/*
+Increase counter of the actor by one. If the counter exceeds max limit, or the actor is banned, return false, otherwise
+return true. Unless the rate limit is exempted from ban, the first time an actor exceeds the limit in a unit of time
+counts as a failure in the ban registry.
+*/
 func (limit *RateLimit) Add(actor string, logIfLimitHit bool) bool {
+	if Bans.IsBanned(actor) {
+		return false
+	}
 	limit.counterMutex.Lock()
 	// Reset all counters if unit of time has past
 	if now := time.Now().Unix(); now-limit.lastTimestamp >= limit.UnitSecs {
@@ -41,11 +56,16 @@ func (limit *RateLimit) Add(actor string, logIfLimitHit bool) bool {
 	}
 	if count, exists := limit.counter[actor]; exists {
 		if count >= limit.MaxCount {
-			if _, hasLogged := limit.logged[actor]; !hasLogged && logIfLimitHit {
+			_, hasLogged := limit.logged[actor]
+			if !hasLogged && logIfLimitHit {
 				limit.Logger.Warning("Add", "RateLimit", nil, "%s exceeded limit of %d hits per %d seconds", actor, limit.MaxCount, limit.UnitSecs)
-				limit.logged[actor] = struct{}{}
 			}
+			limit.logged[actor] = struct{}{}
 			limit.counterMutex.Unlock()
+			RateLimitRejections.Increase(limit.Logger.ComponentName)
+			if !hasLogged && !limit.ExemptFromBan {
+				Bans.RecordFailure(actor)
+			}
 			return false
 		} else {
 			limit.counter[actor] = count + 1
@@ -7,7 +7,7 @@ import (
 )
 
 func TestRateLimit(t *testing.T) {
-	limit := RateLimit{UnitSecs: 3, MaxCount: 4}
+	limit := RateLimit{UnitSecs: 3, MaxCount: 4, Logger: Logger{ComponentName: "TestRateLimit"}}
 	limit.Initialise()
 	// Three actors should get two chances each
 	success := [3]int{}
@@ -26,6 +26,9 @@ func TestRateLimit(t *testing.T) {
 			t.Fatal(success)
 		}
 	}
+	if rejections := RateLimitRejections.Get()["TestRateLimit"]; rejections != 3*96 {
+		t.Fatal(rejections)
+	}
 	// Do it again over a period of 15 seconds
 	limit.Initialise()
 	for i := 0; i < 3; i++ {
@@ -37,8 +37,45 @@ func (s *Stats) Trigger(qty float64) {
 	s.mutex.Unlock()
 }
 
+// GetCountAndTotal returns the number of times trigger has occurred and the sum of all quantities.
+func (s *Stats) GetCountAndTotal() (count uint64, total float64) {
+	s.mutex.Lock()
+	count, total = s.count, s.total
+	s.mutex.Unlock()
+	return
+}
+
 // Format returns all stats formatted into a single line of string after the numbers (excluding counter) are divided by the factor.
 func (s *Stats) Format(divisionFactor float64, numDecimals int) string {
 	format := fmt.Sprintf("%%.%df/%%.%df/%%.%df,%%.%df(%%d)", numDecimals, numDecimals, numDecimals, numDecimals)
 	return fmt.Sprintf(format, s.lowest/divisionFactor, s.average/divisionFactor, s.highest/divisionFactor, s.total/divisionFactor, s.count)
 }
+
+// Counters is a collection of named counters that are safe for concurrent use.
+type Counters struct {
+	counts map[string]uint64
+	mutex  *sync.Mutex
+}
+
+// NewCounters returns an initialised collection of counters.
+func NewCounters() *Counters {
+	return &Counters{counts: make(map[string]uint64), mutex: new(sync.Mutex)}
+}
+
+// Increase increases the named counter by one.
+func (c *Counters) Increase(name string) {
+	c.mutex.Lock()
+	c.counts[name]++
+	c.mutex.Unlock()
+}
+
+// Get returns a copy of all counters and their names.
+func (c *Counters) Get() map[string]uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ret := make(map[string]uint64, len(c.counts))
+	for name, count := range c.counts {
+		ret[name] = count
+	}
+	return ret
+}
@@ -32,4 +32,26 @@ func TestStats(t *testing.T) {
 	if str := s.Format(10, 2); str != "0.10/0.40/0.90,1.20(3)" {
 		t.Fatalf(str)
 	}
+	if count, total := s.GetCountAndTotal(); count != 3 || total != 12 {
+		t.Fatal(count, total)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	c := NewCounters()
+	if counts := c.Get(); len(counts) != 0 {
+		t.Fatal(counts)
+	}
+	c.Increase("a")
+	c.Increase("b")
+	c.Increase("a")
+	counts := c.Get()
+	if len(counts) != 2 || counts["a"] != 2 || counts["b"] != 1 {
+		t.Fatal(counts)
+	}
+	// The returned counters are a copy
+	counts["a"] = 100
+	if c.Get()["a"] != 2 {
+		t.Fatal(c.Get())
+	}
 }
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -82,6 +83,14 @@ mixed with additional input environment variables. The additional variables take
 Returns stdout+stderr output combined, and error if there is any.
 */
 func InvokeProgram(envVars []string, timeoutSec int, program string, args ...string) (out string, err error) {
+	return InvokeCancellableProgram(envVars, timeoutSec, nil, program, args...)
+}
+
+/*
+InvokeCancellableProgram launches an external program in the same way as InvokeProgram, and additionally kills the
+program along with its child processes as soon as the cancel channel is closed. The cancel channel may be nil.
+*/
+func InvokeCancellableProgram(envVars []string, timeoutSec int, cancel <-chan struct{}, program string, args ...string) (out string, err error) {
 	// Mix envVars into program environment variables
 	myEnv := os.Environ()
 	var combinedEnv []string
@@ -98,10 +107,15 @@ func InvokeProgram(envVars []string, timeoutSec int, program string, args ...str
 	proc.Env = combinedEnv
 	proc.Stdout = &outBuf
 	proc.Stderr = &outBuf
-	// Run the program in a separate routine in order to monitor for timeout
+	// Run the program in its own process group, so that it can be killed along with its child processes.
+	proc.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = proc.Start(); err != nil {
+		return
+	}
+	// Wait for the program in a separate routine in order to monitor for timeout and cancellation
 	procRunChan := make(chan error, 1)
 	go func() {
-		procRunChan <- proc.Run()
+		procRunChan <- proc.Wait()
 	}()
 	select {
 	case procErr := <-procRunChan:
@@ -110,16 +124,38 @@ func InvokeProgram(envVars []string, timeoutSec int, program string, args ...str
 		err = procErr
 	case <-time.After(time.Duration(timeoutSec) * time.Second):
 		// If timeout is reached yet the process still has not completed, kill it.
-		out = outBuf.String()
-		if proc.Process != nil {
-			if err = proc.Process.Kill(); err == nil {
-				err = errors.New("Program timed out")
-			}
+		if err = killProcessGroup(proc.Process); err == nil {
+			err = errors.New("Program timed out")
+		}
+		out = getOutputAfterKill(procRunChan, &outBuf)
+	case <-cancel:
+		if err = killProcessGroup(proc.Process); err == nil {
+			err = errors.New("Program was cancelled")
 		}
+		out = getOutputAfterKill(procRunChan, &outBuf)
 	}
 	return
 }
 
+// killProcessGroup kills the process along with the other processes of its group.
+func killProcessGroup(proc *os.Process) error {
+	if err := syscall.Kill(-proc.Pid, syscall.SIGKILL); err != nil {
+		return proc.Kill()
+	}
+	return nil
+}
+
+// getOutputAfterKill waits briefly for a killed program to exit and returns its output collected so far.
+func getOutputAfterKill(procRunChan <-chan error, outBuf *bytes.Buffer) string {
+	select {
+	case <-procRunChan:
+		return outBuf.String()
+	case <-time.After(1 * time.Second):
+		// The output buffer is still being written to and cannot be read safely
+		return ""
+	}
+}
+
 /*
 CommonPATH is a PATH environment variable value that includes most common executable locations across Unix and Linux.
 Be aware that, when laitos launches external programs they usually should inherit all of the environment variables from
@@ -137,6 +173,14 @@ func InvokeShell(timeoutSec int, interpreter string, content string) (out string
 	return InvokeProgram([]string{"PATH=" + CommonPATH}, timeoutSec, interpreter, "-c", content)
 }
 
+/*
+InvokeCancellableShell launches an external shell process in the same way as InvokeShell, and additionally kills the
+shell along with its child processes as soon as the cancel channel is closed. The cancel channel may be nil.
+*/
+func InvokeCancellableShell(timeoutSec int, cancel <-chan struct{}, interpreter string, content string) (out string, err error) {
+	return InvokeCancellableProgram([]string{"PATH=" + CommonPATH}, timeoutSec, cancel, interpreter, "-c", content)
+}
+
 // GetSysctlStr returns string value of a sysctl parameter corresponding to the input key.
 func GetSysctlStr(key string) (string, error) {
 	content, err := ioutil.ReadFile(path.Join("/proc/sys/", strings.Replace(key, ".", "/", -1)))
@@ -97,3 +97,23 @@ func TestInvokeShell(t *testing.T) {
 		t.Fatal(err, out)
 	}
 }
+
+func TestInvokeCancellableShell(t *testing.T) {
+	if out, err := InvokeCancellableShell(1, nil, "/bin/bash", "echo hi"); err != nil || out != "hi\n" {
+		t.Fatal(err, out)
+	}
+	// Cancellation kills the shell along with its child processes
+	cancel := make(chan struct{})
+	go func() {
+		time.Sleep(1 * time.Second)
+		close(cancel)
+	}()
+	begin := time.Now()
+	out, err := InvokeCancellableShell(10, cancel, "/bin/bash", "echo begin; sleep 5 | cat; echo end")
+	if err == nil || out != "begin\n" {
+		t.Fatal(err, out)
+	}
+	if duration := time.Now().Unix() - begin.Unix(); duration > 3 {
+		t.Fatal("did not kill upon cancellation")
+	}
+}
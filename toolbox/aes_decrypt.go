@@ -108,6 +108,10 @@ func (crypt *AESDecrypt) Trigger() Trigger {
 	return AESDecryptTrigger
 }
 
+func (crypt *AESDecrypt) Usage() string {
+	return "shortcut key to_search"
+}
+
 func (crypt *AESDecrypt) Execute(cmd Command) (ret *Result) {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
@@ -56,6 +56,10 @@ func (bro *Browser) Trigger() Trigger {
 	return ".b"
 }
 
+func (bro *Browser) Usage() string {
+	return ErrBadBrowserParam.Error()
+}
+
 // FormatElementInfoArray prints element information into strings.
 func FormatElementInfoArray(elements []browser.ElementInfo) string {
 	if elements == nil || len(elements) == 0 {
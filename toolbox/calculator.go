@@ -0,0 +1,481 @@
+package toolbox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	CalculatorTrigger    = ".k"         // CalculatorTrigger is the trigger prefix string of Calculator feature.
+	CalculatorDateFormat = "2006-01-02" // CalculatorDateFormat is the format of dates in date arithmetic.
+)
+
+var (
+	// RegexUnitConversion finds the value expression and unit to convert from, as well as the unit to convert to.
+	RegexUnitConversion = regexp.MustCompile(`^(.*?)\s*([a-zA-Z°][a-zA-Z°/]*)\s+to\s+([a-zA-Z°][a-zA-Z°/]*)$`)
+	// RegexTimeZoneConversion finds the optional date, time, and time zone to convert from, as well as the time zone to convert to.
+	RegexTimeZoneConversion = regexp.MustCompile(`^(?:(\d{4}-\d{2}-\d{2})\s+)?(\d{1,2}:\d{2}|now)\s*(\S*)\s+to\s+(\S+)$`)
+	// RegexDateArithmetic finds a date followed by either a subtraction of another date, or additions of days, weeks, months, and years.
+	RegexDateArithmetic = regexp.MustCompile(`^(today|\d{4}-\d{2}-\d{2})\s*(.*)$`)
+	// RegexDateInterval finds an addition or subtraction of a number of days, weeks, months, or years.
+	RegexDateInterval = regexp.MustCompile(`^([+-])\s*(\d+)\s*([dwmy])\s*`)
+	// RegexUTCOffset finds a fixed time zone written as offset from UTC.
+	RegexUTCOffset = regexp.MustCompile(`^(?:utc|gmt)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+	ErrBadCalculatorParam = errors.New("expression | value unit to unit | [date] hh:mm|now zone to zone | date|today +-N d|w|m|y | date - date")
+)
+
+// calcFunction is a mathematical function that may be called in an expression.
+type calcFunction struct {
+	numArgs int
+	fn      func(args []float64) float64
+}
+
+// calcFunctions are the mathematical functions that may be called in an expression, angles are in radians.
+var calcFunctions = map[string]calcFunction{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"acos":  {1, func(a []float64) float64 { return math.Acos(a[0]) }},
+	"asin":  {1, func(a []float64) float64 { return math.Asin(a[0]) }},
+	"atan":  {1, func(a []float64) float64 { return math.Atan(a[0]) }},
+	"cbrt":  {1, func(a []float64) float64 { return math.Cbrt(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"cos":   {1, func(a []float64) float64 { return math.Cos(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ln":    {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"log2":  {1, func(a []float64) float64 { return math.Log2(a[0]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"round": {1, func(a []float64) float64 { return math.Floor(a[0] + 0.5) }},
+	"sin":   {1, func(a []float64) float64 { return math.Sin(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"tan":   {1, func(a []float64) float64 { return math.Tan(a[0]) }},
+}
+
+// calcConstants are the named constants that may be used in an expression.
+var calcConstants = map[string]float64{
+	"e":  math.E,
+	"pi": math.Pi,
+}
+
+/*
+exprParser evaluates an arithmetic expression by recursive descent. From the lowest precedence to the highest, the
+operators are: addition and subtraction, multiplication/division/modulo, unary sign, and exponentiation.
+*/
+type exprParser struct {
+	in  string
+	pos int
+}
+
+// skipSpaces moves the position past white spaces.
+func (parser *exprParser) skipSpaces() {
+	for parser.pos < len(parser.in) && unicode.IsSpace(rune(parser.in[parser.pos])) {
+		parser.pos++
+	}
+}
+
+// peek returns the next character that is not a white space, or 0 if there is no more input.
+func (parser *exprParser) peek() byte {
+	parser.skipSpaces()
+	if parser.pos < len(parser.in) {
+		return parser.in[parser.pos]
+	}
+	return 0
+}
+
+// expect moves the position past the character, or returns an error if the next character is not the one.
+func (parser *exprParser) expect(char byte) error {
+	if parser.peek() != char {
+		return fmt.Errorf("Expect '%c' at position %d", char, parser.pos+1)
+	}
+	parser.pos++
+	return nil
+}
+
+// sum evaluates additions and subtractions.
+func (parser *exprParser) sum() (float64, error) {
+	ret, err := parser.product()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch parser.peek() {
+		case '+', '-':
+			op := parser.in[parser.pos]
+			parser.pos++
+			operand, err := parser.product()
+			if err != nil {
+				return 0, err
+			}
+			if op == '+' {
+				ret += operand
+			} else {
+				ret -= operand
+			}
+		default:
+			return ret, nil
+		}
+	}
+}
+
+// product evaluates multiplications, divisions, and modulo.
+func (parser *exprParser) product() (float64, error) {
+	ret, err := parser.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch parser.peek() {
+		case '*', '/', '%':
+			op := parser.in[parser.pos]
+			parser.pos++
+			operand, err := parser.unary()
+			if err != nil {
+				return 0, err
+			}
+			switch op {
+			case '*':
+				ret *= operand
+			case '/':
+				ret /= operand
+			case '%':
+				ret = math.Mod(ret, operand)
+			}
+		default:
+			return ret, nil
+		}
+	}
+}
+
+// unary evaluates the sign in front of an operand.
+func (parser *exprParser) unary() (float64, error) {
+	switch parser.peek() {
+	case '-':
+		parser.pos++
+		ret, err := parser.unary()
+		return -ret, err
+	case '+':
+		parser.pos++
+		return parser.unary()
+	}
+	return parser.power()
+}
+
+// power evaluates exponentiation, which is right associative.
+func (parser *exprParser) power() (float64, error) {
+	base, err := parser.primary()
+	if err != nil {
+		return 0, err
+	}
+	if parser.peek() != '^' {
+		return base, nil
+	}
+	parser.pos++
+	exponent, err := parser.unary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// primary evaluates a number, a parenthesised expression, a constant, or a function call.
+func (parser *exprParser) primary() (float64, error) {
+	char := parser.peek()
+	switch {
+	case char == 0:
+		return 0, errors.New("Unexpected end of expression")
+	case char == '(':
+		parser.pos++
+		ret, err := parser.sum()
+		if err != nil {
+			return 0, err
+		}
+		return ret, parser.expect(')')
+	case char >= '0' && char <= '9' || char == '.':
+		start := parser.pos
+		for parser.pos < len(parser.in) && (parser.in[parser.pos] >= '0' && parser.in[parser.pos] <= '9' || parser.in[parser.pos] == '.') {
+			parser.pos++
+		}
+		// Scientific notation such as 1.5e-3
+		if exp := parser.pos; exp < len(parser.in) && (parser.in[exp] == 'e' || parser.in[exp] == 'E') {
+			exp++
+			if exp < len(parser.in) && (parser.in[exp] == '+' || parser.in[exp] == '-') {
+				exp++
+			}
+			if exp < len(parser.in) && parser.in[exp] >= '0' && parser.in[exp] <= '9' {
+				for exp < len(parser.in) && parser.in[exp] >= '0' && parser.in[exp] <= '9' {
+					exp++
+				}
+				parser.pos = exp
+			}
+		}
+		ret, err := strconv.ParseFloat(parser.in[start:parser.pos], 64)
+		if err != nil {
+			return 0, fmt.Errorf("Bad number \"%s\"", parser.in[start:parser.pos])
+		}
+		return ret, nil
+	case unicode.IsLetter(rune(char)):
+		start := parser.pos
+		for parser.pos < len(parser.in) && (unicode.IsLetter(rune(parser.in[parser.pos])) || unicode.IsDigit(rune(parser.in[parser.pos]))) {
+			parser.pos++
+		}
+		name := strings.ToLower(parser.in[start:parser.pos])
+		if function, exists := calcFunctions[name]; exists {
+			if err := parser.expect('('); err != nil {
+				return 0, err
+			}
+			args := make([]float64, 0, function.numArgs)
+			for i := 0; i < function.numArgs; i++ {
+				if i > 0 {
+					if err := parser.expect(','); err != nil {
+						return 0, err
+					}
+				}
+				arg, err := parser.sum()
+				if err != nil {
+					return 0, err
+				}
+				args = append(args, arg)
+			}
+			return function.fn(args), parser.expect(')')
+		} else if constant, exists := calcConstants[name]; exists {
+			return constant, nil
+		}
+		return 0, fmt.Errorf("Unknown function or constant \"%s\"", name)
+	}
+	return 0, fmt.Errorf("Unexpected '%c' at position %d", char, parser.pos+1)
+}
+
+// EvaluateExpression returns the value of an arithmetic expression such as "2*(3+4)^2 / sqrt(16)".
+func EvaluateExpression(expr string) (float64, error) {
+	parser := &exprParser{in: expr}
+	ret, err := parser.sum()
+	if err != nil {
+		return 0, err
+	}
+	if parser.peek() != 0 {
+		return 0, fmt.Errorf("Unexpected '%c' at position %d", parser.in[parser.pos], parser.pos+1)
+	}
+	if math.IsNaN(ret) || math.IsInf(ret, 0) {
+		return 0, errors.New("Result is not a finite number")
+	}
+	return ret, nil
+}
+
+// FormatNumber returns the number in at most 12 significant digits, which hides rounding errors of floating point arithmetic.
+func FormatNumber(num float64) string {
+	return strconv.FormatFloat(num, 'g', 12, 64)
+}
+
+// calcUnit is a unit of measurement. A value in this unit is converted into the base unit by value*factor+offset.
+type calcUnit struct {
+	dimension string
+	factor    float64
+	offset    float64
+}
+
+// calcUnits are the units of measurement known to unit conversion, keyed by lower case unit name.
+var calcUnits = map[string]calcUnit{
+	// Length, the base unit is metre.
+	"mm": {"length", 0.001, 0}, "cm": {"length", 0.01, 0}, "m": {"length", 1, 0}, "km": {"length", 1000, 0},
+	"in": {"length", 0.0254, 0}, "inch": {"length", 0.0254, 0}, "ft": {"length", 0.3048, 0}, "foot": {"length", 0.3048, 0},
+	"feet": {"length", 0.3048, 0}, "yd": {"length", 0.9144, 0}, "mi": {"length", 1609.344, 0}, "mile": {"length", 1609.344, 0},
+	"nmi": {"length", 1852, 0},
+	// Mass, the base unit is kilogram.
+	"mg": {"mass", 1e-6, 0}, "g": {"mass", 0.001, 0}, "kg": {"mass", 1, 0}, "t": {"mass", 1000, 0},
+	"oz": {"mass", 0.028349523125, 0}, "lb": {"mass", 0.45359237, 0}, "lbs": {"mass", 0.45359237, 0}, "st": {"mass", 6.35029318, 0},
+	// Temperature, the base unit is kelvin.
+	"c": {"temperature", 1, 273.15}, "°c": {"temperature", 1, 273.15}, "f": {"temperature", 5.0 / 9, 459.67 * 5 / 9},
+	"°f": {"temperature", 5.0 / 9, 459.67 * 5 / 9}, "k": {"temperature", 1, 0},
+	// Speed, the base unit is metre per second.
+	"m/s": {"speed", 1, 0}, "km/h": {"speed", 1 / 3.6, 0}, "kmh": {"speed", 1 / 3.6, 0}, "kph": {"speed", 1 / 3.6, 0},
+	"mph": {"speed", 0.44704, 0}, "ft/s": {"speed", 0.3048, 0}, "kn": {"speed", 1852 / 3600.0, 0}, "knot": {"speed", 1852 / 3600.0, 0},
+	// Data size, the base unit is byte.
+	"bit": {"data", 0.125, 0}, "b": {"data", 1, 0}, "byte": {"data", 1, 0},
+	"kb": {"data", 1e3, 0}, "mb": {"data", 1e6, 0}, "gb": {"data", 1e9, 0}, "tb": {"data", 1e12, 0},
+	"kib": {"data", 1 << 10, 0}, "mib": {"data", 1 << 20, 0}, "gib": {"data", 1 << 30, 0}, "tib": {"data", 1 << 40, 0},
+	// Time, the base unit is second.
+	"ms": {"time", 0.001, 0}, "s": {"time", 1, 0}, "sec": {"time", 1, 0}, "min": {"time", 60, 0}, "h": {"time", 3600, 0},
+	"hr": {"time", 3600, 0}, "day": {"time", 86400, 0}, "week": {"time", 7 * 86400, 0}, "year": {"time", 365.25 * 86400, 0},
+}
+
+// ConvertUnit converts a value from one unit of measurement to another of the same dimension.
+func ConvertUnit(value float64, fromUnit, toUnit string) (float64, error) {
+	from, fromExists := calcUnits[strings.ToLower(fromUnit)]
+	if !fromExists {
+		return 0, fmt.Errorf("Unknown unit \"%s\"", fromUnit)
+	}
+	to, toExists := calcUnits[strings.ToLower(toUnit)]
+	if !toExists {
+		return 0, fmt.Errorf("Unknown unit \"%s\"", toUnit)
+	}
+	if from.dimension != to.dimension {
+		return 0, fmt.Errorf("Cannot convert %s to %s", from.dimension, to.dimension)
+	}
+	return (value*from.factor + from.offset - to.offset) / to.factor, nil
+}
+
+// LoadTimeZone returns the time zone by its IANA name (e.g. Europe/Berlin), or by its offset from UTC (e.g. UTC+8, -05:30).
+func LoadTimeZone(name string) (*time.Location, error) {
+	lowerName := strings.ToLower(name)
+	if lowerName == "utc" || lowerName == "gmt" || lowerName == "z" {
+		return time.UTC, nil
+	}
+	if offset := RegexUTCOffset.FindStringSubmatch(lowerName); offset != nil {
+		hours, _ := strconv.Atoi(offset[2])
+		minutes, _ := strconv.Atoi(offset[3])
+		seconds := hours*3600 + minutes*60
+		if offset[1] == "-" {
+			seconds = -seconds
+		}
+		return time.FixedZone(strings.ToUpper(name), seconds), nil
+	}
+	// An IANA name always carries a slash, which rules out the ambiguous abbreviations such as "CST".
+	if !strings.Contains(name, "/") {
+		return nil, fmt.Errorf("Unknown time zone \"%s\"", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// ConvertTimeZone converts the time (optionally on a date) in a time zone into another time zone.
+func ConvertTimeZone(date, clock, fromZone, toZone string) (string, error) {
+	to, err := LoadTimeZone(toZone)
+	if err != nil {
+		return "", err
+	}
+	from := time.Local
+	if fromZone != "" {
+		if from, err = LoadTimeZone(fromZone); err != nil {
+			return "", err
+		}
+	}
+	var t time.Time
+	if clock == "now" {
+		t = time.Now()
+	} else {
+		if date == "" {
+			date = time.Now().In(from).Format(CalculatorDateFormat)
+		}
+		if t, err = time.ParseInLocation(CalculatorDateFormat+" 15:04", date+" "+clock, from); err != nil {
+			return "", fmt.Errorf("Bad date or time - %v", err)
+		}
+	}
+	return t.In(to).Format("2006-01-02 15:04 Mon MST"), nil
+}
+
+// CalculateDate adds intervals to a date (e.g. "2017-12-25 +3w -1d") or counts days between two dates (e.g. "2017-12-25 - today").
+func CalculateDate(date, intervals string) (string, error) {
+	parseDate := func(in string) (time.Time, error) {
+		if in == "today" {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+		return time.Parse(CalculatorDateFormat, in)
+	}
+	t, err := parseDate(date)
+	if err != nil {
+		return "", fmt.Errorf("Bad date - %v", err)
+	}
+	// Subtraction of another date results in number of days between the two
+	if strings.HasPrefix(intervals, "-") {
+		if other, err := parseDate(strings.TrimSpace(intervals[1:])); err == nil {
+			return fmt.Sprintf("%d days", int(math.Floor(t.Sub(other).Hours()/24+0.5))), nil
+		}
+	}
+	for intervals != "" {
+		interval := RegexDateInterval.FindStringSubmatch(intervals)
+		if interval == nil {
+			return "", ErrBadCalculatorParam
+		}
+		intervals = intervals[len(interval[0]):]
+		num, _ := strconv.Atoi(interval[2])
+		if interval[1] == "-" {
+			num = -num
+		}
+		switch interval[3] {
+		case "d":
+			t = t.AddDate(0, 0, num)
+		case "w":
+			t = t.AddDate(0, 0, 7*num)
+		case "m":
+			t = t.AddDate(0, num, 0)
+		case "y":
+			t = t.AddDate(num, 0, 0)
+		}
+	}
+	return t.Format(CalculatorDateFormat + " Mon"), nil
+}
+
+/*
+Calculator evaluates arithmetic expressions, converts units of measurement and time zones, and does date arithmetic.
+It works entirely offline, hence it is always available even if Internet features are not.
+*/
+type Calculator struct {
+}
+
+func (calc *Calculator) IsConfigured() bool {
+	return true
+}
+
+func (calc *Calculator) SelfTest() error {
+	if result, err := EvaluateExpression("1+1"); err != nil || result != 2 {
+		return fmt.Errorf("Calculator.SelfTest: unexpected result %v - %v", result, err)
+	}
+	return nil
+}
+
+func (calc *Calculator) Initialise() error {
+	return nil
+}
+
+func (calc *Calculator) Trigger() Trigger {
+	return CalculatorTrigger
+}
+
+func (calc *Calculator) Usage() string {
+	return ErrBadCalculatorParam.Error()
+}
+
+func (calc *Calculator) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	// Time zone names are case sensitive, hence the original command content is used in time zone conversion.
+	if params := RegexTimeZoneConversion.FindStringSubmatch(cmd.Content); params != nil {
+		if _, isUnit := calcUnits[strings.ToLower(params[4])]; !isUnit {
+			out, err := ConvertTimeZone(params[1], strings.ToLower(params[2]), params[3], params[4])
+			return &Result{Output: out, Error: err}
+		}
+	}
+	if params := RegexUnitConversion.FindStringSubmatch(cmd.Content); params != nil {
+		value := 1.0
+		if strings.TrimSpace(params[1]) != "" {
+			var err error
+			if value, err = EvaluateExpression(params[1]); err != nil {
+				return &Result{Error: err}
+			}
+		}
+		converted, err := ConvertUnit(value, params[2], params[3])
+		if err != nil {
+			return &Result{Error: err}
+		}
+		return &Result{Output: fmt.Sprintf("%s %s = %s %s", FormatNumber(value), params[2], FormatNumber(converted), params[3])}
+	}
+	if params := RegexDateArithmetic.FindStringSubmatch(strings.ToLower(cmd.Content)); params != nil {
+		out, err := CalculateDate(params[1], params[2])
+		return &Result{Output: out, Error: err}
+	}
+	result, err := EvaluateExpression(cmd.Content)
+	if err != nil {
+		return &Result{Error: err}
+	}
+	return &Result{Output: FormatNumber(result)}
+}
@@ -0,0 +1,86 @@
+package toolbox
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"1+1":                          "2",
+		" 2 * (3 + 4) ^ 2 / sqrt(16) ": "24.5",
+		"-2^2":                         "-4",
+		"2^3^2":                        "512",
+		"10 % 4 - -1":                  "3",
+		"0.1 + 0.2":                    "0.3",
+		"1.5e3 / 1e-1":                 "15000",
+		"2*pi":                         "6.28318530718",
+		"max(3, min(10, 4)) + abs(-1)": "5",
+		"round(2.5) + floor(-0.5)":     "2",
+		"log(1000) + ln(e) + log2(8)":  "7",
+	} {
+		result, err := EvaluateExpression(expr)
+		if err != nil || FormatNumber(result) != expected {
+			t.Fatal(expr, result, err)
+		}
+	}
+	for _, expr := range []string{"", "1+", "(1+2", "1 2", "foo(1)", "sqrt 4", "max(1)", "1/0", "sqrt(-1)", "1..2"} {
+		if result, err := EvaluateExpression(expr); err == nil {
+			t.Fatal(expr, result)
+		}
+	}
+}
+
+func TestCalculator_Execute(t *testing.T) {
+	calc := Calculator{}
+	if !calc.IsConfigured() {
+		t.Fatal("not configured")
+	}
+	if err := calc.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := calc.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	for content, expected := range map[string]string{
+		// Arithmetic
+		"(1+2)*3": "9",
+		// Unit conversion
+		"10 km to mi":      "10 km = 6.21371192237 mi",
+		"2*3 ft to m":      "6 ft = 1.8288 m",
+		"100 C to F":       "100 C = 212 F",
+		"-40 °f to °c":     "-40 °f = -40 °c",
+		"0 k to c":         "0 k = -273.15 c",
+		"100 km/h to knot": "100 km/h = 53.9956803456 knot",
+		"1 GiB to MB":      "1 GiB = 1073.741824 MB",
+		"lb to g":          "1 lb = 453.59237 g",
+		"90 min to h":      "90 min = 1.5 h",
+		// Time zone conversion
+		"2017-12-25 14:30 UTC to UTC+8":                "2017-12-25 22:30 Mon UTC+8",
+		"2017-12-25 23:00 utc-05:30 to gmt":            "2017-12-26 04:30 Tue UTC",
+		"2017-07-01 12:00 Europe/Berlin to Asia/Tokyo": "2017-07-01 19:00 Sat JST",
+		// Date arithmetic
+		"2017-12-25 + 1w":         "2018-01-01 Mon",
+		"2017-01-31 +1m -1d +1y":  "2018-03-02 Fri",
+		"2018-03-01 - 2017-12-25": "66 days",
+		"2017-12-25 - 2018-03-01": "-66 days",
+	} {
+		if ret := calc.Execute(Command{Content: content}); ret.Error != nil || ret.Output != expected {
+			t.Fatal(content, ret)
+		}
+	}
+	// Current time and date
+	if ret := calc.Execute(Command{Content: "now to UTC"}); ret.Error != nil || !strings.HasPrefix(ret.Output, time.Now().UTC().Format("2006-01-02")) {
+		t.Fatal(ret)
+	}
+	if ret := calc.Execute(Command{Content: "today - today"}); ret.Error != nil || ret.Output != "0 days" {
+		t.Fatal(ret)
+	}
+	// Bad input
+	for _, content := range []string{"", "1 km to kg", "1 km to parsec", "12:00 UTC to Nowhere/City", "12:00 CST to UTC", "2017-12-25 + 1 fortnight", "2017-13-01 + 1d", "1 +"} {
+		if ret := calc.Execute(Command{Content: content}); ret.Error == nil {
+			t.Fatal(content, ret)
+		}
+	}
+}
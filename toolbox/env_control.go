@@ -13,10 +13,15 @@ import (
 	"time"
 )
 
-var ErrBadEnvInfoChoice = errors.New(`lock | stop | kill | log | warn | runtime | stack | tune`)
+var ErrBadEnvInfoChoice = errors.New(`lock | stop | kill | log | warn | runtime | stack | tune | audit | reload | bans | unban actor|all`)
+
+// NumLatestAuditRecords is the number of latest audit log records to retrieve via EnvControl.
+const NumLatestAuditRecords = 10
 
 // Retrieve environment information and trigger emergency stop upon request.
 type EnvControl struct {
+	AuditLog     *misc.AuditLog         `json:"-"` // AuditLog is the command audit log to be verified and inspected
+	ReloadConfig func() (string, error) `json:"-"` // ReloadConfig re-reads program configuration and describes the outcome
 }
 
 func (info *EnvControl) IsConfigured() bool {
@@ -35,10 +40,18 @@ func (info *EnvControl) Trigger() Trigger {
 	return ".e"
 }
 
+func (info *EnvControl) Usage() string {
+	return ErrBadEnvInfoChoice.Error()
+}
+
 func (info *EnvControl) Execute(cmd Command) *Result {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
 	}
+	// Lift ban of an actor, whose name may be in upper case.
+	if params := strings.Fields(cmd.Content); len(params) == 2 && strings.ToLower(params[0]) == "unban" {
+		return UnbanActor(params[1])
+	}
 	switch strings.ToLower(cmd.Content) {
 	case "lock":
 		misc.TriggerEmergencyLockDown()
@@ -59,6 +72,16 @@ func (info *EnvControl) Execute(cmd Command) *Result {
 		return &Result{Output: GetGoroutineStacktraces()}
 	case "tune":
 		return &Result{Output: TuneLinux()}
+	case "audit":
+		return info.GetLatestAudit()
+	case "bans":
+		return &Result{Output: GetBannedActors()}
+	case "reload":
+		if info.ReloadConfig == nil {
+			return &Result{Error: errors.New("configuration reload is not available")}
+		}
+		out, err := info.ReloadConfig()
+		return &Result{Error: err, Output: out}
 	default:
 		return &Result{Error: ErrBadEnvInfoChoice}
 	}
@@ -84,6 +107,56 @@ Program flags: %v
 		os.Args[1:])
 }
 
+// GetLatestAudit verifies the integrity of audit log and returns the verification result along with latest records.
+func (info *EnvControl) GetLatestAudit() *Result {
+	if !info.AuditLog.IsConfigured() {
+		return &Result{Error: errors.New("audit log is not configured")}
+	}
+	var out bytes.Buffer
+	if numRecords, _, err := misc.VerifyAuditLog(info.AuditLog.FilePath, info.AuditLog.Secret); err == nil {
+		out.WriteString(fmt.Sprintf("Verified %d records\n", numRecords))
+	} else {
+		out.WriteString(fmt.Sprintf("Verification failed after %d records - %v\n", numRecords, err))
+	}
+	records, err := info.AuditLog.GetLatest(NumLatestAuditRecords)
+	if err != nil {
+		return &Result{Error: err, Output: out.String()}
+	}
+	for _, rec := range records {
+		out.WriteString(rec.String())
+		out.WriteRune('\n')
+	}
+	return &Result{Output: out.String()}
+}
+
+// GetBannedActors returns the actors who are currently banned and when their ban expires, one actor per line.
+func GetBannedActors() string {
+	if !misc.Bans.IsConfigured() {
+		return "ban registry is not configured"
+	}
+	var out bytes.Buffer
+	actors, bans := misc.Bans.GetBanned()
+	for i, actor := range actors {
+		out.WriteString(fmt.Sprintf("%s until %s (ban #%d)\n", actor, bans[i].Until.Format(time.RFC3339), bans[i].NumBans))
+	}
+	return out.String()
+}
+
+// UnbanActor lifts the ban of an actor, or all actors if the actor name is "all".
+func UnbanActor(actor string) *Result {
+	if !misc.Bans.IsConfigured() {
+		return &Result{Error: errors.New("ban registry is not configured")}
+	}
+	if actor == "all" {
+		misc.Bans.ClearAll()
+		return &Result{Output: "OK - all bans are lifted"}
+	}
+	if !misc.Bans.Clear(actor) {
+		return &Result{Error: fmt.Errorf("%s is not known to ban registry", actor)}
+	}
+	return &Result{Output: "OK - lifted ban of " + actor}
+}
+
 // Return latest log entry of all kinds in a multi-line text, one log entry per line. Latest log entry comes first.
 func GetLatestLog() string {
 	buf := new(bytes.Buffer)
@@ -3,6 +3,7 @@ package toolbox
 import (
 	"fmt"
 	"github.com/HouzuoGuo/laitos/misc"
+	"os"
 	"strings"
 	"testing"
 )
@@ -38,6 +39,53 @@ func TestEnvControl_Execute(t *testing.T) {
 	if ret := info.Execute(Command{Content: "stack"}); ret.Error != nil || strings.Index(ret.Output, "routine") == -1 {
 		t.Fatal(ret)
 	}
+	// Test audit log inspection
+	if ret := info.Execute(Command{Content: "audit"}); ret.Error == nil {
+		t.Fatal("should have errored without audit log")
+	}
+	info.AuditLog = &misc.AuditLog{FilePath: "/tmp/laitos-TestEnvControl_Execute-audit", Secret: "secret"}
+	os.Remove(info.AuditLog.FilePath)
+	os.Remove(info.AuditLog.FilePath + misc.AuditHeadFileSuffix)
+	if err := info.AuditLog.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := info.AuditLog.Append(misc.AuditRecord{Channel: "test", Trigger: ".e", Content: "audit"}); err != nil {
+		t.Fatal(err)
+	}
+	if ret := info.Execute(Command{Content: "audit"}); ret.Error != nil || !strings.Contains(ret.Output, "Verified 1 records") || !strings.Contains(ret.Output, "test") {
+		t.Fatal(ret)
+	}
+	// Test configuration reload
+	if ret := info.Execute(Command{Content: "reload"}); ret.Error == nil {
+		t.Fatal("should have errored without reload function")
+	}
+	info.ReloadConfig = func() (string, error) {
+		return "reloaded", nil
+	}
+	if ret := info.Execute(Command{Content: "reload"}); ret.Error != nil || ret.Output != "reloaded" {
+		t.Fatal(ret)
+	}
+	// Test ban inspection and removal
+	if ret := info.Execute(Command{Content: "unban all"}); ret.Error == nil {
+		t.Fatal("should have errored without ban registry")
+	}
+	defer func(bans *misc.BanRegistry) {
+		misc.Bans = bans
+	}(misc.Bans)
+	misc.Bans = &misc.BanRegistry{MaxFailures: 1}
+	if err := misc.Bans.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	misc.Bans.RecordFailure("BadGuy")
+	if ret := info.Execute(Command{Content: "bans"}); ret.Error != nil || !strings.HasPrefix(ret.Output, "BadGuy until") {
+		t.Fatal(ret)
+	}
+	if ret := info.Execute(Command{Content: "unban nobody"}); ret.Error == nil {
+		t.Fatal("should have errored")
+	}
+	if ret := info.Execute(Command{Content: "unban BadGuy"}); ret.Error != nil || misc.Bans.IsBanned("BadGuy") {
+		t.Fatal(ret)
+	}
 	// Test system tuning
 	ret := info.Execute(Command{Content: "tune"})
 	fmt.Println(ret.Output)
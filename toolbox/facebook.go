@@ -43,6 +43,10 @@ func (fb *Facebook) Trigger() Trigger {
 	return ".f"
 }
 
+func (fb *Facebook) Usage() string {
+	return "status to post"
+}
+
 func (fb *Facebook) Execute(cmd Command) *Result {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
@@ -21,6 +21,18 @@ var (
 type Command struct {
 	TimeoutSec int
 	Content    string
+	UserName   string // UserName is the name of user who issued the command, it is resolved from user's own PIN.
+	ClientID   string // ClientID identifies the origin of command, such as IP address, phone number, or chat user name.
+	/*
+		SpoofableClientID is true if the client ID may have been forged, such as the source address of a UDP packet.
+		Failures of such command do not get the client banned, or anyone could get an innocent client banned.
+	*/
+	SpoofableClientID bool
+	/*
+		Cancel is closed when the command is no longer wanted, such as a cancelled job. A feature that runs for long
+		(e.g. shell) should stop early. It may be nil.
+	*/
+	Cancel <-chan struct{}
 }
 
 // Modify command content to remove leading and trailing white spaces. Return error result if command becomes empty afterwards.
@@ -54,6 +66,7 @@ type Feature interface {
 	SelfTest() error         // Validate and test configuration. It may work only after Initialise() succeeds.
 	Initialise() error       // Prepare internal states.
 	Trigger() Trigger        // Return a prefix string that is matched against command input to trigger a feature, each feature has a unique trigger.
+	Usage() string           // Return a short description of command syntax, excluding the trigger prefix.
 	Execute(Command) *Result // Execute the command with trigger prefix removed, and return execution result.
 }
 
@@ -16,36 +16,61 @@ and receive configuration from JSON.
 type FeatureSet struct {
 	AESDecrypt         AESDecrypt          `json:"AESDecrypt"`
 	Browser            Browser             `json:"Browser"`
+	Calculator         Calculator          `json:"-"`
+	NetDiag            NetDiag             `json:"NetDiag"`
 	PublicContact      PublicContact       `json:"PublicContact"`
 	EnvControl         EnvControl          `json:"EnvControl"`
 	Facebook           Facebook            `json:"Facebook"`
+	FileBrowser        FileBrowser         `json:"FileBrowser"`
 	IMAPAccounts       IMAPAccounts        `json:"IMAPAccounts"`
+	MQTT               MQTT                `json:"MQTT"`
+	Notes              Notes               `json:"Notes"`
 	SendMail           SendMail            `json:"SendMail"`
 	Shell              Shell               `json:"Shell"`
 	Twilio             Twilio              `json:"Twilio"`
 	Twitter            Twitter             `json:"Twitter"`
 	TwoFACodeGenerator TwoFACodeGenerator  `json:"TwoFACodeGenerator"`
+	Vault              Vault               `json:"Vault"`
+	Webhook            Webhook             `json:"Webhook"`
 	WolframAlpha       WolframAlpha        `json:"WolframAlpha"`
+	Plugins            []Plugin            `json:"Plugins"`
+	Help               Help                `json:"-"`
 	LookupByTrigger    map[Trigger]Feature `json:"-"`
 }
 
 var TestFeatureSet = FeatureSet{} // Features are assigned by init_test.go
 
+/*
+ReservedTriggers are the magic prefixes interpreted by command processor before it looks for a feature, such as the one
+that runs a command in background as a job. Plugins must not use them or overlap with them.
+*/
+var ReservedTriggers = []Trigger{".plt", ".job", ".batch", ".more", ".page"}
+
 // Run initialisation routine on all features, and then populate lookup table for all configured features.
 func (fs *FeatureSet) Initialise() error {
 	fs.LookupByTrigger = map[Trigger]Feature{}
+	// Help feature describes all other features
+	fs.Help.Features = fs
 	triggers := map[Trigger]Feature{
 		fs.AESDecrypt.Trigger():         &fs.AESDecrypt,         // a
 		fs.Browser.Trigger():            &fs.Browser,            // b
 		fs.PublicContact.Trigger():      &fs.PublicContact,      // c
+		fs.NetDiag.Trigger():            &fs.NetDiag,            // d
 		fs.EnvControl.Trigger():         &fs.EnvControl,         // e
 		fs.Facebook.Trigger():           &fs.Facebook,           // f
+		fs.Help.Trigger():               &fs.Help,               // h
 		fs.IMAPAccounts.Trigger():       &fs.IMAPAccounts,       // i
+		fs.Calculator.Trigger():         &fs.Calculator,         // k
+		fs.FileBrowser.Trigger():        &fs.FileBrowser,        // l
 		fs.SendMail.Trigger():           &fs.SendMail,           // m
+		fs.Notes.Trigger():              &fs.Notes,              // n
+		fs.Webhook.Trigger():            &fs.Webhook,            // o
+		fs.MQTT.Trigger():               &fs.MQTT,               // q
 		fs.Shell.Trigger():              &fs.Shell,              // s
 		fs.Twilio.Trigger():             &fs.Twilio,             // p
 		fs.Twitter.Trigger():            &fs.Twitter,            // t
 		fs.TwoFACodeGenerator.Trigger(): &fs.TwoFACodeGenerator, // 2
+		fs.Vault.Trigger():              &fs.Vault,              // v
 		fs.WolframAlpha.Trigger():       &fs.WolframAlpha,       // w
 	}
 	for trigger, featureRef := range triggers {
@@ -56,6 +81,31 @@ func (fs *FeatureSet) Initialise() error {
 			fs.LookupByTrigger[trigger] = featureRef
 		}
 	}
+	/*
+		Plugins come with their own triggers, which must not be confused with others - built-in features (configured or
+		not, as configuration may change upon reload), magic prefixes of command processor, and the other plugins.
+	*/
+	takenTriggers := make([]Trigger, 0, len(triggers)+len(ReservedTriggers)+len(fs.Plugins))
+	for trigger := range triggers {
+		takenTriggers = append(takenTriggers, trigger)
+	}
+	takenTriggers = append(takenTriggers, ReservedTriggers...)
+	for i := range fs.Plugins {
+		plugin := &fs.Plugins[i]
+		if !plugin.IsConfigured() {
+			continue
+		}
+		if err := plugin.Initialise(); err != nil {
+			return err
+		}
+		for _, trigger := range takenTriggers {
+			if strings.HasPrefix(string(trigger), plugin.Prefix) || strings.HasPrefix(plugin.Prefix, string(trigger)) {
+				return fmt.Errorf("FeatureSet.Initialise: plugin trigger \"%s\" conflicts with trigger \"%s\"", plugin.Prefix, trigger)
+			}
+		}
+		fs.LookupByTrigger[plugin.Trigger()] = plugin
+		takenTriggers = append(takenTriggers, plugin.Trigger())
+	}
 	return nil
 }
 
@@ -96,12 +146,18 @@ func (fs *FeatureSet) DeserialiseFromJSON(configJSON json.RawMessage) error {
 		"Browser":            &fs.Browser,
 		"EnvControl":         &fs.EnvControl,
 		"Facebook":           &fs.Facebook,
+		"FileBrowser":        &fs.FileBrowser,
 		"IMAPAccounts":       &fs.IMAPAccounts,
+		"MQTT":               &fs.MQTT,
+		"NetDiag":            &fs.NetDiag,
+		"Notes":              &fs.Notes,
 		"SendMail":           &fs.SendMail,
 		"Shell":              &fs.Shell,
 		"Twilio":             &fs.Twilio,
 		"Twitter":            &fs.Twitter,
 		"TwoFACodeGenerator": &fs.TwoFACodeGenerator,
+		"Vault":              &fs.Vault,
+		"Webhook":            &fs.Webhook,
 		"WolframAlpha":       &fs.WolframAlpha,
 	}
 	for featureKey, featureRef := range features {
@@ -111,6 +167,12 @@ func (fs *FeatureSet) DeserialiseFromJSON(configJSON json.RawMessage) error {
 			}
 		}
 	}
+	// Plugins are a list of features rather than a single feature
+	if pluginsJSON, exists := configMap["Plugins"]; exists {
+		if err := json.Unmarshal(pluginsJSON, &fs.Plugins); err != nil {
+			return fmt.Errorf("FeatureSet.DeserialiseFromJSON: failed to deserialise JSON key Plugins - %v", err)
+		}
+	}
 	return nil
 }
 
@@ -18,14 +18,16 @@ func StringContainsAllOf(s string, markers []Trigger) error {
 }
 
 func TestFeatureSet_SelfTest(t *testing.T) {
-	// Initially, an empty FeatureSet should have three features pre-enabled - shell, environment control, and public contacts.
+	// Initially, an empty FeatureSet should have five features pre-enabled - shell, environment control, public contacts, help, and calculator.
 	features := FeatureSet{}
 	if err := features.Initialise(); err != nil {
 		t.Fatal(err)
 	}
-	if len(features.LookupByTrigger) != 3 ||
+	if len(features.LookupByTrigger) != 5 ||
 		features.LookupByTrigger[".c"] == nil ||
 		features.LookupByTrigger[".e"] == nil ||
+		features.LookupByTrigger[".h"] == nil ||
+		features.LookupByTrigger[".k"] == nil ||
 		features.LookupByTrigger[".s"] == nil {
 		t.Fatal(features.LookupByTrigger)
 	}
@@ -34,14 +36,14 @@ func TestFeatureSet_SelfTest(t *testing.T) {
 	if err := features.Initialise(); err != nil {
 		t.Fatal(err)
 	}
-	// Public contacts, environment control, shell commands, AESDecrypt, TwoFACodeGenerator
-	if len(features.LookupByTrigger) != 5 {
+	// Public contacts, environment control, help, shell commands, calculator, AESDecrypt, TwoFACodeGenerator
+	if len(features.LookupByTrigger) != 7 {
 		t.Fatal(features.LookupByTrigger)
 	}
 	if err := features.SelfTest(); err != nil {
 		t.Fatal(err)
 	}
-	if triggers := features.GetTriggers(); !reflect.DeepEqual(triggers, []string{".2", ".a", ".c", ".e", ".s"}) {
+	if triggers := features.GetTriggers(); !reflect.DeepEqual(triggers, []string{".2", ".a", ".c", ".e", ".h", ".k", ".s"}) {
 		t.Fatal(triggers)
 	}
 	// Configure all features via JSON and verify via self test
@@ -52,13 +54,13 @@ func TestFeatureSet_SelfTest(t *testing.T) {
 	if err := features.SelfTest(); err != nil {
 		t.Fatal(err)
 	}
-	if len(features.LookupByTrigger) != 12 {
+	if len(features.LookupByTrigger) != 15 {
 		t.Skip(features.LookupByTrigger)
 	}
 	if err := features.Initialise(); err != nil {
 		t.Fatal(err)
 	}
-	if len(features.LookupByTrigger) != 12 {
+	if len(features.LookupByTrigger) != 15 {
 		t.Fatal(features.LookupByTrigger)
 	}
 	if err := features.SelfTest(); err != nil {
@@ -0,0 +1,326 @@
+package toolbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FileBrowserTrigger         = ".l" // FileBrowserTrigger is the trigger prefix string of FileBrowser feature.
+	FileBrowserActList         = "ls"
+	FileBrowserActStat         = "stat"
+	FileBrowserActRead         = "read"
+	FileBrowserActTail         = "tail"
+	FileBrowserActGrep         = "grep"
+	FileBrowserDefaultReadLen  = 1024 // FileBrowserDefaultReadLen is the number of bytes to read when length is not specified.
+	FileBrowserMaxReadLen      = 1048576
+	FileBrowserDefaultTailLine = 10 // FileBrowserDefaultTailLine is the number of lines to tail when number is not specified.
+	FileBrowserMaxTailLine     = 1000
+	FileBrowserMaxGrepMatch    = 100 // FileBrowserMaxGrepMatch is the maximum number of matching lines to find.
+)
+
+var (
+	ErrBadFileBrowserParam = fmt.Errorf("%s [path] | %s path | %s path [offset [length]] | %s path [lines] | %s path text",
+		FileBrowserActList, FileBrowserActStat, FileBrowserActRead, FileBrowserActTail, FileBrowserActGrep)
+	ErrFileBrowserOutsideRoot = errors.New("Path is outside of root directories")
+)
+
+/*
+FileBrowser lists directories and reads files, but only those underneath the configured root directories. Paths in
+commands begin with the name of a root, e.g. "logs/nginx/access.log", and they cannot escape the root by using ".." or
+symbolic links. Unlike the Shell feature, it cannot modify files or run programs.
+*/
+type FileBrowser struct {
+	Roots map[string]string `json:"Roots"` // Roots are the directories that may be browsed, keyed by a short name (\w+) used in paths.
+
+	absRoots map[string]string
+}
+
+func (browser *FileBrowser) IsConfigured() bool {
+	return len(browser.Roots) > 0
+}
+
+func (browser *FileBrowser) SelfTest() error {
+	if !browser.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	for name, dir := range browser.absRoots {
+		if _, err := ioutil.ReadDir(dir); err != nil {
+			return fmt.Errorf("FileBrowser.SelfTest: root \"%s\" is not readable - %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (browser *FileBrowser) Initialise() error {
+	browser.absRoots = make(map[string]string)
+	for name, dir := range browser.Roots {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("FileBrowser.Initialise: root name \"%s\" must not be empty or contain slash", name)
+		}
+		// Resolve symbolic links of the root itself, so that paths underneath it can be compared against it.
+		absDir, err := filepath.Abs(dir)
+		if err == nil {
+			absDir, err = filepath.EvalSymlinks(absDir)
+		}
+		if err != nil {
+			return fmt.Errorf("FileBrowser.Initialise: failed to resolve root \"%s\" - %v", name, err)
+		}
+		browser.absRoots[name] = absDir
+	}
+	return nil
+}
+
+func (browser *FileBrowser) Trigger() Trigger {
+	return FileBrowserTrigger
+}
+
+func (browser *FileBrowser) Usage() string {
+	return ErrBadFileBrowserParam.Error()
+}
+
+/*
+resolvePath turns a path that begins with a root name into an absolute path on the file system. Return an error if the
+path, after following symbolic links, is not underneath the root.
+*/
+func (browser *FileBrowser) resolvePath(path string) (string, error) {
+	path = strings.Trim(filepath.ToSlash(path), "/")
+	rootName, rest := path, ""
+	if slash := strings.IndexRune(path, '/'); slash != -1 {
+		rootName, rest = path[:slash], path[slash+1:]
+	}
+	root, found := browser.absRoots[rootName]
+	if !found {
+		return "", fmt.Errorf("Cannot find root %s", rootName)
+	}
+	// Cleaning an absolute path removes all leading ".." elements
+	absPath, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+rest)))
+	if err != nil {
+		return "", fmt.Errorf("Cannot find %s", path)
+	}
+	if absPath != root && !strings.HasPrefix(absPath, root+string(filepath.Separator)) {
+		return "", ErrFileBrowserOutsideRoot
+	}
+	return absPath, nil
+}
+
+// list returns the names of directory entries, sorted by name. Directory names end with slash and file names are followed by size.
+func (browser *FileBrowser) list(path string) (string, error) {
+	if path == "" {
+		names := make([]string, 0, len(browser.absRoots))
+		for name := range browser.absRoots {
+			names = append(names, name+"/")
+		}
+		sort.Strings(names)
+		return strings.Join(names, "\n"), nil
+	}
+	absPath, err := browser.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := ioutil.ReadDir(absPath)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("%d entries", len(entries)))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			out.WriteString(fmt.Sprintf("\n%s/", entry.Name()))
+		} else {
+			out.WriteString(fmt.Sprintf("\n%s %d", entry.Name(), entry.Size()))
+		}
+	}
+	return out.String(), nil
+}
+
+// stat returns type, size, permission, and modification time of a file or directory.
+func (browser *FileBrowser) stat(path string) (string, error) {
+	absPath, err := browser.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", err
+	}
+	fileType := "file"
+	if info.IsDir() {
+		fileType = "dir"
+	}
+	return fmt.Sprintf("%s size=%d mode=%s modified=%s", fileType, info.Size(), info.Mode().Perm(), info.ModTime().Format("2006-01-02 15:04:05 MST")), nil
+}
+
+// read returns content of a file starting from the offset. A negative offset counts backward from the end of file.
+func (browser *FileBrowser) read(path string, offset, length int64) (string, error) {
+	absPath, err := browser.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(absPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	whence := io.SeekStart
+	if offset < 0 {
+		whence = io.SeekEnd
+	}
+	if _, err := file.Seek(offset, whence); err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(file, length))
+	return string(content), err
+}
+
+/*
+tail returns the last lines of a file, reading only as much of the file as necessary. At most FileBrowserMaxReadLen
+bytes are read, in which case the lines found within are returned.
+*/
+func (browser *FileBrowser) tail(path string, numLines int) (string, error) {
+	absPath, err := browser.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(absPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	// Read backward in blocks until the content has enough lines, line breaks at the end of file do not count.
+	const blockSize = 4096
+	content := make([]byte, 0, blockSize)
+	var numLineBreaks int
+	var seenText bool
+	pos := size
+	for pos > 0 && size-pos < FileBrowserMaxReadLen && numLineBreaks < numLines {
+		readLen := int64(blockSize)
+		if pos < readLen {
+			readLen = pos
+		}
+		pos -= readLen
+		block := make([]byte, readLen)
+		if _, err := file.ReadAt(block, pos); err != nil {
+			return "", err
+		}
+		for i := len(block) - 1; i >= 0; i-- {
+			if block[i] != '\n' {
+				seenText = true
+			} else if seenText {
+				numLineBreaks++
+			}
+		}
+		// Blocks are collected in reverse order, and put in order after reading is finished.
+		content = append(content, block...)
+	}
+	// Reverse the order of blocks, each of which is of block size except the last one read.
+	ordered := make([]byte, 0, len(content))
+	for end := len(content); end > 0; {
+		begin := (end - 1) / blockSize * blockSize
+		ordered = append(ordered, content[begin:end]...)
+		end = begin
+	}
+	content = ordered
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(lines) > numLines {
+		lines = lines[len(lines)-numLines:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// grep returns the lines of a file that contain the case insensitive text, each line is prefixed by its line number.
+func (browser *FileBrowser) grep(path, text string) (string, error) {
+	absPath, err := browser.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(absPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	searchString := strings.ToLower(text)
+	var match bytes.Buffer
+	var numMatch int
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), FileBrowserMaxReadLen)
+	for lineNum := 1; scanner.Scan() && numMatch < FileBrowserMaxGrepMatch; lineNum++ {
+		if line := scanner.Text(); strings.Contains(strings.ToLower(line), searchString) {
+			match.WriteString(fmt.Sprintf("\n%d:%s", lineNum, line))
+			numMatch++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d%s", numMatch, match.String()), nil
+}
+
+// parseIntParams parses the optional integer parameters, and leaves the defaults untouched for those not given.
+func parseIntParams(in string, defaults ...*int64) error {
+	fields := strings.Fields(in)
+	if len(fields) > len(defaults) {
+		return ErrBadFileBrowserParam
+	}
+	for i, field := range fields {
+		num, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return ErrBadFileBrowserParam
+		}
+		*defaults[i] = num
+	}
+	return nil
+}
+
+func (browser *FileBrowser) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	action, param := splitWord(cmd.Content)
+	path, param := splitWord(param)
+	var out string
+	var err error
+	switch strings.ToLower(action) {
+	case FileBrowserActList:
+		out, err = browser.list(path)
+	case FileBrowserActStat:
+		out, err = browser.stat(path)
+	case FileBrowserActRead:
+		offset, length := int64(0), int64(FileBrowserDefaultReadLen)
+		if err = parseIntParams(param, &offset, &length); err == nil {
+			if length < 1 || length > FileBrowserMaxReadLen {
+				return &Result{Error: fmt.Errorf("Length must be between 1 and %d", FileBrowserMaxReadLen)}
+			}
+			out, err = browser.read(path, offset, length)
+		}
+	case FileBrowserActTail:
+		numLines := int64(FileBrowserDefaultTailLine)
+		if err = parseIntParams(param, &numLines); err == nil {
+			if numLines < 1 || numLines > FileBrowserMaxTailLine {
+				return &Result{Error: fmt.Errorf("Number of lines must be between 1 and %d", FileBrowserMaxTailLine)}
+			}
+			out, err = browser.tail(path, int(numLines))
+		}
+	case FileBrowserActGrep:
+		if param == "" {
+			return &Result{Error: ErrBadFileBrowserParam}
+		}
+		out, err = browser.grep(path, param)
+	default:
+		return &Result{Error: ErrBadFileBrowserParam}
+	}
+	return &Result{Output: out, Error: err}
+}
@@ -0,0 +1,119 @@
+package toolbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileBrowser_Execute(t *testing.T) {
+	browser := FileBrowser{}
+	if browser.IsConfigured() {
+		t.Fatal("should not be configured")
+	}
+	// Prepare a root directory with a file, a sub-directory, and symbolic links pointing inside and outside
+	root, err := ioutil.TempDir("", "laitos-TestFileBrowser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	var content string
+	for i := 1; i <= 2000; i++ {
+		content += fmt.Sprintf("line %d\n", i)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "inside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(root, "sub", "outside")); err != nil {
+		t.Fatal(err)
+	}
+	browser.Roots = map[string]string{"bad/name": root}
+	if err := browser.Initialise(); err == nil {
+		t.Fatal("did not error")
+	}
+	browser.Roots = map[string]string{"test": root, "nothing": "/this/does/not/exist"}
+	if err := browser.Initialise(); err == nil {
+		t.Fatal("did not error")
+	}
+	browser.Roots = map[string]string{"test": root}
+	if err := browser.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := browser.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	// Bad parameters
+	for _, content := range []string{"wrong", "read test/a.txt x", "read test/a.txt 0 0", "tail test/a.txt 0", "grep test/a.txt"} {
+		if ret := browser.Execute(Command{Content: content}); ret.Error == nil {
+			t.Fatal(content, ret)
+		}
+	}
+	// List
+	if ret := browser.Execute(Command{Content: "ls"}); ret.Error != nil || ret.Output != "test/" {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "ls test"}); ret.Error != nil || ret.Output != fmt.Sprintf("2 entries\na.txt %d\nsub/", len(content)) {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "ls /test/sub/"}); ret.Error != nil || !strings.HasPrefix(ret.Output, "2 entries\ninside ") {
+		t.Fatal(ret)
+	}
+	// Metadata
+	if ret := browser.Execute(Command{Content: "stat test/a.txt"}); ret.Error != nil || !strings.HasPrefix(ret.Output, fmt.Sprintf("file size=%d mode=-rw-r--r-- modified=", len(content))) {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "stat test"}); ret.Error != nil || !strings.HasPrefix(ret.Output, "dir ") {
+		t.Fatal(ret)
+	}
+	// Read byte ranges
+	if ret := browser.Execute(Command{Content: "read test/a.txt"}); ret.Error != nil || ret.Output != content[:FileBrowserDefaultReadLen] {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "read test/sub/inside 7 7"}); ret.Error != nil || ret.Output != "line 2\n" {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "read test/a.txt -10"}); ret.Error != nil || ret.Output != "line 2000\n" {
+		t.Fatal(ret)
+	}
+	// Tail
+	if ret := browser.Execute(Command{Content: "tail test/a.txt"}); ret.Error != nil || !strings.HasPrefix(ret.Output, "line 1991\n") || !strings.HasSuffix(ret.Output, "\nline 2000") {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "tail test/a.txt 1000"}); ret.Error != nil || strings.Count(ret.Output, "\n") != 999 || !strings.HasPrefix(ret.Output, "line 1001\n") {
+		t.Fatal(ret)
+	}
+	// A file with very long line exceeds the maximum read length of tail
+	if err := ioutil.WriteFile(filepath.Join(root, "long.txt"), []byte(strings.Repeat("a", 3*FileBrowserMaxReadLen)+"\nlast\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ret := browser.Execute(Command{Content: "tail test/long.txt"}); ret.Error != nil || len(ret.Output) > FileBrowserMaxReadLen ||
+		!strings.HasPrefix(ret.Output, "aaa") || !strings.HasSuffix(ret.Output, "a\nlast") {
+		t.Fatal(len(ret.Output), ret.Error)
+	}
+	// Grep
+	if ret := browser.Execute(Command{Content: "grep test/a.txt LINE 199"}); ret.Error != nil || ret.Output != "11\n199:line 199\n1990:line 1990\n1991:line 1991\n1992:line 1992\n1993:line 1993\n1994:line 1994\n1995:line 1995\n1996:line 1996\n1997:line 1997\n1998:line 1998\n1999:line 1999" {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "grep test/a.txt line"}); ret.Error != nil || !strings.HasPrefix(ret.Output, fmt.Sprintf("%d\n", FileBrowserMaxGrepMatch)) {
+		t.Fatal(ret)
+	}
+	// Paths may not escape the root
+	if ret := browser.Execute(Command{Content: "read test/../../../../etc/passwd"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "ls test/sub/outside"}); ret.Error != ErrFileBrowserOutsideRoot {
+		t.Fatal(ret)
+	}
+	if ret := browser.Execute(Command{Content: "ls nothing"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+}
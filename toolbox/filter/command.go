@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/HouzuoGuo/laitos/toolbox"
 	"strings"
+	"sync"
+	"time"
 )
 
 /*
@@ -19,17 +21,37 @@ type CommandFilter interface {
 Match prefix PIN (or pre-defined shortcuts) against lines among input command. Return the matched line trimmed
 and without PIN prefix, or expanded shortcut if found.
 To successfully expend shortcut, the shortcut must occupy the entire line, without extra prefix or suffix.
+In addition to the PIN, each user may have a PIN of their own, then the matched user's name is carried by the command.
 Return error if neither PIN nor pre-defined shortcuts matched any line of input command.
 */
 type PINAndShortcuts struct {
 	PIN       string            `json:"PIN"`
 	Shortcuts map[string]string `json:"Shortcuts"`
+	Users     []PINUser         `json:"Users"`
+}
+
+// PINUser is a named user who invokes toolbox features using their own PIN.
+type PINUser struct {
+	Name          string    `json:"Name"`
+	PIN           string    `json:"PIN"`
+	AllowTriggers []string  `json:"AllowTriggers"` // AllowTriggers restricts the features user may invoke (see TriggerAccess), empty means all.
+	Expiry        time.Time `json:"Expiry"`        // Expiry is the moment after which the user's PIN no longer works, zero value means never.
+}
+
+// IsExpired returns true only if user has an expiry moment and the moment has passed.
+func (user *PINUser) IsExpired() bool {
+	return !user.Expiry.IsZero() && time.Now().After(user.Expiry)
 }
 
 var ErrPINAndShortcutNotFound = errors.New("Failed to match PIN/shortcut")
 
+// IsConfigured returns true only if there is a PIN, shortcut, or user PIN.
+func (pin *PINAndShortcuts) IsConfigured() bool {
+	return pin.PIN != "" || pin.Shortcuts != nil && len(pin.Shortcuts) > 0 || pin.Users != nil && len(pin.Users) > 0
+}
+
 func (pin *PINAndShortcuts) Transform(cmd toolbox.Command) (toolbox.Command, error) {
-	if pin.PIN == "" && (pin.Shortcuts == nil || len(pin.Shortcuts) == 0) {
+	if !pin.IsConfigured() {
 		return toolbox.Command{}, errors.New("Both PIN and shortcuts are undefined")
 	}
 	for _, line := range cmd.Lines() {
@@ -42,10 +64,25 @@ func (pin *PINAndShortcuts) Transform(cmd toolbox.Command) (toolbox.Command, err
 				return ret, nil
 			}
 		}
-		// Try to match PIN prefix, then remove it from successfully matched line.
-		if len(line) > len(pin.PIN) && line[0:len(pin.PIN)] == pin.PIN {
+		// Try to match PIN prefix, then remove it from successfully matched line. The longest matched PIN wins.
+		matchedPIN := ""
+		matchedUser := ""
+		if pin.PIN != "" && len(line) > len(pin.PIN) && line[0:len(pin.PIN)] == pin.PIN {
+			matchedPIN = pin.PIN
+		}
+		for _, user := range pin.Users {
+			if user.PIN == "" || user.IsExpired() {
+				continue
+			}
+			if len(line) > len(user.PIN) && line[0:len(user.PIN)] == user.PIN && len(user.PIN) > len(matchedPIN) {
+				matchedPIN = user.PIN
+				matchedUser = user.Name
+			}
+		}
+		if matchedPIN != "" {
 			ret := cmd
-			ret.Content = line[len(pin.PIN):]
+			ret.Content = line[len(matchedPIN):]
+			ret.UserName = matchedUser
 			return ret, nil
 		}
 	}
@@ -53,6 +90,203 @@ func (pin *PINAndShortcuts) Transform(cmd toolbox.Command) (toolbox.Command, err
 	return cmd, ErrPINAndShortcutNotFound
 }
 
+/*
+IsUserAllowed returns true only if the user identified by name may invoke the feature trigger with the parameters.
+A command that does not carry a user name is not restricted by this function.
+*/
+func (pin *PINAndShortcuts) IsUserAllowed(userName string, trigger toolbox.Trigger, params string) bool {
+	if userName == "" {
+		return true
+	}
+	for _, user := range pin.Users {
+		if user.Name == userName {
+			acl := TriggerAccess{AllowTriggers: user.AllowTriggers}
+			return !user.IsExpired() && acl.IsAllowed(trigger, params)
+		}
+	}
+	return false
+}
+
+/*
+IsUserAllowedWithAnyParams returns true only if the user identified by name may invoke the feature trigger with at
+least some parameters. A command that does not carry a user name is not restricted by this function.
+*/
+func (pin *PINAndShortcuts) IsUserAllowedWithAnyParams(userName string, trigger toolbox.Trigger) bool {
+	if userName == "" {
+		return true
+	}
+	for _, user := range pin.Users {
+		if user.Name == userName {
+			acl := TriggerAccess{AllowTriggers: user.AllowTriggers}
+			return !user.IsExpired() && acl.IsAllowedWithAnyParams(trigger)
+		}
+	}
+	return false
+}
+
+/*
+TOTP expects a time-based one-time code (as calculated by toolbox.GetTwoFACodeForTimeDivision) to prefix a line among
+input command. Return the matched line trimmed and without the code prefix.
+Codes of previous, current, and next time step are accepted, but each of them may only be used once. The filter may be
+used in place of PIN, or placed after PINAndShortcuts to require both PIN and code. When placed after PINAndShortcuts,
+shortcuts no longer work because an expanded shortcut does not carry a code.
+Remember to call Initialise() before use!
+*/
+type TOTP struct {
+	Secret string `json:"Secret"` // Secret is the base32-encoded seed for calculating codes
+
+	usedTimeSteps map[int64]struct{} // usedTimeSteps are the time steps whose code has been used
+	mutex         *sync.Mutex
+}
+
+const (
+	TOTPCodeLength  = 6  // TOTPCodeLength is the number of digits in a code
+	TOTPTimeStepSec = 30 // TOTPTimeStepSec is the validity period of each code
+)
+
+var (
+	ErrTOTPNotFound       = errors.New("Failed to match one-time code")
+	ErrTOTPReused         = errors.New("One-time code has already been used")
+	ErrTOTPNotInitialised = errors.New("One-time code filter has not been initialised")
+)
+
+// IsConfigured returns true only if the secret seed is present.
+func (totp *TOTP) IsConfigured() bool {
+	return totp.Secret != ""
+}
+
+// Initialise prepares internal states for remembering used codes.
+func (totp *TOTP) Initialise() {
+	totp.usedTimeSteps = make(map[int64]struct{})
+	totp.mutex = new(sync.Mutex)
+}
+
+// SelfTest returns an error if the secret is unable to calculate a code.
+func (totp *TOTP) SelfTest() error {
+	_, err := toolbox.GetTwoFACodeForTimeDivision(totp.Secret, time.Now().Unix()/TOTPTimeStepSec)
+	return err
+}
+
+func (totp *TOTP) Transform(cmd toolbox.Command) (toolbox.Command, error) {
+	if !totp.IsConfigured() {
+		return cmd, nil
+	}
+	// Refuse to work instead of crashing, in case someone forgot to call Initialise.
+	if totp.mutex == nil {
+		return cmd, ErrTOTPNotInitialised
+	}
+	currentStep := time.Now().Unix() / TOTPTimeStepSec
+	for _, line := range cmd.Lines() {
+		line = strings.TrimSpace(line)
+		if len(line) <= TOTPCodeLength {
+			continue
+		}
+		for step := currentStep - 1; step <= currentStep+1; step++ {
+			code, err := toolbox.GetTwoFACodeForTimeDivision(totp.Secret, step)
+			if err != nil {
+				return cmd, err
+			}
+			if line[:TOTPCodeLength] != code {
+				continue
+			}
+			if !totp.markUsed(currentStep, step) {
+				return cmd, ErrTOTPReused
+			}
+			ret := cmd
+			ret.Content = strings.TrimSpace(line[TOTPCodeLength:])
+			return ret, nil
+		}
+	}
+	return cmd, ErrTOTPNotFound
+}
+
+// markUsed remembers that code of the time step has been used. Return false if it has already been used.
+func (totp *TOTP) markUsed(currentStep, usedStep int64) bool {
+	totp.mutex.Lock()
+	defer totp.mutex.Unlock()
+	// Forget about the steps whose code is no longer acceptable
+	for step := range totp.usedTimeSteps {
+		if step < currentStep-1 {
+			delete(totp.usedTimeSteps, step)
+		}
+	}
+	if _, used := totp.usedTimeSteps[usedStep]; used {
+		return false
+	}
+	totp.usedTimeSteps[usedStep] = struct{}{}
+	return true
+}
+
+/*
+TriggerAccess restricts which toolbox features may be invoked by a command processor. Each entry of the allow and deny
+lists is a feature trigger, optionally followed by the leading parameters of a command - ".s" matches all shell
+commands, whereas ".e kill" matches only the "kill" action of environment control.
+Deny list takes precedence over allow list. If allow list is empty, all features that are not denied are allowed.
+*/
+type TriggerAccess struct {
+	AllowTriggers []string `json:"AllowTriggers"`
+	DenyTriggers  []string `json:"DenyTriggers"`
+}
+
+var ErrTriggerNotAllowed = errors.New("Feature is not allowed here")
+
+// IsAllowed returns true only if the feature trigger may be invoked with the parameters.
+func (acl *TriggerAccess) IsAllowed(trigger toolbox.Trigger, params string) bool {
+	for _, rule := range acl.DenyTriggers {
+		if triggerRuleMatches(rule, trigger, params) {
+			return false
+		}
+	}
+	if acl.AllowTriggers == nil || len(acl.AllowTriggers) == 0 {
+		return true
+	}
+	for _, rule := range acl.AllowTriggers {
+		if triggerRuleMatches(rule, trigger, params) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+IsAllowedWithAnyParams returns true only if the feature trigger may be invoked with at least some parameters, that is
+the trigger is not denied entirely, and allow list is empty or has a rule for the trigger.
+*/
+func (acl *TriggerAccess) IsAllowedWithAnyParams(trigger toolbox.Trigger) bool {
+	for _, rule := range acl.DenyTriggers {
+		if triggerRuleMatches(rule, trigger, "") {
+			return false
+		}
+	}
+	if acl.AllowTriggers == nil || len(acl.AllowTriggers) == 0 {
+		return true
+	}
+	for _, rule := range acl.AllowTriggers {
+		if ruleFields := strings.Fields(strings.ToLower(rule)); len(ruleFields) > 0 && ruleFields[0] == strings.ToLower(string(trigger)) {
+			return true
+		}
+	}
+	return false
+}
+
+// triggerRuleMatches returns true if an access rule (trigger and optional parameters) matches the feature invocation.
+func triggerRuleMatches(rule string, trigger toolbox.Trigger, params string) bool {
+	ruleFields := strings.Fields(strings.ToLower(rule))
+	if len(ruleFields) == 0 || ruleFields[0] != strings.ToLower(string(trigger)) {
+		return false
+	}
+	paramFields := strings.Fields(strings.ToLower(params))
+	if len(ruleFields)-1 > len(paramFields) {
+		return false
+	}
+	for i, ruleParam := range ruleFields[1:] {
+		if ruleParam != paramFields[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Translate character sequences to something different.
 type TranslateSequences struct {
 	Sequences [][]string `json:"Sequences"`
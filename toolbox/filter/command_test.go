@@ -3,6 +3,7 @@ package filter
 import (
 	"github.com/HouzuoGuo/laitos/toolbox"
 	"testing"
+	"time"
 )
 
 func TestPINAndShortcuts_Transform(t *testing.T) {
@@ -39,6 +40,130 @@ func TestPINAndShortcuts_Transform(t *testing.T) {
 	}
 }
 
+func TestPINAndShortcuts_Users(t *testing.T) {
+	pin := PINAndShortcuts{Users: []PINUser{
+		{Name: "alice", PIN: "alicepin"},
+		{Name: "bob", PIN: "bobpin", AllowTriggers: []string{".e info"}},
+		{Name: "carol", PIN: "carolpin", Expiry: time.Now().Add(-time.Hour)},
+		{Name: "alice2", PIN: "alicepin2"},
+	}}
+	// Without a global PIN, nothing but the user PINs may match
+	if out, err := pin.Transform(toolbox.Command{Content: ".s echo hi"}); err != ErrPINAndShortcutNotFound || out.UserName != "" {
+		t.Fatal(out, err)
+	}
+	if out, err := pin.Transform(toolbox.Command{Content: "line\n alicepin.s echo hi "}); err != nil || out.Content != ".s echo hi" || out.UserName != "alice" {
+		t.Fatal(out, err)
+	}
+	// The longest PIN wins
+	if out, err := pin.Transform(toolbox.Command{Content: "alicepin2.s echo hi"}); err != nil || out.Content != ".s echo hi" || out.UserName != "alice2" {
+		t.Fatal(out, err)
+	}
+	// Expired user
+	if out, err := pin.Transform(toolbox.Command{Content: "carolpin.s echo hi"}); err != ErrPINAndShortcutNotFound || out.UserName != "" {
+		t.Fatal(out, err)
+	}
+	// User PIN and global PIN co-exist
+	pin.PIN = "alice"
+	if out, err := pin.Transform(toolbox.Command{Content: "alicepin.s echo hi"}); err != nil || out.Content != ".s echo hi" || out.UserName != "alice" {
+		t.Fatal(out, err)
+	}
+	if out, err := pin.Transform(toolbox.Command{Content: "alice.s echo hi"}); err != nil || out.Content != ".s echo hi" || out.UserName != "" {
+		t.Fatal(out, err)
+	}
+	// Permissions
+	if !pin.IsUserAllowed("", ".s", "echo hi") || !pin.IsUserAllowed("alice", ".s", "echo hi") {
+		t.Fatal("should have allowed")
+	}
+	if pin.IsUserAllowed("bob", ".s", "echo hi") || !pin.IsUserAllowed("bob", ".e", "info") {
+		t.Fatal("wrong permission for bob")
+	}
+	if pin.IsUserAllowed("carol", ".s", "echo hi") || pin.IsUserAllowed("dave", ".s", "echo hi") {
+		t.Fatal("should not allow expired or unknown user")
+	}
+	if !pin.IsUserAllowedWithAnyParams("", ".s") || pin.IsUserAllowedWithAnyParams("bob", ".s") || !pin.IsUserAllowedWithAnyParams("bob", ".e") ||
+		pin.IsUserAllowedWithAnyParams("carol", ".s") {
+		t.Fatal("wrong permission with any parameters")
+	}
+}
+
+func TestTOTP_Transform(t *testing.T) {
+	totp := TOTP{}
+	if out, err := totp.Transform(toolbox.Command{Content: "abc"}); err != nil || out.Content != "abc" {
+		t.Fatal(out, err)
+	}
+	totp.Secret = "!"
+	if err := totp.SelfTest(); err == nil {
+		t.Fatal("did not error")
+	}
+	totp.Secret = "iuu3xchz3ftf6hdh"
+	if out, err := totp.Transform(toolbox.Command{Content: "abc"}); err != ErrTOTPNotInitialised {
+		t.Fatal(out, err)
+	}
+	totp.Initialise()
+	if err := totp.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	prev, current, next, err := toolbox.GetTwoFACodes(totp.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badCode := "000000"
+	if badCode == prev || badCode == current || badCode == next {
+		badCode = "999999"
+	}
+	if out, err := totp.Transform(toolbox.Command{Content: badCode + " .s echo hi"}); err != ErrTOTPNotFound || out.Content != badCode+" .s echo hi" {
+		t.Fatal(out, err)
+	}
+	if out, err := totp.Transform(toolbox.Command{Content: current}); err != ErrTOTPNotFound {
+		t.Fatal(out, err)
+	}
+	if out, err := totp.Transform(toolbox.Command{Content: "line\n " + current + " .s echo hi \nline"}); err != nil || out.Content != ".s echo hi" {
+		t.Fatal(out, err)
+	}
+	// Each code may only be used once
+	if out, err := totp.Transform(toolbox.Command{Content: current + ".s echo hi"}); err != ErrTOTPReused {
+		t.Fatal(out, err)
+	}
+	// Code of previous time step is tolerated
+	if prev != current {
+		if out, err := totp.Transform(toolbox.Command{Content: prev + ".s echo hi"}); err != nil || out.Content != ".s echo hi" {
+			t.Fatal(out, err)
+		}
+	}
+}
+
+func TestTriggerAccess_IsAllowed(t *testing.T) {
+	acl := TriggerAccess{}
+	if !acl.IsAllowed(".s", "echo hi") || !acl.IsAllowed(".e", "kill") {
+		t.Fatal("empty access control should allow everything")
+	}
+	acl.DenyTriggers = []string{".s", " .E  Kill "}
+	if acl.IsAllowed(".s", "echo hi") || acl.IsAllowed(".s", "") {
+		t.Fatal("should have denied shell")
+	}
+	if acl.IsAllowed(".e", "kill") || acl.IsAllowed(".e", "  KILL  ") || !acl.IsAllowed(".e", "info") || !acl.IsAllowed(".e", "") {
+		t.Fatal("should have only denied kill")
+	}
+	acl.AllowTriggers = []string{".e", ".c police"}
+	if !acl.IsAllowed(".e", "info") || acl.IsAllowed(".e", "kill") {
+		t.Fatal("deny list should take precedence")
+	}
+	if !acl.IsAllowed(".c", "police station") || acl.IsAllowed(".c", "fire") || acl.IsAllowed(".c", "") {
+		t.Fatal("should have only allowed police")
+	}
+	if acl.IsAllowed(".w", "1+1") {
+		t.Fatal("should have denied feature that is not allowed")
+	}
+	// A trigger is allowed with some parameters unless it is denied entirely or missing from allow list
+	if !acl.IsAllowedWithAnyParams(".e") || !acl.IsAllowedWithAnyParams(".c") || acl.IsAllowedWithAnyParams(".w") {
+		t.Fatal("wrong permission with any parameters")
+	}
+	acl.AllowTriggers = nil
+	if acl.IsAllowedWithAnyParams(".s") || !acl.IsAllowedWithAnyParams(".w") {
+		t.Fatal("wrong permission with any parameters")
+	}
+}
+
 func TestTranslateSequences_Transform(t *testing.T) {
 	tr := TranslateSequences{}
 	if out, err := tr.Transform(toolbox.Command{Content: "abc"}); err != nil || out.Content != "abc" {
@@ -115,11 +115,14 @@ func (notify *NotifyViaEmail) IsConfigured() bool {
 }
 
 func (notify *NotifyViaEmail) Transform(result *toolbox.Result) error {
-	if notify.IsConfigured() && result.Error != ErrPINAndShortcutNotFound {
+	if notify.IsConfigured() && result.Error != ErrPINAndShortcutNotFound && result.Error != ErrTOTPNotFound {
 		go func() {
 			subject := inet.OutgoingMailSubjectKeyword + "-notify-" + result.Command.Content
+			if result.Command.UserName != "" {
+				subject = inet.OutgoingMailSubjectKeyword + "-notify-" + result.Command.UserName + "-" + result.Command.Content
+			}
 			if err := notify.MailClient.Send(subject, result.CombinedOutput, notify.Recipients...); err != nil {
-				notify.logger.Warning("Transform", "", err, "failed to send notification for command \"%s\"", result.Command.Content)
+				notify.logger.Warning("Transform", result.Command.UserName, err, "failed to send notification for command \"%s\"", result.Command.Content)
 			}
 		}()
 	}
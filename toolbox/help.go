@@ -0,0 +1,84 @@
+package toolbox
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	HelpTrigger = ".h"  // HelpTrigger is the trigger prefix string of Help feature.
+	HelpAll     = "all" // HelpAll asks Help feature to show usage of all features
+)
+
+/*
+Help lists the triggers of enabled features, and shows the command syntax of individual features. The output is kept
+compact to suit SMS and other channels that impose a small output length limit.
+*/
+type Help struct {
+	Features *FeatureSet `json:"-"` // Features are the features to describe
+	// IsTriggerAllowed optionally restricts the features to describe, command processor sets it according to its access control.
+	IsTriggerAllowed func(trigger Trigger) bool `json:"-"`
+}
+
+func (help *Help) IsConfigured() bool {
+	return help.Features != nil
+}
+
+func (help *Help) SelfTest() error {
+	if !help.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	return nil
+}
+
+func (help *Help) Initialise() error {
+	return nil
+}
+
+func (help *Help) Trigger() Trigger {
+	return HelpTrigger
+}
+
+func (help *Help) Usage() string {
+	return fmt.Sprintf("[trigger | %s]", HelpAll)
+}
+
+// getTriggers returns the triggers of enabled features that are allowed to be described, sorted in alphabetical order.
+func (help *Help) getTriggers() []string {
+	triggers := help.Features.GetTriggers()
+	if help.IsTriggerAllowed == nil {
+		return triggers
+	}
+	ret := make([]string, 0, len(triggers))
+	for _, trigger := range triggers {
+		if help.IsTriggerAllowed(Trigger(trigger)) {
+			ret = append(ret, trigger)
+		}
+	}
+	return ret
+}
+
+func (help *Help) Execute(cmd Command) *Result {
+	// Without a parameter, list the enabled triggers.
+	if errResult := cmd.Trim(); errResult != nil {
+		return &Result{Output: fmt.Sprintf("%s (%s trigger for usage)", strings.Join(help.getTriggers(), " "), HelpTrigger)}
+	}
+	if strings.ToLower(cmd.Content) == HelpAll {
+		var out bytes.Buffer
+		for _, trigger := range help.getTriggers() {
+			out.WriteString(fmt.Sprintf("%s %s\n", trigger, help.Features.LookupByTrigger[Trigger(trigger)].Usage()))
+		}
+		return &Result{Output: out.String()}
+	}
+	// The trigger prefix may be given with or without the leading dot
+	trigger := Trigger(cmd.Content)
+	if !strings.HasPrefix(cmd.Content, ".") {
+		trigger = Trigger("." + cmd.Content)
+	}
+	feature, exists := help.Features.LookupByTrigger[trigger]
+	if !exists || help.IsTriggerAllowed != nil && !help.IsTriggerAllowed(trigger) {
+		return &Result{Error: fmt.Errorf("%s is not enabled, see %s", trigger, HelpTrigger)}
+	}
+	return &Result{Output: fmt.Sprintf("%s %s", trigger, feature.Usage())}
+}
@@ -0,0 +1,45 @@
+package toolbox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHelp_Execute(t *testing.T) {
+	features := FeatureSet{}
+	if err := features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	help := features.LookupByTrigger[HelpTrigger]
+	if err := help.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	if ret := help.Execute(Command{Content: " "}); ret.Error != nil || ret.Output != ".c .e .h .k .s (.h trigger for usage)" {
+		t.Fatal(ret)
+	}
+	if ret := help.Execute(Command{Content: ".e"}); ret.Error != nil || ret.Output != ".e "+ErrBadEnvInfoChoice.Error() {
+		t.Fatal(ret)
+	}
+	if ret := help.Execute(Command{Content: "s"}); ret.Error != nil || ret.Output != ".s shell command" {
+		t.Fatal(ret)
+	}
+	if ret := help.Execute(Command{Content: ".w"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	if ret := help.Execute(Command{Content: "ALL"}); ret.Error != nil || strings.Count(ret.Output, "\n") != 5 || !strings.Contains(ret.Output, ".h [trigger | all]\n") {
+		t.Fatal(ret)
+	}
+	// Only the allowed features are described
+	features.Help.IsTriggerAllowed = func(trigger Trigger) bool {
+		return trigger != ".s"
+	}
+	if ret := help.Execute(Command{Content: " "}); ret.Error != nil || ret.Output != ".c .e .h .k (.h trigger for usage)" {
+		t.Fatal(ret)
+	}
+	if ret := help.Execute(Command{Content: ".s"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	if ret := help.Execute(Command{Content: "ALL"}); ret.Error != nil || strings.Count(ret.Output, "\n") != 4 || strings.Contains(ret.Output, ".s ") {
+		t.Fatal(ret)
+	}
+}
@@ -320,6 +320,10 @@ func (imap *IMAPAccounts) Trigger() Trigger {
 	return ".i"
 }
 
+func (imap *IMAPAccounts) Usage() string {
+	return ErrBadMailboxParam.Error()
+}
+
 func (imap *IMAPAccounts) ListMails(cmd Command) *Result {
 	// Find one string parameter and two numeric parameters among the content
 	params := RegexMailboxAndTwoNumbers.FindStringSubmatch(cmd.Content)
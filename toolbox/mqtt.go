@@ -0,0 +1,663 @@
+package toolbox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/inet"
+	"github.com/HouzuoGuo/laitos/misc"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MQTTTrigger         = ".q" // MQTTTrigger is the trigger prefix string of MQTT feature.
+	MQTTActPublish      = "pub"
+	MQTTActGet          = "get"
+	MQTTActWait         = "wait"
+	MQTTActSubscribe    = "sub"
+	MQTTActUnsubscribe  = "unsub"
+	MQTTDefaultPort     = 1883    // MQTTDefaultPort is the broker port number used by plain TCP connection.
+	MQTTDefaultTLSPort  = 8883    // MQTTDefaultTLSPort is the broker port number used by TLS connection.
+	MQTTKeepAliveSec    = 60      // MQTTKeepAliveSec is the keep-alive interval declared to broker, a ping is sent every half of the interval.
+	MQTTRetainedWaitSec = 3       // MQTTRetainedWaitSec is the number of seconds to wait for broker to deliver retained messages.
+	MQTTMaxPacketLen    = 1048576 // MQTTMaxPacketLen is the maximum length of a packet accepted from broker.
+	MQTTReconnectSec    = 10      // MQTTReconnectSec is the number of seconds to wait before reconnecting a lost subscription.
+)
+
+// MQTT control packet types, they occupy the upper four bits of the first byte of a packet.
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttSubscribe  = 8
+	mqttSubAck     = 9
+	mqttPingReq    = 12
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+var (
+	ErrBadMQTTParam = fmt.Errorf("%s alias message | %s alias | %s alias [text] | %s alias [text] | %s alias",
+		MQTTActPublish, MQTTActGet, MQTTActWait, MQTTActSubscribe, MQTTActUnsubscribe)
+	// mqttConnAckErrors explain the return codes of a refused connection.
+	mqttConnAckErrors = map[byte]string{
+		1: "unacceptable protocol version",
+		2: "client identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorised",
+	}
+)
+
+// appendMQTTString appends the string prefixed by its length to the buffer.
+func appendMQTTString(buf []byte, str string) []byte {
+	buf = append(buf, byte(len(str)>>8), byte(len(str)))
+	return append(buf, str...)
+}
+
+// parseMQTTString reads a length-prefixed string from the beginning of buffer, and returns the remainder of buffer.
+func parseMQTTString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, errors.New("string is truncated")
+	}
+	strLen := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+strLen {
+		return "", nil, errors.New("string is truncated")
+	}
+	return string(buf[2 : 2+strLen]), buf[2+strLen:], nil
+}
+
+// writeMQTTPacket writes a packet that consists of the first byte (type and flags), remaining length, and packet body.
+func writeMQTTPacket(writer io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	// Remaining length is encoded seven bits at a time, the highest bit indicates that more bytes follow.
+	remaining := len(body)
+	for {
+		digit := byte(remaining % 128)
+		remaining /= 128
+		if remaining > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if remaining == 0 {
+			break
+		}
+	}
+	_, err := writer.Write(append(packet, body...))
+	return err
+}
+
+// readMQTTPacket reads a packet and returns its first byte (type and flags) and body.
+func readMQTTPacket(reader *bufio.Reader) (header byte, body []byte, err error) {
+	if header, err = reader.ReadByte(); err != nil {
+		return
+	}
+	var remaining, multiplier int = 0, 1
+	for i := 0; ; i++ {
+		var digit byte
+		if digit, err = reader.ReadByte(); err != nil {
+			return
+		}
+		remaining += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		} else if i == 3 {
+			err = errors.New("malformed remaining length")
+			return
+		}
+	}
+	if remaining > MQTTMaxPacketLen {
+		err = fmt.Errorf("packet length %d exceeds limit", remaining)
+		return
+	}
+	body = make([]byte, remaining)
+	_, err = io.ReadFull(reader, body)
+	return
+}
+
+// MQTTMessage is an application message delivered by broker.
+type MQTTMessage struct {
+	Topic    string
+	Payload  []byte
+	Retained bool // Retained is true if broker kept the message for new subscribers, i.e. it is the last value of topic.
+}
+
+// parseMQTTPublish decodes a PUBLISH packet, and returns its packet ID if it requires an acknowledgement.
+func parseMQTTPublish(header byte, body []byte) (msg MQTTMessage, packetID uint16, err error) {
+	msg.Retained = header&0x01 != 0
+	topic, rest, err := parseMQTTString(body)
+	if err != nil {
+		return
+	}
+	msg.Topic = topic
+	if qos := (header >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			err = errors.New("packet ID is truncated")
+			return
+		}
+		packetID = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	msg.Payload = rest
+	return
+}
+
+/*
+MQTTClient is a connection to MQTT broker established by MQTT.Connect. It publishes messages, or subscribes to a topic
+and receives messages, one conversation at a time. A background routine keeps the connection alive until Disconnect.
+*/
+type MQTTClient struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex *sync.Mutex   // writeMutex serialises packets written by conversations and the keep-alive routine.
+	stopPing   chan struct{} // stopPing is closed to terminate the keep-alive routine.
+	packetID   uint16
+	pending    []MQTTMessage // pending are the messages that arrived during a conversation, to be retrieved by Receive.
+}
+
+// write sends a packet to broker.
+func (client *MQTTClient) write(header byte, body []byte) error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	client.conn.SetWriteDeadline(time.Now().Add(MQTTKeepAliveSec * time.Second))
+	return writeMQTTPacket(client.conn, header, body)
+}
+
+// nextPacketID returns a non-zero packet identifier for the next publish or subscribe request.
+func (client *MQTTClient) nextPacketID() uint16 {
+	client.packetID++
+	if client.packetID == 0 {
+		client.packetID = 1
+	}
+	return client.packetID
+}
+
+/*
+read returns the next packet other than a ping response. An application message is acknowledged if necessary and kept
+for Receive.
+*/
+func (client *MQTTClient) read(deadline time.Time) (header byte, body []byte, err error) {
+	client.conn.SetReadDeadline(deadline)
+	for {
+		if header, body, err = readMQTTPacket(client.reader); err != nil || header>>4 != mqttPingResp {
+			break
+		}
+	}
+	if err != nil || header>>4 != mqttPublish {
+		return
+	}
+	msg, packetID, err := parseMQTTPublish(header, body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("bad message - %v", err)
+	}
+	if packetID != 0 {
+		if err = client.write(mqttPubAck<<4, []byte{byte(packetID >> 8), byte(packetID)}); err != nil {
+			return
+		}
+	}
+	client.pending = append(client.pending, msg)
+	return
+}
+
+// Publish sends the message to topic with "at least once" quality of service, and waits for broker's acknowledgement.
+func (client *MQTTClient) Publish(topic string, payload []byte, deadline time.Time) error {
+	packetID := client.nextPacketID()
+	body := appendMQTTString(nil, topic)
+	body = append(body, byte(packetID>>8), byte(packetID))
+	body = append(body, payload...)
+	if err := client.write(mqttPublish<<4|0x02, body); err != nil {
+		return err
+	}
+	for {
+		header, body, err := client.read(deadline)
+		if err != nil {
+			return err
+		}
+		if header>>4 == mqttPubAck && len(body) == 2 && binary.BigEndian.Uint16(body) == packetID {
+			return nil
+		}
+	}
+}
+
+// Subscribe asks broker to deliver messages of the topic (that may contain wildcards), and waits for broker's acknowledgement.
+func (client *MQTTClient) Subscribe(topic string, deadline time.Time) error {
+	packetID := client.nextPacketID()
+	body := []byte{byte(packetID >> 8), byte(packetID)}
+	body = appendMQTTString(body, topic)
+	// Ask for "at most once" quality of service
+	body = append(body, 0)
+	if err := client.write(mqttSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	for {
+		header, body, err := client.read(deadline)
+		if err != nil {
+			return err
+		}
+		if header>>4 == mqttSubAck && len(body) == 3 && binary.BigEndian.Uint16(body) == packetID {
+			if body[2] == 0x80 {
+				return fmt.Errorf("broker refused subscription to %s", topic)
+			}
+			return nil
+		}
+	}
+}
+
+// Receive returns the next message delivered by broker to subscriptions.
+func (client *MQTTClient) Receive(deadline time.Time) (MQTTMessage, error) {
+	for len(client.pending) == 0 {
+		if _, _, err := client.read(deadline); err != nil {
+			return MQTTMessage{}, err
+		}
+	}
+	msg := client.pending[0]
+	client.pending = client.pending[1:]
+	return msg, nil
+}
+
+// keepAlive sends a ping to broker every half of keep-alive interval, until stopPing is closed.
+func (client *MQTTClient) keepAlive() {
+	ticker := time.NewTicker(MQTTKeepAliveSec / 2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.stopPing:
+			return
+		case <-ticker.C:
+			if err := client.write(mqttPingReq<<4, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Disconnect tells broker that the client is going away, and then closes the connection.
+func (client *MQTTClient) Disconnect() {
+	close(client.stopPing)
+	client.write(mqttDisconnect<<4, nil) // intentionally ignore IO error
+	client.conn.Close()
+}
+
+/*
+MQTT publishes messages to and reads messages from topics on an MQTT (version 3.1.1) broker, such as those used by
+home automation. Topics are referred to by their alias in commands. A topic may also be subscribed to in background,
+so that its new messages are delivered to mail recipients as they arrive.
+*/
+type MQTT struct {
+	Host       string            `json:"Host"`       // Host is the broker's host name or IP address.
+	Port       int               `json:"Port"`       // Port is the broker's port number, defaults to 1883 or 8883 with TLS.
+	TLS        bool              `json:"TLS"`        // TLS connects to broker via TLS.
+	Username   string            `json:"Username"`   // Username authenticates the client, it may be left empty.
+	Password   string            `json:"Password"`   // Password authenticates the client, it may be left empty.
+	ClientID   string            `json:"ClientID"`   // ClientID is the prefix of client identifier, defaults to "laitos".
+	Topics     map[string]string `json:"Topics"`     // Topics are topic names (or filters with wildcards) keyed by a short alias (\w+) used in commands.
+	Recipients []string          `json:"Recipients"` // Recipients are mail addresses that receive new messages of subscribed topics.
+	MailClient inet.MailClient   `json:"-"`          // MailClient delivers new messages of subscribed topics to recipients.
+
+	subscriptions      map[string]*mqttSubscription // subscriptions are the background subscriptions keyed by topic alias.
+	subscriptionsMutex *sync.Mutex
+	logger             misc.Logger
+}
+
+// mqttSubscription is a background subscription to a topic, whose new messages are mailed to recipients.
+type mqttSubscription struct {
+	topic string
+	text  string        // text is the lower case text that a message must contain to be delivered.
+	stop  chan struct{} // stop is closed to end the subscription.
+}
+
+func (mqtt *MQTT) IsConfigured() bool {
+	return mqtt.Host != "" && len(mqtt.Topics) > 0
+}
+
+func (mqtt *MQTT) SelfTest() error {
+	if !mqtt.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	client, err := mqtt.Connect(SelfTestTimeoutSec)
+	if err != nil {
+		return fmt.Errorf("MQTT.SelfTest: %v", err)
+	}
+	client.Disconnect()
+	return nil
+}
+
+func (mqtt *MQTT) Initialise() error {
+	if mqtt.Port < 1 {
+		mqtt.Port = MQTTDefaultPort
+		if mqtt.TLS {
+			mqtt.Port = MQTTDefaultTLSPort
+		}
+	}
+	if mqtt.ClientID == "" {
+		mqtt.ClientID = "laitos"
+	}
+	for alias, topic := range mqtt.Topics {
+		if alias == "" || strings.ContainsAny(alias, " \t\r\n") || topic == "" {
+			return fmt.Errorf("MQTT.Initialise: alias \"%s\" must be a single word and its topic must not be empty", alias)
+		}
+	}
+	mqtt.subscriptions = make(map[string]*mqttSubscription)
+	mqtt.subscriptionsMutex = new(sync.Mutex)
+	mqtt.logger = misc.Logger{ComponentName: "MQTT", ComponentID: mqtt.Host}
+	return nil
+}
+
+func (mqtt *MQTT) Trigger() Trigger {
+	return MQTTTrigger
+}
+
+func (mqtt *MQTT) Usage() string {
+	return ErrBadMQTTParam.Error()
+}
+
+/*
+Connect establishes a connection to broker and logs in. Each connection uses a new client identifier, so that
+concurrent commands do not interfere with each other, and broker does not keep session state after disconnection.
+*/
+func (mqtt *MQTT) Connect(timeoutSec int) (*MQTTClient, error) {
+	deadline := time.Now().Add(time.Duration(timeoutSec) * time.Second)
+	dialer := &net.Dialer{Deadline: deadline}
+	addr := net.JoinHostPort(mqtt.Host, strconv.Itoa(mqtt.Port))
+	var conn net.Conn
+	var err error
+	if mqtt.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: mqtt.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("MQTT.Connect: connection error - %v", err)
+	}
+	randomID := make([]byte, 4)
+	if _, err := rand.Read(randomID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Connect with a clean session, the flags indicate presence of user name and password.
+	var flags byte = 0x02
+	if mqtt.Username != "" {
+		flags |= 0x80
+	}
+	if mqtt.Password != "" {
+		flags |= 0x40
+	}
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags, byte(MQTTKeepAliveSec>>8), byte(MQTTKeepAliveSec&0xff))
+	body = appendMQTTString(body, mqtt.ClientID+"-"+hex.EncodeToString(randomID))
+	if mqtt.Username != "" {
+		body = appendMQTTString(body, mqtt.Username)
+	}
+	if mqtt.Password != "" {
+		body = appendMQTTString(body, mqtt.Password)
+	}
+	client := &MQTTClient{
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		writeMutex: new(sync.Mutex),
+		stopPing:   make(chan struct{}),
+	}
+	if err := client.write(mqttConnect<<4, body); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT.Connect: IO error - %v", err)
+	}
+	header, body, err := client.read(deadline)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT.Connect: IO error - %v", err)
+	} else if header>>4 != mqttConnAck || len(body) != 2 {
+		conn.Close()
+		return nil, errors.New("MQTT.Connect: broker did not acknowledge connection")
+	} else if body[1] != 0 {
+		conn.Close()
+		if reason, found := mqttConnAckErrors[body[1]]; found {
+			return nil, fmt.Errorf("MQTT.Connect: broker refused connection - %s", reason)
+		}
+		return nil, fmt.Errorf("MQTT.Connect: broker refused connection with code %d", body[1])
+	}
+	go client.keepAlive()
+	return client, nil
+}
+
+// formatMQTTMessages returns the message payloads one per line. If the topic contains wildcards, each payload is prefixed by its topic.
+func formatMQTTMessages(topic string, msgs []MQTTMessage) string {
+	var out bytes.Buffer
+	for i, msg := range msgs {
+		if i > 0 {
+			out.WriteRune('\n')
+		}
+		if strings.ContainsAny(topic, "+#") {
+			out.WriteString(msg.Topic + ": ")
+		}
+		out.Write(msg.Payload)
+	}
+	return out.String()
+}
+
+/*
+getLastValue returns the retained message of the topic. If the topic contains wildcards, it returns the retained
+messages of all matching topics.
+*/
+func getLastValue(client *MQTTClient, topic string, deadline time.Time) (string, error) {
+	if err := client.Subscribe(topic, deadline); err != nil {
+		return "", err
+	}
+	// Broker delivers retained messages right after acknowledging the subscription
+	if waitUntil := time.Now().Add(MQTTRetainedWaitSec * time.Second); waitUntil.Before(deadline) {
+		deadline = waitUntil
+	}
+	var msgs []MQTTMessage
+	for {
+		msg, err := client.Receive(deadline)
+		if err != nil {
+			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+				return "", err
+			}
+			break
+		}
+		if msg.Retained {
+			msgs = append(msgs, msg)
+			if !strings.ContainsAny(topic, "+#") {
+				break
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return "", fmt.Errorf("%s does not have a retained value", topic)
+	}
+	return formatMQTTMessages(topic, msgs), nil
+}
+
+/*
+waitForMessage waits for the next new message of the topic that contains the case insensitive text, and returns it.
+The wait is bound by the deadline, there is no notification of messages that arrive afterwards.
+*/
+func waitForMessage(client *MQTTClient, topic, text string, deadline time.Time) (string, error) {
+	if err := client.Subscribe(topic, deadline); err != nil {
+		return "", err
+	}
+	text = strings.ToLower(text)
+	for {
+		msg, err := client.Receive(deadline)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return "", fmt.Errorf("No message arrived at %s in time", topic)
+		} else if err != nil {
+			return "", err
+		}
+		if !msg.Retained && strings.Contains(strings.ToLower(string(msg.Payload)), text) {
+			return formatMQTTMessages(topic, []MQTTMessage{msg}), nil
+		}
+	}
+}
+
+/*
+subscribe starts a background subscription to the topic, each new message that contains the case insensitive text is
+mailed to recipients. The subscription lasts until it is unsubscribed, or the feature is replaced by configuration
+reload. An existing subscription of the same alias is replaced.
+*/
+func (mqtt *MQTT) subscribe(alias, topic, text string, timeoutSec int) *Result {
+	if len(mqtt.Recipients) == 0 || !mqtt.MailClient.IsConfigured() {
+		return &Result{Error: errors.New("Recipients and mail client must be configured to subscribe")}
+	}
+	deadline := time.Now().Add(time.Duration(timeoutSec) * time.Second)
+	client, err := mqtt.Connect(timeoutSec)
+	if err != nil {
+		return &Result{Error: err}
+	}
+	if err := client.Subscribe(topic, deadline); err != nil {
+		client.Disconnect()
+		return &Result{Error: err}
+	}
+	sub := &mqttSubscription{topic: topic, text: strings.ToLower(text), stop: make(chan struct{})}
+	mqtt.subscriptionsMutex.Lock()
+	if previous, exists := mqtt.subscriptions[alias]; exists {
+		close(previous.stop)
+	}
+	mqtt.subscriptions[alias] = sub
+	mqtt.subscriptionsMutex.Unlock()
+	go mqtt.keepSubscribed(sub, client)
+	return &Result{Output: fmt.Sprintf("subscribed to %s, new messages will be mailed to %s", topic, strings.Join(mqtt.Recipients, ", "))}
+}
+
+// unsubscribe ends the background subscription of the topic alias.
+func (mqtt *MQTT) unsubscribe(alias string) *Result {
+	mqtt.subscriptionsMutex.Lock()
+	defer mqtt.subscriptionsMutex.Unlock()
+	sub, exists := mqtt.subscriptions[alias]
+	if !exists {
+		return &Result{Error: fmt.Errorf("%s is not subscribed", alias)}
+	}
+	delete(mqtt.subscriptions, alias)
+	close(sub.stop)
+	return &Result{Output: "unsubscribed from " + sub.topic}
+}
+
+// StopSubscriptions ends all background subscriptions, it is used when the feature is no longer in use.
+func (mqtt *MQTT) StopSubscriptions() {
+	if mqtt.subscriptionsMutex == nil {
+		return
+	}
+	mqtt.subscriptionsMutex.Lock()
+	defer mqtt.subscriptionsMutex.Unlock()
+	for alias, sub := range mqtt.subscriptions {
+		delete(mqtt.subscriptions, alias)
+		close(sub.stop)
+	}
+}
+
+/*
+keepSubscribed mails the new messages of subscription that arrive via the connected client. If the connection is lost,
+it reconnects to broker and subscribes again. It returns after the subscription has been stopped.
+*/
+func (mqtt *MQTT) keepSubscribed(sub *mqttSubscription, client *MQTTClient) {
+	for {
+		// Disconnecting the client interrupts the wait for the next message
+		lost := make(chan struct{})
+		go func(client *MQTTClient) {
+			select {
+			case <-sub.stop:
+			case <-lost:
+			}
+			client.Disconnect()
+		}(client)
+		for {
+			msg, err := client.Receive(time.Time{})
+			if err != nil {
+				break
+			}
+			if !msg.Retained && strings.Contains(strings.ToLower(string(msg.Payload)), sub.text) {
+				mqtt.notify(sub.topic, msg)
+			}
+		}
+		close(lost)
+		// Reconnect and subscribe again, unless the subscription has been stopped.
+		for client = nil; client == nil; {
+			select {
+			case <-sub.stop:
+				return
+			case <-time.After(MQTTReconnectSec * time.Second):
+			}
+			newClient, err := mqtt.Connect(MQTTReconnectSec)
+			if err != nil {
+				mqtt.logger.Warning("keepSubscribed", sub.topic, err, "failed to reconnect")
+				continue
+			}
+			if err := newClient.Subscribe(sub.topic, time.Now().Add(MQTTReconnectSec*time.Second)); err != nil {
+				mqtt.logger.Warning("keepSubscribed", sub.topic, err, "failed to subscribe again")
+				newClient.Disconnect()
+				continue
+			}
+			client = newClient
+		}
+	}
+}
+
+// notify mails a new message of the subscribed topic to recipients.
+func (mqtt *MQTT) notify(topic string, msg MQTTMessage) {
+	subject := inet.OutgoingMailSubjectKeyword + "-mqtt-" + msg.Topic
+	if err := mqtt.MailClient.Send(subject, formatMQTTMessages(topic, []MQTTMessage{msg}), mqtt.Recipients...); err != nil {
+		mqtt.logger.Warning("notify", msg.Topic, err, "failed to mail the new message")
+	}
+}
+
+func (mqtt *MQTT) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	action, param := splitWord(cmd.Content)
+	alias, param := splitWord(param)
+	action = strings.ToLower(action)
+	if alias == "" || (action == MQTTActPublish && param == "") ||
+		(action != MQTTActPublish && action != MQTTActGet && action != MQTTActWait && action != MQTTActSubscribe && action != MQTTActUnsubscribe) {
+		return &Result{Error: ErrBadMQTTParam}
+	}
+	topic, found := mqtt.Topics[alias]
+	if !found {
+		aliases := make([]string, 0, len(mqtt.Topics))
+		for name := range mqtt.Topics {
+			aliases = append(aliases, name)
+		}
+		sort.Strings(aliases)
+		return &Result{Error: fmt.Errorf("Cannot find %s, choose from: %s", alias, strings.Join(aliases, " "))}
+	}
+	if action == MQTTActPublish && strings.ContainsAny(topic, "+#") {
+		return &Result{Error: fmt.Errorf("Cannot publish to topic filter %s", topic)}
+	}
+	switch action {
+	case MQTTActSubscribe:
+		return mqtt.subscribe(alias, topic, param, cmd.TimeoutSec)
+	case MQTTActUnsubscribe:
+		return mqtt.unsubscribe(alias)
+	}
+	deadline := time.Now().Add(time.Duration(cmd.TimeoutSec) * time.Second)
+	client, err := mqtt.Connect(cmd.TimeoutSec)
+	if err != nil {
+		return &Result{Error: err}
+	}
+	defer client.Disconnect()
+	var out string
+	switch action {
+	case MQTTActPublish:
+		if err = client.Publish(topic, []byte(param), deadline); err == nil {
+			out = fmt.Sprintf("published %d bytes to %s", len(param), topic)
+		}
+	case MQTTActGet:
+		out, err = getLastValue(client, topic, deadline)
+	case MQTTActWait:
+		out, err = waitForMessage(client, topic, param, deadline)
+	}
+	return &Result{Output: out, Error: err}
+}
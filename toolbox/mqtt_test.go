@@ -0,0 +1,292 @@
+package toolbox
+
+import (
+	"bufio"
+	"github.com/HouzuoGuo/laitos/inet"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mqttTopicMatches returns true if the topic matches the subscription filter that may contain wildcards.
+func mqttTopicMatches(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		} else if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// mqttTestBroker is a minimal MQTT broker that keeps retained messages and forwards messages to subscribers.
+type mqttTestBroker struct {
+	listener    net.Listener
+	mutex       sync.Mutex
+	retained    map[string]string
+	subscribers map[net.Conn]string
+}
+
+func (broker *mqttTestBroker) write(conn net.Conn, header byte, body []byte) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	writeMQTTPacket(conn, header, body)
+}
+
+func (broker *mqttTestBroker) serve(conn net.Conn) {
+	defer func() {
+		broker.mutex.Lock()
+		delete(broker.subscribers, conn)
+		broker.mutex.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		header, body, err := readMQTTPacket(reader)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case mqttConnect:
+			// Skip protocol name, level, flags, and keep-alive to read client ID, user name, and password.
+			_, rest, _ := parseMQTTString(body)
+			_, rest, _ = parseMQTTString(rest[4:])
+			user, rest, _ := parseMQTTString(rest)
+			password, _, _ := parseMQTTString(rest)
+			if user != "user" || password != "pass" {
+				broker.write(conn, mqttConnAck<<4, []byte{0, 4})
+				return
+			}
+			broker.write(conn, mqttConnAck<<4, []byte{0, 0})
+		case mqttPublish:
+			msg, packetID, _ := parseMQTTPublish(header, body)
+			if packetID != 0 {
+				broker.write(conn, mqttPubAck<<4, []byte{byte(packetID >> 8), byte(packetID)})
+			}
+			broker.mutex.Lock()
+			if msg.Retained {
+				broker.retained[msg.Topic] = string(msg.Payload)
+			}
+			for subscriber, filter := range broker.subscribers {
+				if mqttTopicMatches(filter, msg.Topic) {
+					writeMQTTPacket(subscriber, mqttPublish<<4, append(appendMQTTString(nil, msg.Topic), msg.Payload...))
+				}
+			}
+			broker.mutex.Unlock()
+		case mqttSubscribe:
+			filter, _, _ := parseMQTTString(body[2:])
+			broker.write(conn, mqttSubAck<<4, []byte{body[0], body[1], 0})
+			broker.mutex.Lock()
+			broker.subscribers[conn] = filter
+			topics := make([]string, 0, len(broker.retained))
+			for topic := range broker.retained {
+				topics = append(topics, topic)
+			}
+			sort.Strings(topics)
+			for _, topic := range topics {
+				if mqttTopicMatches(filter, topic) {
+					writeMQTTPacket(conn, mqttPublish<<4|0x01, append(appendMQTTString(nil, topic), broker.retained[topic]...))
+				}
+			}
+			broker.mutex.Unlock()
+		case mqttPingReq:
+			broker.write(conn, mqttPingResp<<4, nil)
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+// serveMailCapture is a minimal SMTP server that sends the data of each received mail to the channel.
+func serveMailCapture(listener net.Listener, mails chan<- string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			conn.Write([]byte("220 localhost\r\n"))
+			var data []string
+			inData := false
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				line = strings.TrimRight(line, "\r\n")
+				switch {
+				case inData && line == ".":
+					inData = false
+					mails <- strings.Join(data, "\n")
+					data = nil
+					conn.Write([]byte("250 OK\r\n"))
+				case inData:
+					data = append(data, line)
+				case strings.HasPrefix(line, "DATA"):
+					inData = true
+					conn.Write([]byte("354 Go ahead\r\n"))
+				case strings.HasPrefix(line, "QUIT"):
+					conn.Write([]byte("221 Bye\r\n"))
+					return
+				default:
+					conn.Write([]byte("250 OK\r\n"))
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestMQTT_Execute(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	broker := &mqttTestBroker{
+		listener:    listener,
+		retained:    map[string]string{"home/light": "on", "home/door": "open"},
+		subscribers: make(map[net.Conn]string),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+
+	mqtt := MQTT{}
+	if mqtt.IsConfigured() {
+		t.Fatal("should not be configured")
+	}
+	mqtt = MQTT{
+		Host:     "127.0.0.1",
+		Username: "user",
+		Password: "wrong",
+		Topics:   map[string]string{"light": "home/light", "door": "home/door", "all": "home/#", "fan": "home/fan"},
+	}
+	if !mqtt.IsConfigured() {
+		t.Fatal("not configured")
+	}
+	if err := mqtt.Initialise(); err != nil || mqtt.Port != MQTTDefaultPort || mqtt.ClientID != "laitos" {
+		t.Fatal(err, mqtt)
+	}
+	mqtt.Port = listener.Addr().(*net.TCPAddr).Port
+	if err := mqtt.SelfTest(); err == nil || !strings.Contains(err.Error(), "bad user name or password") {
+		t.Fatal(err)
+	}
+	mqtt.Password = "pass"
+	if err := mqtt.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	// Bad parameters
+	for _, content := range []string{"wrong", "pub", "pub light", "get", "sub", "unsub"} {
+		if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: content}); ret.Error != ErrBadMQTTParam {
+			t.Fatal(content, ret)
+		}
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "get nothing"}); ret.Error == nil || !strings.Contains(ret.Error.Error(), "all door fan light") {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "pub all off"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	// Get last value
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "get light"}); ret.Error != nil || ret.Output != "on" {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "get all"}); ret.Error != nil || ret.Output != "home/door: open\nhome/light: on" {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "get fan"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	// Wait for a message that contains the text, the retained value does not count.
+	subResult := make(chan *Result, 1)
+	go func() {
+		subResult <- mqtt.Execute(Command{TimeoutSec: 5, Content: "wait door OPEN"})
+	}()
+	time.Sleep(1 * time.Second)
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "pub door closed"}); ret.Error != nil || ret.Output != "published 6 bytes to home/door" {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "pub door opened again"}); ret.Error != nil {
+		t.Fatal(ret)
+	}
+	if ret := <-subResult; ret.Error != nil || ret.Output != "opened again" {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 1, Content: "wait all"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+
+	// Subscribing requires mail recipients
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "sub door"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "unsub door"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	mailListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mailListener.Close()
+	mails := make(chan string, 10)
+	go serveMailCapture(mailListener, mails)
+	mqtt.Recipients = []string{"howard@localhost"}
+	mqtt.MailClient = inet.MailClient{
+		MailFrom: "howard@localhost",
+		MTAHost:  "127.0.0.1",
+		MTAPort:  mailListener.Addr().(*net.TCPAddr).Port,
+	}
+	// Subscribe to messages that contain the text, the retained value is not mailed.
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "sub door OPEN"}); ret.Error != nil || ret.Output != "subscribed to home/door, new messages will be mailed to howard@localhost" {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "pub door closed"}); ret.Error != nil {
+		t.Fatal(ret)
+	}
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "pub door opened by cat"}); ret.Error != nil {
+		t.Fatal(ret)
+	}
+	select {
+	case mail := <-mails:
+		if !strings.Contains(mail, "Subject: "+inet.OutgoingMailSubjectKeyword+"-mqtt-home/door") || !strings.Contains(mail, "opened by cat") ||
+			strings.Contains(mail, "closed") {
+			t.Fatal(mail)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not mail the new message")
+	}
+	// After unsubscribing, new messages are no longer mailed.
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "unsub door"}); ret.Error != nil || ret.Output != "unsubscribed from home/door" {
+		t.Fatal(ret)
+	}
+	time.Sleep(1 * time.Second)
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "pub door opened by dog"}); ret.Error != nil {
+		t.Fatal(ret)
+	}
+	select {
+	case mail := <-mails:
+		t.Fatal("should not have mailed", mail)
+	case <-time.After(2 * time.Second):
+	}
+	// Stopping all subscriptions
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "sub all"}); ret.Error != nil {
+		t.Fatal(ret)
+	}
+	mqtt.StopSubscriptions()
+	if ret := mqtt.Execute(Command{TimeoutSec: 5, Content: "unsub all"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+}
@@ -0,0 +1,222 @@
+package toolbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/inet"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NetDiagTrigger    = ".d" // NetDiagTrigger is the trigger prefix string of NetDiag feature.
+	NetDiagActDNS     = "dns"
+	NetDiagActReverse = "rdns"
+	NetDiagActTCP     = "tcp"
+	NetDiagActHTTP    = "http"
+)
+
+var ErrBadNetDiagParam = fmt.Errorf("%s name [a|aaaa|mx|txt] [@resolver] | %s ip [@resolver] | %s host port | %s url",
+	NetDiagActDNS, NetDiagActReverse, NetDiagActTCP, NetDiagActHTTP)
+
+/*
+NetDiag runs network diagnostics natively without relying on system programs: DNS lookup, reverse DNS lookup, TCP port
+probe, and HTTP HEAD request. The output is compact to suit SMS and other channels that impose a small output length
+limit.
+Port probe and HTTP request can reach hosts that are only accessible from the server's network, hence the feature has
+to be enabled explicitly.
+*/
+type NetDiag struct {
+	Enabled bool `json:"Enabled"` // Enabled makes the feature available to command processors.
+}
+
+func (diag *NetDiag) IsConfigured() bool {
+	return diag.Enabled
+}
+
+func (diag *NetDiag) SelfTest() error {
+	return nil
+}
+
+func (diag *NetDiag) Initialise() error {
+	return nil
+}
+
+func (diag *NetDiag) Trigger() Trigger {
+	return NetDiagTrigger
+}
+
+func (diag *NetDiag) Usage() string {
+	return ErrBadNetDiagParam.Error()
+}
+
+// FormatDuration returns the duration in milliseconds, e.g. "123ms".
+func FormatDuration(duration time.Duration) string {
+	return fmt.Sprintf("%dms", duration/time.Millisecond)
+}
+
+/*
+getResolver returns a DNS resolver that queries the specified server (e.g. "8.8.8.8" or "8.8.8.8:53"). If server is
+empty, the resolver uses system settings.
+*/
+func getResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// LookupDNS queries DNS records of the type (A, AAAA, MX, or TXT) for the name. Each record is written on its own line.
+func LookupDNS(ctx context.Context, resolver *net.Resolver, name, recordType string) (string, error) {
+	var out bytes.Buffer
+	recordType = strings.ToUpper(recordType)
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		for _, addr := range addrs {
+			if (addr.IP.To4() != nil) == (network == "ip4") {
+				out.WriteString(fmt.Sprintf("%s %s\n", recordType, addr.IP))
+			}
+		}
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		for _, mx := range mxs {
+			out.WriteString(fmt.Sprintf("MX %d %s\n", mx.Pref, mx.Host))
+		}
+	case "TXT":
+		txts, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		for _, txt := range txts {
+			out.WriteString(fmt.Sprintf("TXT %s\n", txt))
+		}
+	default:
+		return "", ErrBadNetDiagParam
+	}
+	if out.Len() == 0 {
+		return "", fmt.Errorf("No %s record", recordType)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// ProbeTCP connects to the port and reports the time it takes to establish the connection.
+func ProbeTCP(ctx context.Context, host, port string) (string, error) {
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return fmt.Sprintf("open %s %s", FormatDuration(time.Since(start)), conn.RemoteAddr()), nil
+}
+
+// SummariseTLS returns the TLS version and a summary of the server certificate: subject, issuer, and expiry.
+func SummariseTLS(state *tls.ConnectionState) string {
+	version := "TLS"
+	switch state.Version {
+	case tls.VersionTLS10:
+		version = "TLS1.0"
+	case tls.VersionTLS11:
+		version = "TLS1.1"
+	case tls.VersionTLS12:
+		version = "TLS1.2"
+	case tls.VersionTLS13:
+		version = "TLS1.3"
+	}
+	if len(state.PeerCertificates) == 0 {
+		return version
+	}
+	cert := state.PeerCertificates[0]
+	subject, issuer := cert.Subject.CommonName, cert.Issuer.CommonName
+	if subject == "" && len(cert.DNSNames) > 0 {
+		subject = cert.DNSNames[0]
+	}
+	if issuer == "" && len(cert.Issuer.Organization) > 0 {
+		issuer = cert.Issuer.Organization[0]
+	}
+	return fmt.Sprintf("%s %s by %s expires %s (%dd)", version, subject, issuer,
+		cert.NotAfter.UTC().Format("2006-01-02"), int(time.Until(cert.NotAfter).Hours()/24))
+}
+
+// ProbeHTTP sends an HTTP HEAD request to the URL and reports response status, duration, and TLS certificate summary.
+func ProbeHTTP(timeoutSec int, url string) (string, error) {
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	start := time.Now()
+	resp, err := inet.DoHTTP(inet.HTTPRequest{TimeoutSec: timeoutSec, Method: "HEAD"}, strings.Replace(url, "%", "%%", -1))
+	if err != nil {
+		return "", err
+	}
+	out := fmt.Sprintf("HTTP %d %s", resp.StatusCode, FormatDuration(time.Since(start)))
+	if resp.TLS != nil {
+		out += "\n" + SummariseTLS(resp.TLS)
+	}
+	return out, nil
+}
+
+func (diag *NetDiag) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	params := strings.Fields(cmd.Content)
+	// The optional resolver parameter comes last and begins with @
+	var resolverAddr string
+	if last := params[len(params)-1]; strings.HasPrefix(last, "@") {
+		resolverAddr = last[1:]
+		params = params[:len(params)-1]
+	}
+	if len(params) == 0 {
+		return &Result{Error: ErrBadNetDiagParam}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cmd.TimeoutSec)*time.Second)
+	defer cancel()
+	var out string
+	var err error
+	switch action := strings.ToLower(params[0]); {
+	case action == NetDiagActDNS && len(params) == 2:
+		out, err = LookupDNS(ctx, getResolver(resolverAddr), params[1], "A")
+	case action == NetDiagActDNS && len(params) == 3:
+		out, err = LookupDNS(ctx, getResolver(resolverAddr), params[1], params[2])
+	case action == NetDiagActReverse && len(params) == 2:
+		var names []string
+		if names, err = getResolver(resolverAddr).LookupAddr(ctx, params[1]); err == nil {
+			out = strings.Join(names, "\n")
+		}
+	case action == NetDiagActTCP && len(params) == 3:
+		if _, err = strconv.ParseUint(params[2], 10, 16); err != nil {
+			return &Result{Error: ErrBadNetDiagParam}
+		}
+		out, err = ProbeTCP(ctx, params[1], params[2])
+	case action == NetDiagActHTTP && len(params) == 2:
+		out, err = ProbeHTTP(cmd.TimeoutSec, params[1])
+	default:
+		return &Result{Error: ErrBadNetDiagParam}
+	}
+	return &Result{Output: out, Error: err}
+}
@@ -0,0 +1,108 @@
+package toolbox
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveFakeDNS answers every DNS query received on the UDP socket with an A record of 10.1.2.3, until the socket is closed.
+func serveFakeDNS(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// Find the end of question name, which is followed by type and class.
+		pos := 12
+		for pos < n && buf[pos] != 0 {
+			pos += int(buf[pos]) + 1
+		}
+		questionEnd := pos + 5
+		if n < 12 || questionEnd > n {
+			continue
+		}
+		resp := append([]byte{}, buf[:questionEnd]...)
+		resp[2], resp[3] = 0x81, 0x80                   // response, recursion available
+		resp[6], resp[7], resp[8], resp[9] = 0, 1, 0, 0 // one answer
+		resp[10], resp[11] = 0, 0
+		if buf[pos+2] == 1 {
+			// Name pointer to the question, type A, class IN, TTL, data length, and address.
+			resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 10, 1, 2, 3)
+		} else {
+			resp[7] = 0
+		}
+		conn.WriteTo(resp, addr)
+	}
+}
+
+func TestNetDiag_Execute(t *testing.T) {
+	diag := NetDiag{}
+	if diag.IsConfigured() {
+		t.Fatal("should not be enabled by default")
+	}
+	diag.Enabled = true
+	if !diag.IsConfigured() {
+		t.Fatal("not configured")
+	}
+	if err := diag.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := diag.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	// Bad parameters
+	for _, content := range []string{"wrong", "@127.0.0.1", "dns", "dns example.com soa", "tcp localhost", "tcp localhost 99999", "http"} {
+		if ret := diag.Execute(Command{TimeoutSec: 5, Content: content}); ret.Error == nil {
+			t.Fatal(content, ret)
+		}
+	}
+	// DNS lookup via a chosen resolver
+	dnsServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dnsServer.Close()
+	go serveFakeDNS(dnsServer)
+	if ret := diag.Execute(Command{TimeoutSec: 5, Content: "dns example.com @" + dnsServer.LocalAddr().String()}); ret.Error != nil || ret.Output != "A 10.1.2.3" {
+		t.Fatal(ret)
+	}
+	if ret := diag.Execute(Command{TimeoutSec: 5, Content: "dns example.com aaaa @" + dnsServer.LocalAddr().String()}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	// TCP probe
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	if ret := diag.Execute(Command{TimeoutSec: 5, Content: "tcp 127.0.0.1 " + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)}); ret.Error == nil {
+		t.Fatal("should have failed on a closed port", ret)
+	}
+	// HTTP and HTTPS probe
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Error("unexpected method", r.Method)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+	// Trust the test server's certificate
+	transport := http.DefaultTransport.(*http.Transport)
+	defer func(config *tls.Config) {
+		transport.TLSClientConfig = config
+	}(transport.TLSClientConfig)
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	if ret := diag.Execute(Command{TimeoutSec: 5, Content: "tcp 127.0.0.1 " + strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)}); ret.Error != nil || !strings.HasPrefix(ret.Output, "open ") {
+		t.Fatal(ret)
+	}
+	ret := diag.Execute(Command{TimeoutSec: 5, Content: "http " + server.URL})
+	if ret.Error != nil || !strings.HasPrefix(ret.Output, "HTTP 418 ") || !strings.Contains(ret.Output, "\nTLS1.3 ") {
+		t.Fatal(ret)
+	}
+}
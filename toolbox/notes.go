@@ -0,0 +1,235 @@
+package toolbox
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	NotesTrigger   = ".n" // NotesTrigger is the trigger prefix string of Notes feature.
+	NotesActAdd    = "add"
+	NotesActList   = "list"
+	NotesActGet    = "get"
+	NotesActSearch = "search"
+	NotesActDelete = "del"
+)
+
+var ErrBadNotesParam = fmt.Errorf("%s name text | %s | %s name | %s text | %s name", NotesActAdd, NotesActList, NotesActGet, NotesActSearch, NotesActDelete)
+
+/*
+Notes stores short text notes by name in an AES-256-CBC encrypted file, so that a note written via one daemon can later
+be retrieved via another. The file is laid out in the same way as a file encrypted by openssl-enc, therefore it may
+also be searched by AESDecrypt feature using the same IV and key.
+*/
+type Notes struct {
+	FilePath string `json:"FilePath"` // FilePath is the location of the encrypted notes file, it is created upon the first note.
+	HexIV    string `json:"HexIV"`    // HexIV is the hex-encoded AES IV.
+	HexKey   string `json:"HexKey"`   // HexKey is the hex-encoded 256-bit AES encryption key.
+
+	iv    []byte
+	key   []byte
+	mutex *sync.Mutex
+}
+
+func (notes *Notes) IsConfigured() bool {
+	return notes.FilePath != "" && notes.HexIV != "" && notes.HexKey != ""
+}
+
+func (notes *Notes) SelfTest() error {
+	if !notes.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	notes.mutex.Lock()
+	defer notes.mutex.Unlock()
+	if _, err := notes.load(); err != nil {
+		return fmt.Errorf("Notes.SelfTest: %v", err)
+	}
+	return nil
+}
+
+func (notes *Notes) Initialise() (err error) {
+	notes.mutex = new(sync.Mutex)
+	if notes.iv, err = hex.DecodeString(notes.HexIV); err != nil || len(notes.iv) != aes.BlockSize {
+		return fmt.Errorf("Notes.Initialise: IV must be %d hex-encoded bytes", aes.BlockSize)
+	}
+	if notes.key, err = hex.DecodeString(notes.HexKey); err != nil || len(notes.key) != 32 {
+		return errors.New("Notes.Initialise: key must be 32 hex-encoded bytes")
+	}
+	// Make sure that existing notes can be read using the key
+	if _, err = notes.load(); err != nil {
+		return fmt.Errorf("Notes.Initialise: %v", err)
+	}
+	return nil
+}
+
+func (notes *Notes) Trigger() Trigger {
+	return NotesTrigger
+}
+
+func (notes *Notes) Usage() string {
+	return ErrBadNotesParam.Error()
+}
+
+/*
+load decrypts the notes file and returns all notes by name. If the file does not yet exist, an empty map is returned.
+Caller must hold the mutex.
+*/
+func (notes *Notes) load() (map[string]string, error) {
+	ret := make(map[string]string)
+	fileContent, err := ioutil.ReadFile(notes.FilePath)
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read notes file \"%s\" - %v", notes.FilePath, err)
+	}
+	cipherLen := len(fileContent) - OpensslSaltedContentOffset
+	if cipherLen < aes.BlockSize || cipherLen%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("\"%s\" does not appear to be an encrypted notes file", notes.FilePath)
+	}
+	// Decrypt in the same way as AESDecrypt does, the plain text is followed by PKCS#7 padding.
+	encrypted := &AESEncryptedFile{FilePath: notes.FilePath, FileContent: fileContent, IV: notes.iv, KeyPrefix: notes.key}
+	plainContent, err := encrypted.Decrypt(nil)
+	if err != nil {
+		return nil, err
+	}
+	plainContent = plainContent[:cipherLen]
+	padLen := int(plainContent[cipherLen-1])
+	if padLen < 1 || padLen > aes.BlockSize || !bytes.Equal(plainContent[cipherLen-padLen:], bytes.Repeat([]byte{byte(padLen)}, padLen)) {
+		return nil, fmt.Errorf("failed to decrypt notes file \"%s\", is the key correct?", notes.FilePath)
+	}
+	if err := json.Unmarshal(plainContent[:cipherLen-padLen], &ret); err != nil {
+		return nil, fmt.Errorf("failed to decrypt notes file \"%s\", is the key correct? - %v", notes.FilePath, err)
+	}
+	return ret, nil
+}
+
+// save encrypts all notes and overwrites the notes file. Caller must hold the mutex.
+func (notes *Notes) save(content map[string]string) error {
+	// Each note sits on its own line so that AESDecrypt feature may find them
+	plainContent, err := json.MarshalIndent(content, "", "")
+	if err != nil {
+		return err
+	}
+	padLen := aes.BlockSize - len(plainContent)%aes.BlockSize
+	plainContent = append(plainContent, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	aesCipher, err := aes.NewCipher(notes.key)
+	if err != nil {
+		return err
+	}
+	// Like openssl-enc, the file begins with "Salted__" and eight bytes of salt that are irrelevant to decryption.
+	fileContent := make([]byte, OpensslSaltedContentOffset+len(plainContent))
+	copy(fileContent, "Salted__")
+	if _, err := rand.Read(fileContent[8:OpensslSaltedContentOffset]); err != nil {
+		return err
+	}
+	cipher.NewCBCEncrypter(aesCipher, notes.iv).CryptBlocks(fileContent[OpensslSaltedContentOffset:], plainContent)
+	// Write into a temporary file first, so that a failed write does not destroy existing notes.
+	tmpPath := notes.FilePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, fileContent, 0600); err != nil {
+		return fmt.Errorf("failed to write notes file - %v", err)
+	}
+	if err := os.Rename(tmpPath, notes.FilePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write notes file - %v", err)
+	}
+	return nil
+}
+
+// splitWord returns the first word of the input and the remainder, both trimmed.
+func splitWord(in string) (word, remainder string) {
+	in = strings.TrimSpace(in)
+	if pos := strings.IndexAny(in, " \t\r\n"); pos != -1 {
+		return in[:pos], strings.TrimSpace(in[pos:])
+	}
+	return in, ""
+}
+
+func (notes *Notes) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	action, param := splitWord(cmd.Content)
+	action = strings.ToLower(action)
+	notes.mutex.Lock()
+	defer notes.mutex.Unlock()
+	content, err := notes.load()
+	if err != nil {
+		return &Result{Error: err}
+	}
+	switch action {
+	case NotesActAdd:
+		name, text := splitWord(param)
+		if name == "" || text == "" {
+			return &Result{Error: ErrBadNotesParam}
+		}
+		content[name] = text
+		if err := notes.save(content); err != nil {
+			return &Result{Error: err}
+		}
+		return &Result{Output: fmt.Sprintf("OK - %d notes", len(content))}
+	case NotesActList:
+		names := make([]string, 0, len(content))
+		for name := range content {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return &Result{Output: fmt.Sprintf("%d %s", len(names), strings.Join(names, " "))}
+	case NotesActGet:
+		text, found := content[param]
+		if !found {
+			return &Result{Error: fmt.Errorf("Cannot find %s", param)}
+		}
+		return &Result{Output: text}
+	case NotesActSearch:
+		if param == "" {
+			return &Result{Error: ErrBadNotesParam}
+		}
+		// Conduct case insensitive search among note names and text
+		searchString := strings.ToLower(param)
+		names := make([]string, 0, 8)
+		for name, text := range content {
+			if strings.Contains(strings.ToLower(name), searchString) || strings.Contains(strings.ToLower(text), searchString) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		var match bytes.Buffer
+		for _, name := range names {
+			match.WriteString(fmt.Sprintf("%s: %s\n", name, content[name]))
+		}
+		return &Result{Output: fmt.Sprintf("%d %s", len(names), match.String())}
+	case NotesActDelete:
+		if _, found := content[param]; !found {
+			return &Result{Error: fmt.Errorf("Cannot find %s", param)}
+		}
+		delete(content, param)
+		if err := notes.save(content); err != nil {
+			return &Result{Error: err}
+		}
+		return &Result{Output: fmt.Sprintf("OK - %d notes", len(content))}
+	default:
+		return &Result{Error: ErrBadNotesParam}
+	}
+}
+
+// GetTestNotes returns a configured but uninitialised notes feature that begins with no notes.
+func GetTestNotes() Notes {
+	filePath := "/tmp/laitos-testnotes"
+	os.Remove(filePath)
+	return Notes{
+		FilePath: filePath,
+		HexIV:    "A28DB439E2D112AB6E9FC2B09A73B605",
+		HexKey:   "F2A515CDDC967C5B0C73FD09264BF67F08A6E1BD273A598F013F6691AAF144A4",
+	}
+}
@@ -0,0 +1,103 @@
+package toolbox
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNotes_Execute(t *testing.T) {
+	notes := Notes{}
+	if notes.IsConfigured() {
+		t.Fatal("should not be configured")
+	}
+	notes = GetTestNotes()
+	if !notes.IsConfigured() {
+		t.Fatal("not configured")
+	}
+	notes.HexKey = "F2A515CD"
+	if err := notes.Initialise(); err == nil {
+		t.Fatal("did not error on short key")
+	}
+	notes = GetTestNotes()
+	if err := notes.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := notes.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	// Bad parameters
+	if ret := notes.Execute(Command{Content: "wrong"}); ret.Error != ErrBadNotesParam {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "add name"}); ret.Error != ErrBadNotesParam {
+		t.Fatal(ret)
+	}
+	// No notes yet
+	if ret := notes.Execute(Command{Content: "list"}); ret.Error != nil || ret.Output != "0 " {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "get parking"}); ret.Error == nil {
+		t.Fatal("did not error")
+	}
+	// Add, overwrite, and retrieve notes
+	if ret := notes.Execute(Command{Content: "add parking level 3 bay 21"}); ret.Error != nil || ret.Output != "OK - 1 notes" {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "add parking level 2 bay 14"}); ret.Error != nil || ret.Output != "OK - 1 notes" {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "add hotel Grand \"Hotel\" room 1408"}); ret.Error != nil || ret.Output != "OK - 2 notes" {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "list"}); ret.Error != nil || ret.Output != "2 hotel parking" {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "get parking"}); ret.Error != nil || ret.Output != "level 2 bay 14" {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "search HOTEL"}); ret.Error != nil || ret.Output != "1 hotel: Grand \"Hotel\" room 1408\n" {
+		t.Fatal(ret)
+	}
+	// Notes are encrypted at rest
+	fileContent, err := ioutil.ReadFile(notes.FilePath)
+	if err != nil || !strings.HasPrefix(string(fileContent), "Salted__") || strings.Contains(string(fileContent), "1408") {
+		t.Fatal(err, string(fileContent))
+	}
+	// Another instance reads the same notes
+	another := GetTestNotes()
+	ioutil.WriteFile(another.FilePath, fileContent, 0600)
+	if err := another.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if ret := another.Execute(Command{Content: "get hotel"}); ret.Error != nil || ret.Output != "Grand \"Hotel\" room 1408" {
+		t.Fatal(ret)
+	}
+	// AESDecrypt feature can also search among the notes
+	decrypt := AESDecrypt{EncryptedFiles: map[string]*AESEncryptedFile{
+		"notes": {FilePath: notes.FilePath, HexIV: notes.HexIV, HexKeyPrefix: notes.HexKey[:52]},
+	}}
+	if err := decrypt.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if ret := decrypt.Execute(Command{Content: "notes " + notes.HexKey[52:] + " bay"}); ret.Error != nil || !strings.HasPrefix(ret.Output, "1 ") || !strings.Contains(ret.Output, "level 2 bay 14") {
+		t.Fatal(ret)
+	}
+	// Delete a note
+	if ret := notes.Execute(Command{Content: "del parking"}); ret.Error != nil || ret.Output != "OK - 1 notes" {
+		t.Fatal(ret)
+	}
+	if ret := notes.Execute(Command{Content: "del parking"}); ret.Error == nil {
+		t.Fatal("did not error")
+	}
+	if ret := notes.Execute(Command{Content: "list"}); ret.Error != nil || ret.Output != "1 hotel" {
+		t.Fatal(ret)
+	}
+	// Wrong key cannot read the notes
+	wrongKey := GetTestNotes()
+	ioutil.WriteFile(wrongKey.FilePath, fileContent, 0600)
+	wrongKey.HexKey = strings.Repeat("00", 32)
+	if err := wrongKey.Initialise(); err == nil {
+		t.Fatal("did not error")
+	}
+}
@@ -0,0 +1,134 @@
+package toolbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	PluginVerbExecute        = "execute" // PluginVerbExecute asks plugin to execute a command
+	PluginVerbHealth         = "health"  // PluginVerbHealth asks plugin to check its health, the command content is empty.
+	PluginSelfTestTimeoutSec = 10        // PluginSelfTestTimeoutSec is the timeout of plugin's health check
+	PluginMaxOutputLen       = 1024      // PluginMaxOutputLen is the maximum length of plugin's non-JSON output to show in an error
+)
+
+// PluginRequest is serialised into JSON and fed to plugin's standard input.
+type PluginRequest struct {
+	Verb       string `json:"Verb"`       // Verb is either PluginVerbExecute or PluginVerbHealth
+	Command    string `json:"Command"`    // Command is the command content without trigger prefix
+	TimeoutSec int    `json:"TimeoutSec"` // TimeoutSec is the number of seconds the plugin may run before it is killed
+}
+
+// PluginResponse is deserialised from plugin's standard output. An empty Error means success.
+type PluginResponse struct {
+	Output string `json:"Output"` // Output is the command output
+	Error  string `json:"Error"`  // Error describes the failure of command execution or health check
+}
+
+/*
+Plugin is a feature implemented by an external executable. For each command, the executable is launched with the
+configured arguments, receives a PluginRequest in JSON via standard input, and is expected to write a PluginResponse in
+JSON to standard output before exiting. The executable is killed if it does not exit before the command timeout.
+*/
+type Plugin struct {
+	Prefix         string   `json:"Trigger"`        // Prefix is the trigger prefix string of the plugin, such as ".x".
+	ExecutablePath string   `json:"ExecutablePath"` // ExecutablePath is the absolute path to plugin executable
+	Args           []string `json:"Args"`           // Args are the command line arguments given to plugin executable
+	UsageText      string   `json:"Usage"`          // UsageText is a short description of plugin's command syntax
+}
+
+func (plugin *Plugin) IsConfigured() bool {
+	return plugin.Prefix != "" && plugin.ExecutablePath != ""
+}
+
+func (plugin *Plugin) SelfTest() error {
+	if !plugin.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	if _, err := plugin.invoke(PluginRequest{Verb: PluginVerbHealth, TimeoutSec: PluginSelfTestTimeoutSec}); err != nil {
+		return fmt.Errorf("Plugin.SelfTest: plugin %s health check failed - %v", plugin.Prefix, err)
+	}
+	return nil
+}
+
+func (plugin *Plugin) Initialise() error {
+	if !strings.HasPrefix(plugin.Prefix, ".") || len(plugin.Prefix) < 2 || strings.ContainsAny(plugin.Prefix, " \t\r\n") {
+		return fmt.Errorf("Plugin.Initialise: trigger \"%s\" must begin with a dot and must not contain spaces", plugin.Prefix)
+	}
+	if info, err := os.Stat(plugin.ExecutablePath); err != nil {
+		return fmt.Errorf("Plugin.Initialise: cannot find executable of plugin %s - %v", plugin.Prefix, err)
+	} else if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("Plugin.Initialise: \"%s\" is not an executable file", plugin.ExecutablePath)
+	}
+	return nil
+}
+
+func (plugin *Plugin) Trigger() Trigger {
+	return Trigger(plugin.Prefix)
+}
+
+func (plugin *Plugin) Usage() string {
+	if plugin.UsageText == "" {
+		return "command"
+	}
+	return plugin.UsageText
+}
+
+func (plugin *Plugin) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	output, err := plugin.invoke(PluginRequest{Verb: PluginVerbExecute, Command: cmd.Content, TimeoutSec: cmd.TimeoutSec})
+	return &Result{Error: err, Output: output}
+}
+
+// invoke launches plugin executable to handle the request, and returns its output and error.
+func (plugin *Plugin) invoke(req PluginRequest) (string, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	proc := exec.Command(plugin.ExecutablePath, plugin.Args...)
+	proc.Stdin = bytes.NewReader(append(reqJSON, '\n'))
+	proc.Stdout = &stdout
+	proc.Stderr = &stderr
+	if err := proc.Start(); err != nil {
+		return "", err
+	}
+	// Wait for plugin to exit in a separate routine in order to monitor for timeout
+	procExitChan := make(chan error, 1)
+	go func() {
+		procExitChan <- proc.Wait()
+	}()
+	var procErr error
+	select {
+	case procErr = <-procExitChan:
+	case <-time.After(time.Duration(req.TimeoutSec) * time.Second):
+		// Do not wait for the killed plugin, its child processes may still hold on to the output pipes.
+		proc.Process.Kill()
+		return "", errors.New("plugin timed out")
+	}
+	// A well behaved plugin always responds in JSON, regardless of its exit status.
+	var resp PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		out := strings.TrimSpace(stdout.String() + stderr.String())
+		if len(out) > PluginMaxOutputLen {
+			out = out[:PluginMaxOutputLen]
+		}
+		if procErr != nil {
+			return out, fmt.Errorf("plugin exited abnormally - %v", procErr)
+		}
+		return out, fmt.Errorf("plugin response is not JSON - %v", err)
+	}
+	if resp.Error != "" {
+		return resp.Output, errors.New(resp.Error)
+	}
+	return resp.Output, nil
+}
@@ -0,0 +1,89 @@
+package toolbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const testPluginScript = `#!/bin/sh
+read -r request
+case "$request" in
+  *'"Verb":"health"'*) echo '{"Output": "healthy"}' ;;
+  *'"Command":"fail"'*) echo '{"Error": "failed on purpose"}' ;;
+  *'"Command":"garbage"'*) echo 'not json'; exit 3 ;;
+  *'"Command":"sleep"'*) sleep 3 ;;
+  *) echo '{"Output": "hello"}' ;;
+esac
+`
+
+func TestPlugin_Execute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "laitos-TestPlugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scriptPath := path.Join(dir, "plugin.sh")
+	if err := ioutil.WriteFile(scriptPath, []byte(testPluginScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := Plugin{}
+	if plugin.IsConfigured() {
+		t.Fatal("should not be configured")
+	}
+	plugin = Plugin{Prefix: "x", ExecutablePath: scriptPath}
+	if err := plugin.Initialise(); err == nil || !strings.Contains(err.Error(), "dot") {
+		t.Fatal(err)
+	}
+	plugin = Plugin{Prefix: ".x", ExecutablePath: dir}
+	if err := plugin.Initialise(); err == nil || !strings.Contains(err.Error(), "not an executable") {
+		t.Fatal(err)
+	}
+	plugin = Plugin{Prefix: ".x", ExecutablePath: scriptPath}
+	if err := plugin.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	if ret := plugin.Execute(Command{TimeoutSec: 5, Content: " "}); ret.Error != ErrEmptyCommand {
+		t.Fatal(ret)
+	}
+	if ret := plugin.Execute(Command{TimeoutSec: 5, Content: "hi"}); ret.Error != nil || ret.Output != "hello" {
+		t.Fatal(ret)
+	}
+	if ret := plugin.Execute(Command{TimeoutSec: 5, Content: "fail"}); ret.Error == nil || ret.Error.Error() != "failed on purpose" {
+		t.Fatal(ret)
+	}
+	if ret := plugin.Execute(Command{TimeoutSec: 5, Content: "garbage"}); ret.Error == nil || ret.Output != "not json" {
+		t.Fatal(ret)
+	}
+	if ret := plugin.Execute(Command{TimeoutSec: 1, Content: "sleep"}); ret.Error == nil || !strings.Contains(ret.Error.Error(), "timed out") {
+		t.Fatal(ret)
+	}
+
+	// Plugin is registered among features, its trigger must not conflict with others.
+	features := FeatureSet{}
+	if err := features.DeserialiseFromJSON([]byte(`{"Plugins": [{"Trigger": ".x", "ExecutablePath": "` + scriptPath + `"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := features.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if features.LookupByTrigger[".x"] == nil {
+		t.Fatal(features.LookupByTrigger)
+	}
+	if err := features.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	// Conflict with built-in features, configured or not, magic prefixes, and other plugins.
+	for _, prefix := range []string{".shell", ".wolfram", ".jobs", ".j", ".x"} {
+		features.Plugins = []Plugin{{Prefix: ".x", ExecutablePath: scriptPath}, {Prefix: prefix, ExecutablePath: scriptPath}}
+		if err := features.Initialise(); err == nil || !strings.Contains(err.Error(), "conflicts") {
+			t.Fatal(prefix, err)
+		}
+	}
+}
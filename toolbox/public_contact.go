@@ -105,6 +105,10 @@ func (cs *PublicContact) Trigger() Trigger {
 	return ".c"
 }
 
+func (cs *PublicContact) Usage() string {
+	return "[name to search]"
+}
+
 func (cs *PublicContact) Execute(cmd Command) *Result {
 	// Return all entries if there is no search term, therefore do not return the error.
 	if err := cmd.Trim(); err != nil {
@@ -55,6 +55,10 @@ func (email *SendMail) Trigger() Trigger {
 	return ".m"
 }
 
+func (email *SendMail) Usage() string {
+	return `addr@dom.tld "subj" body`
+}
+
 func (email *SendMail) Execute(cmd Command) *Result {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
@@ -58,11 +58,15 @@ func (sh *Shell) Trigger() Trigger {
 	return ".s"
 }
 
+func (sh *Shell) Usage() string {
+	return "shell command"
+}
+
 func (sh *Shell) Execute(cmd Command) *Result {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
 	}
 
-	procOut, procErr := misc.InvokeShell(cmd.TimeoutSec, sh.InterpreterPath, cmd.Content)
+	procOut, procErr := misc.InvokeCancellableShell(cmd.TimeoutSec, cmd.Cancel, sh.InterpreterPath, cmd.Content)
 	return &Result{Error: procErr, Output: procOut}
 }
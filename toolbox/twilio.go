@@ -63,6 +63,10 @@ func (twi *Twilio) Trigger() Trigger {
 	return ".p"
 }
 
+func (twi *Twilio) Usage() string {
+	return fmt.Sprintf("%s|%s +##number message", TwilioMakeCall, TwilioSendSMS)
+}
+
 func (twi *Twilio) Execute(cmd Command) (ret *Result) {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
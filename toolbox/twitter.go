@@ -72,6 +72,10 @@ func (twi *Twitter) Trigger() Trigger {
 	return ".t"
 }
 
+func (twi *Twitter) Usage() string {
+	return fmt.Sprintf("%s skip# count# | %s content-to-post", TwitterGetFeeds, TwitterPostTweet)
+}
+
 func (twi *Twitter) Execute(cmd Command) (ret *Result) {
 	if errResult := cmd.Trim(); errResult != nil {
 		ret = errResult
@@ -105,6 +105,10 @@ func (codegen *TwoFACodeGenerator) Trigger() Trigger {
 	return TwoFATrigger
 }
 
+func (codegen *TwoFACodeGenerator) Usage() string {
+	return "key account_name"
+}
+
 func (codegen *TwoFACodeGenerator) Execute(cmd Command) (ret *Result) {
 	if errResult := cmd.Trim(); errResult != nil {
 		return errResult
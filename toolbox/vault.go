@@ -0,0 +1,310 @@
+package toolbox
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	VaultTrigger   = ".v" // VaultTrigger is the trigger prefix string of Vault feature.
+	VaultActGet    = "get"
+	VaultActSearch = "search"
+	VaultActAdd    = "add"
+	VaultActUpdate = "update"
+	VaultKeyLength = 32 // VaultKeyLength is the length of AES-256 key in bytes, that is key prefix and key suffix combined.
+
+	VaultFieldUsername   = "user"
+	VaultFieldPassword   = "pass"
+	VaultFieldTOTPSecret = "totp"
+	VaultFieldNotes      = "notes"
+)
+
+var (
+	// RegexVaultField finds the field names among "field=value" pairs of an entry.
+	RegexVaultField  = regexp.MustCompile(`(?:^|\s)(` + VaultFieldUsername + `|` + VaultFieldPassword + `|` + VaultFieldTOTPSecret + `|` + VaultFieldNotes + `)=`)
+	ErrBadVaultParam = fmt.Errorf("%s|%s key name | %s|%s key name %s=.. %s=.. %s=.. %s=..",
+		VaultActGet, VaultActSearch, VaultActAdd, VaultActUpdate, VaultFieldUsername, VaultFieldPassword, VaultFieldTOTPSecret, VaultFieldNotes)
+	ErrVaultDecrypt = errors.New("Cannot decrypt vault, is the key correct?")
+)
+
+// VaultEntry is a set of credentials stored in the vault.
+type VaultEntry struct {
+	Name       string `json:"Name"`       // Name identifies the entry, such as a website or an account.
+	Username   string `json:"Username"`   // Username is the login name.
+	Password   string `json:"Password"`   // Password is the login password.
+	TOTPSecret string `json:"TOTPSecret"` // TOTPSecret is the base32-encoded seed of two factor authentication codes.
+	Notes      string `json:"Notes"`      // Notes is free-form text.
+}
+
+// String returns the entry's fields that are not empty, one field per line. TOTP secret is represented by its codes.
+func (entry *VaultEntry) String() string {
+	var out bytes.Buffer
+	out.WriteString(entry.Name)
+	for _, field := range []struct{ name, value string }{
+		{VaultFieldUsername, entry.Username},
+		{VaultFieldPassword, entry.Password},
+		{VaultFieldTOTPSecret, entry.TOTPSecret},
+		{VaultFieldNotes, entry.Notes},
+	} {
+		if field.value == "" {
+			continue
+		}
+		value := field.value
+		if field.name == VaultFieldTOTPSecret {
+			prev, current, next, err := GetTwoFACodes(value)
+			if err != nil {
+				value = err.Error()
+			} else {
+				value = fmt.Sprintf("%s %s %s", prev, current, next)
+			}
+		}
+		out.WriteString(fmt.Sprintf("\n%s: %s", field.name, value))
+	}
+	return out.String()
+}
+
+// setFields assigns entry fields from "field=value" pairs. Field values may contain spaces.
+func (entry *VaultEntry) setFields(pairs string) error {
+	positions := RegexVaultField.FindAllStringSubmatchIndex(pairs, -1)
+	if len(positions) == 0 || strings.TrimSpace(pairs[:positions[0][0]]) != "" {
+		return ErrBadVaultParam
+	}
+	for i, pos := range positions {
+		fieldName := pairs[pos[2]:pos[3]]
+		valueEnd := len(pairs)
+		if i < len(positions)-1 {
+			valueEnd = positions[i+1][0]
+		}
+		value := strings.TrimSpace(pairs[pos[1]:valueEnd])
+		switch fieldName {
+		case VaultFieldUsername:
+			entry.Username = value
+		case VaultFieldPassword:
+			entry.Password = value
+		case VaultFieldTOTPSecret:
+			if value != "" {
+				if _, err := GetTwoFACodeForTimeDivision(value, time.Now().Unix()/30); err != nil {
+					return fmt.Errorf("Bad TOTP secret - %v", err)
+				}
+			}
+			entry.TOTPSecret = value
+		case VaultFieldNotes:
+			entry.Notes = value
+		}
+	}
+	return nil
+}
+
+/*
+Vault stores credential entries in a file encrypted by AES-256-GCM, and lets user retrieve, search, add, and update the
+entries. Similar to AESDecrypt, the configuration only carries a prefix of the encryption key, the rest of the key must
+be supplied in each command. The authenticated encryption detects a wrong key or a tampered file, in which case the
+vault is left untouched.
+*/
+type Vault struct {
+	FilePath     string `json:"FilePath"`     // FilePath is the location of the encrypted vault file, it is created upon the first entry.
+	HexKeyPrefix string `json:"HexKeyPrefix"` // HexKeyPrefix is the hex-encoded encryption key, to be prepended to the key given in the command.
+
+	keyPrefix []byte
+	mutex     *sync.Mutex
+}
+
+func (vault *Vault) IsConfigured() bool {
+	return vault.FilePath != "" && vault.HexKeyPrefix != ""
+}
+
+func (vault *Vault) SelfTest() error {
+	if !vault.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	if _, err := os.Stat(vault.FilePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Vault.SelfTest: file \"%s\" is not readable - %v", vault.FilePath, err)
+	}
+	return nil
+}
+
+func (vault *Vault) Initialise() (err error) {
+	vault.mutex = new(sync.Mutex)
+	if vault.keyPrefix, err = hex.DecodeString(vault.HexKeyPrefix); err != nil {
+		return fmt.Errorf("Vault.Initialise: failed to decode key prefix - %v", err)
+	}
+	if len(vault.keyPrefix) >= VaultKeyLength {
+		return fmt.Errorf("Vault.Initialise: key prefix must be shorter than %d bytes, leave the rest to be supplied by command", VaultKeyLength)
+	}
+	return nil
+}
+
+func (vault *Vault) Trigger() Trigger {
+	return VaultTrigger
+}
+
+func (vault *Vault) Usage() string {
+	return ErrBadVaultParam.Error()
+}
+
+// getCipher combines configured key prefix with the key suffix from command to construct AES-GCM cipher.
+func (vault *Vault) getCipher(hexKeySuffix string) (cipher.AEAD, error) {
+	keySuffix, err := hex.DecodeString(hexKeySuffix)
+	if err != nil {
+		return nil, errors.New("Cannot decode hex key")
+	}
+	if len(vault.keyPrefix)+len(keySuffix) != VaultKeyLength {
+		return nil, fmt.Errorf("Key must be %d bytes in total, %d bytes are missing", VaultKeyLength, VaultKeyLength-len(vault.keyPrefix))
+	}
+	key := make([]byte, VaultKeyLength)
+	copy(key, vault.keyPrefix)
+	copy(key[len(vault.keyPrefix):], keySuffix)
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(aesCipher)
+}
+
+/*
+load decrypts the vault file and returns all entries by lower case name. If the file does not yet exist, an empty map
+is returned. Caller must hold the mutex.
+*/
+func (vault *Vault) load(aead cipher.AEAD) (map[string]*VaultEntry, error) {
+	ret := make(map[string]*VaultEntry)
+	fileContent, err := ioutil.ReadFile(vault.FilePath)
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read vault file - %v", err)
+	}
+	// The file consists of a random nonce followed by the sealed entries
+	if len(fileContent) < aead.NonceSize() {
+		return nil, ErrVaultDecrypt
+	}
+	plainContent, err := aead.Open(nil, fileContent[:aead.NonceSize()], fileContent[aead.NonceSize():], []byte(VaultTrigger))
+	if err != nil {
+		return nil, ErrVaultDecrypt
+	}
+	var entries []*VaultEntry
+	if err := json.Unmarshal(plainContent, &entries); err != nil {
+		return nil, fmt.Errorf("Failed to deserialise vault - %v", err)
+	}
+	for _, entry := range entries {
+		ret[strings.ToLower(entry.Name)] = entry
+	}
+	return ret, nil
+}
+
+// save encrypts all entries using a new nonce and overwrites the vault file. Caller must hold the mutex.
+func (vault *Vault) save(aead cipher.AEAD, entries map[string]*VaultEntry) error {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sortedEntries := make([]*VaultEntry, 0, len(entries))
+	for _, name := range names {
+		sortedEntries = append(sortedEntries, entries[name])
+	}
+	plainContent, err := json.Marshal(sortedEntries)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	fileContent := aead.Seal(nonce, nonce, plainContent, []byte(VaultTrigger))
+	// Write into a temporary file first, so that a failed write does not destroy existing entries.
+	tmpPath := vault.FilePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, fileContent, 0600); err != nil {
+		return fmt.Errorf("Failed to write vault file - %v", err)
+	}
+	if err := os.Rename(tmpPath, vault.FilePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to write vault file - %v", err)
+	}
+	return nil
+}
+
+func (vault *Vault) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	action, param := splitWord(cmd.Content)
+	hexKeySuffix, param := splitWord(param)
+	name, fields := splitWord(param)
+	if name == "" {
+		return &Result{Error: ErrBadVaultParam}
+	}
+	aead, err := vault.getCipher(hexKeySuffix)
+	if err != nil {
+		return &Result{Error: err}
+	}
+	vault.mutex.Lock()
+	defer vault.mutex.Unlock()
+	entries, err := vault.load(aead)
+	if err != nil {
+		return &Result{Error: err}
+	}
+	entry, exists := entries[strings.ToLower(name)]
+	switch strings.ToLower(action) {
+	case VaultActGet:
+		if !exists {
+			return &Result{Error: fmt.Errorf("Cannot find %s", name)}
+		}
+		return &Result{Output: entry.String()}
+	case VaultActSearch:
+		// Conduct case insensitive search among entry names, user names, and notes, but never among passwords.
+		searchString := strings.ToLower(param)
+		names := make([]string, 0, 8)
+		for _, entry := range entries {
+			if strings.Contains(strings.ToLower(entry.Name), searchString) ||
+				strings.Contains(strings.ToLower(entry.Username), searchString) ||
+				strings.Contains(strings.ToLower(entry.Notes), searchString) {
+				names = append(names, entry.Name)
+			}
+		}
+		sort.Strings(names)
+		return &Result{Output: fmt.Sprintf("%d %s", len(names), strings.Join(names, " "))}
+	case VaultActAdd:
+		if exists {
+			return &Result{Error: fmt.Errorf("%s already exists, use %s instead", entry.Name, VaultActUpdate)}
+		}
+		entry = &VaultEntry{Name: name}
+		entries[strings.ToLower(name)] = entry
+	case VaultActUpdate:
+		if !exists {
+			return &Result{Error: fmt.Errorf("Cannot find %s", name)}
+		}
+	default:
+		return &Result{Error: ErrBadVaultParam}
+	}
+	// Add or update the entry
+	if err := entry.setFields(fields); err != nil {
+		return &Result{Error: err}
+	}
+	if err := vault.save(aead, entries); err != nil {
+		return &Result{Error: err}
+	}
+	return &Result{Output: fmt.Sprintf("OK - %d entries", len(entries))}
+}
+
+// GetTestVault returns a configured but uninitialised vault that begins with no entries.
+func GetTestVault() Vault {
+	filePath := "/tmp/laitos-testvault"
+	os.Remove(filePath)
+	return Vault{
+		FilePath:     filePath,
+		HexKeyPrefix: "F2A515CDDC967C5B0C73FD09264BF67F08A6E1BD273A598F013F6691AAF1",
+	}
+}
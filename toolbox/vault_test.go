@@ -0,0 +1,102 @@
+package toolbox
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestVault_Execute(t *testing.T) {
+	vault := Vault{}
+	if vault.IsConfigured() {
+		t.Fatal("should not be configured")
+	}
+	vault = GetTestVault()
+	vault.HexKeyPrefix = strings.Repeat("00", VaultKeyLength)
+	if err := vault.Initialise(); err == nil {
+		t.Fatal("did not error on full key in configuration")
+	}
+	vault = GetTestVault()
+	if !vault.IsConfigured() {
+		t.Fatal("not configured")
+	}
+	if err := vault.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	// Bad parameters
+	if ret := vault.Execute(Command{Content: "get 44a4"}); ret.Error != ErrBadVaultParam {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "wrong 44a4 name"}); ret.Error != ErrBadVaultParam {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "get 44 name"}); ret.Error == nil || !strings.Contains(ret.Error.Error(), "missing") {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "add 44a4 bank username=alice"}); ret.Error != ErrBadVaultParam {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "add 44a4 bank totp=not-base32!"}); ret.Error == nil {
+		t.Fatal("did not error on bad TOTP secret")
+	}
+	// Add and retrieve entries
+	if ret := vault.Execute(Command{Content: "add 44a4 Bank user=alice pass=very secret notes=call 555 if locked out"}); ret.Error != nil || ret.Output != "OK - 1 entries" {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "add 44a4 bank user=bob"}); ret.Error == nil {
+		t.Fatal("did not error on duplicated entry")
+	}
+	if ret := vault.Execute(Command{Content: "add 44a4 mail user=alice@example.com totp=iuu3xchz3ftf6hdh"}); ret.Error != nil || ret.Output != "OK - 2 entries" {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "get 44a4 bank"}); ret.Error != nil || ret.Output != "Bank\nuser: alice\npass: very secret\nnotes: call 555 if locked out" {
+		t.Fatal(ret)
+	}
+	prev, current, next, err := GetTwoFACodes("iuu3xchz3ftf6hdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret := vault.Execute(Command{Content: "get 44a4 MAIL"}); ret.Error != nil || ret.Output != "mail\nuser: alice@example.com\ntotp: "+prev+" "+current+" "+next {
+		t.Fatal(ret)
+	}
+	// Search does not look into passwords
+	if ret := vault.Execute(Command{Content: "search 44a4 ALICE"}); ret.Error != nil || ret.Output != "2 Bank mail" {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "search 44a4 secret"}); ret.Error != nil || ret.Output != "0 " {
+		t.Fatal(ret)
+	}
+	// Update an entry
+	if ret := vault.Execute(Command{Content: "update 44a4 nothing pass=new"}); ret.Error == nil {
+		t.Fatal("did not error on missing entry")
+	}
+	if ret := vault.Execute(Command{Content: "update 44a4 bank pass=new secret notes="}); ret.Error != nil || ret.Output != "OK - 2 entries" {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "get 44a4 bank"}); ret.Error != nil || ret.Output != "Bank\nuser: alice\npass: new secret" {
+		t.Fatal(ret)
+	}
+	// The vault is encrypted at rest
+	fileContent, err := ioutil.ReadFile(vault.FilePath)
+	if err != nil || strings.Contains(string(fileContent), "alice") {
+		t.Fatal(err, string(fileContent))
+	}
+	// Wrong key cannot read or modify the vault
+	if ret := vault.Execute(Command{Content: "get 44a5 bank"}); ret.Error != ErrVaultDecrypt {
+		t.Fatal(ret)
+	}
+	if ret := vault.Execute(Command{Content: "add 44a5 another user=mallory"}); ret.Error != ErrVaultDecrypt {
+		t.Fatal(ret)
+	}
+	// Tampered vault is detected
+	fileContent[len(fileContent)-1] ^= 1
+	if err := ioutil.WriteFile(vault.FilePath, fileContent, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ret := vault.Execute(Command{Content: "get 44a4 bank"}); ret.Error != ErrVaultDecrypt {
+		t.Fatal(ret)
+	}
+}
@@ -0,0 +1,178 @@
+package toolbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HouzuoGuo/laitos/inet"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	WebhookTrigger        = ".o" // WebhookTrigger is the trigger prefix string of Webhook feature.
+	WebhookMaxResponseLen = 256  // WebhookMaxResponseLen is the maximum length of response body to be included in command output.
+)
+
+var (
+	// RegexWebhookPlaceholder finds placeholders {1}, {2}, ... and {*} in URL and body templates.
+	RegexWebhookPlaceholder = regexp.MustCompile(`\{(\d+|\*)\}`)
+	ErrBadWebhookParam      = errors.New("name [arguments...]")
+)
+
+/*
+WebhookDef is a definition of an outgoing HTTP request. Its URL and body may contain placeholders {1}, {2}, ... that are
+substituted by the command's arguments in order, and {*} that is substituted by all arguments. Substitutions in URL are
+query-escaped, and substitutions in a JSON body are escaped as JSON string content.
+*/
+type WebhookDef struct {
+	URL         string            `json:"URL"`         // URL template of the request.
+	Method      string            `json:"Method"`      // Method of the request, defaults to GET without a body or POST with a body.
+	Header      map[string]string `json:"Header"`      // Header contains additional request headers, such as an authorization token.
+	ContentType string            `json:"ContentType"` // ContentType of the request body, defaults to "application/json".
+	Body        string            `json:"Body"`        // Body template of the request.
+
+	numArgs int
+}
+
+// Initialise sets default values and counts the arguments required by the templates.
+func (hook *WebhookDef) Initialise() error {
+	if _, err := url.Parse(hook.URL); err != nil || hook.URL == "" {
+		return fmt.Errorf("bad URL \"%s\"", hook.URL)
+	}
+	if hook.Method == "" {
+		hook.Method = http.MethodGet
+		if hook.Body != "" {
+			hook.Method = http.MethodPost
+		}
+	}
+	hook.Method = strings.ToUpper(hook.Method)
+	if hook.ContentType == "" {
+		hook.ContentType = "application/json"
+	}
+	hook.numArgs = 0
+	for _, placeholder := range RegexWebhookPlaceholder.FindAllStringSubmatch(hook.URL+hook.Body, -1) {
+		if num, err := strconv.Atoi(placeholder[1]); err == nil && num > hook.numArgs {
+			hook.numArgs = num
+		}
+	}
+	return nil
+}
+
+// fillWebhookTemplate substitutes placeholders in the template by the arguments, each substitution is escaped by the function.
+func fillWebhookTemplate(template string, args []string, escape func(string) string) string {
+	return RegexWebhookPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == "*" {
+			return escape(strings.Join(args, " "))
+		}
+		num, _ := strconv.Atoi(name)
+		if num < 1 || num > len(args) {
+			return ""
+		}
+		return escape(args[num-1])
+	})
+}
+
+// escapeJSONString escapes the string so that it may be placed in between double quotes in JSON.
+func escapeJSONString(in string) string {
+	quoted, _ := json.Marshal(in)
+	return string(quoted[1 : len(quoted)-1])
+}
+
+// Call sends the request with the arguments filled in its templates, and returns the HTTP response.
+func (hook *WebhookDef) Call(timeoutSec int, args []string) (inet.HTTPResponse, error) {
+	if len(args) < hook.numArgs {
+		return inet.HTTPResponse{}, fmt.Errorf("Needs %d arguments", hook.numArgs)
+	}
+	header := http.Header{}
+	for name, value := range hook.Header {
+		header.Set(name, value)
+	}
+	bodyEscape := func(in string) string { return in }
+	if strings.Contains(hook.ContentType, "json") {
+		bodyEscape = escapeJSONString
+	}
+	reqParam := inet.HTTPRequest{
+		TimeoutSec:  timeoutSec,
+		Method:      hook.Method,
+		Header:      header,
+		ContentType: hook.ContentType,
+	}
+	if hook.Body != "" {
+		reqParam.Body = strings.NewReader(fillWebhookTemplate(hook.Body, args, bodyEscape))
+	}
+	fullURL := fillWebhookTemplate(hook.URL, args, url.QueryEscape)
+	return inet.DoHTTP(reqParam, strings.Replace(fullURL, "%", "%%", -1))
+}
+
+// Webhook calls user's own web services, such as home automation and continuous integration jobs, by their names.
+type Webhook struct {
+	Hooks map[string]*WebhookDef `json:"Hooks"` // Hooks are the web service definitions keyed by name (\w+) that is used in command.
+}
+
+func (webhook *Webhook) IsConfigured() bool {
+	return len(webhook.Hooks) > 0
+}
+
+func (webhook *Webhook) SelfTest() error {
+	if !webhook.IsConfigured() {
+		return ErrIncompleteConfig
+	}
+	// Calling the hooks may have side effects, hence only their definitions are checked.
+	for name, hook := range webhook.Hooks {
+		if hook.URL == "" {
+			return fmt.Errorf("Webhook.SelfTest: hook \"%s\" does not have a URL", name)
+		}
+	}
+	return nil
+}
+
+func (webhook *Webhook) Initialise() error {
+	for name, hook := range webhook.Hooks {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return fmt.Errorf("Webhook.Initialise: hook name \"%s\" must be a single word", name)
+		}
+		if err := hook.Initialise(); err != nil {
+			return fmt.Errorf("Webhook.Initialise: hook \"%s\" has %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (webhook *Webhook) Trigger() Trigger {
+	return WebhookTrigger
+}
+
+func (webhook *Webhook) Usage() string {
+	return ErrBadWebhookParam.Error()
+}
+
+func (webhook *Webhook) Execute(cmd Command) *Result {
+	if errResult := cmd.Trim(); errResult != nil {
+		return errResult
+	}
+	params := strings.Fields(cmd.Content)
+	hook, found := webhook.Hooks[params[0]]
+	if !found {
+		names := make([]string, 0, len(webhook.Hooks))
+		for name := range webhook.Hooks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return &Result{Error: fmt.Errorf("Cannot find %s, choose from: %s", params[0], strings.Join(names, " "))}
+	}
+	resp, err := hook.Call(cmd.TimeoutSec, params[1:])
+	if errResult := HTTPErrorToResult(resp, err); errResult != nil {
+		return errResult
+	}
+	body := strings.TrimSpace(string(resp.Body))
+	if len(body) > WebhookMaxResponseLen {
+		body = body[:WebhookMaxResponseLen]
+	}
+	return &Result{Output: fmt.Sprintf("HTTP %d %s", resp.StatusCode, body)}
+}
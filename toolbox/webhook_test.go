@@ -0,0 +1,70 @@
+package toolbox
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhook_Execute(t *testing.T) {
+	// The web service responds with request details
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(strings.Join([]string{r.Method, r.URL.RawQuery, r.Header.Get("Authorization"), r.Header.Get("Content-Type"), string(body)}, "|") + "\n"))
+	}))
+	defer server.Close()
+
+	webhook := Webhook{}
+	if webhook.IsConfigured() {
+		t.Fatal("should not be configured")
+	}
+	webhook.Hooks = map[string]*WebhookDef{"two words": {URL: server.URL}}
+	if err := webhook.Initialise(); err == nil {
+		t.Fatal("did not error")
+	}
+	webhook.Hooks = map[string]*WebhookDef{
+		"lights": {
+			URL:    server.URL + "/lights?room={1}",
+			Header: map[string]string{"Authorization": "Bearer secret"},
+			Body:   `{"state": "{2}", "note": "{*}"}`,
+		},
+		"build": {URL: server.URL + "/build?msg={*}", Method: "put"},
+		"fail":  {URL: server.URL + "/fail"},
+	}
+	if !webhook.IsConfigured() {
+		t.Fatal("not configured")
+	}
+	if err := webhook.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	if ret := webhook.Execute(Command{TimeoutSec: 5, Content: "nothing"}); ret.Error == nil || !strings.Contains(ret.Error.Error(), "build fail lights") {
+		t.Fatal(ret)
+	}
+	// Not enough arguments
+	if ret := webhook.Execute(Command{TimeoutSec: 5, Content: "lights kitchen"}); ret.Error == nil {
+		t.Fatal(ret)
+	}
+	// Arguments are escaped in URL and JSON body
+	if ret := webhook.Execute(Command{TimeoutSec: 5, Content: `lights kitchen&hall "on"`}); ret.Error != nil ||
+		ret.Output != `HTTP 200 POST|room=kitchen%26hall|Bearer secret|application/json|{"state": "\"on\"", "note": "kitchen\u0026hall \"on\""}` {
+		t.Fatal(ret.Output, ret.Error)
+	}
+	if ret := webhook.Execute(Command{TimeoutSec: 5, Content: "build"}); ret.Error != nil || ret.Output != "HTTP 200 PUT|msg=||application/json|" {
+		t.Fatal(ret.Output, ret.Error)
+	}
+	if ret := webhook.Execute(Command{TimeoutSec: 5, Content: "build deploy now"}); ret.Error != nil || ret.Output != "HTTP 200 PUT|msg=deploy+now||application/json|" {
+		t.Fatal(ret.Output, ret.Error)
+	}
+	// Non-2xx status is an error
+	if ret := webhook.Execute(Command{TimeoutSec: 5, Content: "fail"}); ret.Error == nil || !strings.Contains(ret.Error.Error(), "500") {
+		t.Fatal(ret)
+	}
+}
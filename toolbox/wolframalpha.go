@@ -45,6 +45,10 @@ func (wa *WolframAlpha) Trigger() Trigger {
 	return ".w"
 }
 
+func (wa *WolframAlpha) Usage() string {
+	return "question"
+}
+
 // AtLeast returns i only if it is larger than atLeast. If not, it returns atLeast.
 func AtLeast(i, atLeast int) int {
 	if i < atLeast {